@@ -7,13 +7,12 @@ import (
 	"circadia/ui/pages"
 	"log"
 	"os"
-	"time"
 
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
 
-func NewWindow(app *gtk.Application, debugMode bool) *gtk.ApplicationWindow {
+func NewWindow(app *gtk.Application, store *storage.Store, d *daemon.Daemon, debugMode bool) *gtk.ApplicationWindow {
 	window := gtk.NewApplicationWindow(app)
 	window.SetTitle("Circadia")
 	window.SetResizable(true)
@@ -71,8 +70,6 @@ func NewWindow(app *gtk.Application, debugMode bool) *gtk.ApplicationWindow {
 	fab.SetVAlign(gtk.AlignEnd)
 	fab.SetVisible(true)
 
-	var snoozeCount int
-
 	ringingBox := gtk.NewBox(gtk.OrientationVertical, 0)
 	ringingBox.AddCSSClass("ringing-overlay")
 	ringingBox.SetHExpand(true)
@@ -152,18 +149,19 @@ func NewWindow(app *gtk.Application, debugMode bool) *gtk.ApplicationWindow {
 		}
 	}
 
-	setAlarmPage := pages.NewSetAlarmPage(showModal)
-	stack.AddNamed(setAlarmPage, "set_alarm")
+	setAlarmCtrl := pages.NewSetAlarmPage(store, showModal)
+	stack.AddNamed(setAlarmCtrl.Box, "set_alarm")
 
-	sleepHistoryCtrl := pages.NewSleepHistoryPage()
+	sleepHistoryCtrl := pages.NewSleepHistoryPage(store)
 	stack.AddNamed(sleepHistoryCtrl.Box, "sleep_history")
 
-	settingsPage := pages.NewSettingsPage(debugMode)
-	stack.AddNamed(settingsPage, "settings")
+	settingsCtrl := pages.NewSettingsPage(store, d, debugMode, showModal)
+	stack.AddNamed(settingsCtrl.Box, "settings")
 
 	scrolled.SetChild(stack)
 
 	btnSetAlarm.ConnectClicked(func() {
+		setAlarmCtrl.Refresh()
 		stack.SetVisibleChildName("set_alarm")
 		btnSetAlarm.AddCSSClass("active")
 		btnHistory.RemoveCSSClass("active")
@@ -185,59 +183,46 @@ func NewWindow(app *gtk.Application, debugMode bool) *gtk.ApplicationWindow {
 		btnHistory.RemoveCSSClass("active")
 	})
 
-	ringingPage := pages.NewRingingPage(func(action string) {
-		ringingBox.SetVisible(false)
+	ringingPage := pages.NewRingingPage(d)
 
-		if action == "snooze" {
-			log.Println("Alarm Snoozed")
-			snoozeCount++
-
-			if daemon.IsSleepModeEnabled() {
-				log.Println("Sleep Mode is Active - Restoring Goodnight Overlay")
-				goodnightLabel.SetText("Goodnight")
-				goodnightLabel.SetVisible(true)
-				goodnightBox.SetVisible(true)
-				fab.SetVisible(true)
-				fab.AddCSSClass("fab-active")
-
-				mainBox.AddCSSClass("hidden")
-				tabs.SetVisible(false)
-			} else {
-				tabs.SetVisible(true)
-				fab.SetVisible(true)
-			}
+	daemon.OnAlarmSnoozed = func() {
+		log.Println("Alarm Snoozed")
+		ringingBox.SetVisible(false)
 
-		} else if action == "stop" {
-			log.Println("Alarm Stopped")
+		if d.IsSleepModeEnabled() {
+			log.Println("Sleep Mode is Active - Restoring Goodnight Overlay")
+			goodnightLabel.SetText("Goodnight")
+			goodnightLabel.SetVisible(true)
+			goodnightBox.SetVisible(true)
 			fab.SetVisible(true)
+			fab.AddCSSClass("fab-active")
 
-			if startTime, err := storage.GetSleepStartTime(); err == nil && !startTime.IsZero() {
-				endTime := time.Now()
-
-				if err := daemon.FinalizeSleepSession(startTime, endTime, snoozeCount, true); err != nil {
-					log.Printf("Error finalizing sleep session: %v", err)
-				}
-
-				storage.ClearSleepStartTime()
-
-				daemon.ToggleSleepMode(false)
+			mainBox.AddCSSClass("hidden")
+			tabs.SetVisible(false)
+		} else {
+			tabs.SetVisible(true)
+			fab.SetVisible(true)
+		}
+	}
 
-				goodnightBox.SetVisible(false)
-				goodnightLabel.SetText("")
-				fab.RemoveCSSClass("fab-active")
-			}
+	daemon.OnAlarmStopped = func() {
+		log.Println("Alarm Stopped")
+		ringingBox.SetVisible(false)
+		fab.SetVisible(true)
 
-			snoozeCount = 0
+		goodnightBox.SetVisible(false)
+		goodnightLabel.SetText("")
+		fab.RemoveCSSClass("fab-active")
 
-			tabs.SetVisible(true)
-			stack.SetVisibleChildName("set_alarm")
-		}
-	})
+		tabs.SetVisible(true)
+		stack.SetVisibleChildName("set_alarm")
+	}
 
-	ringingBox.Append(ringingPage)
+	ringingBox.Append(ringingPage.Box)
 
-	daemon.OnAlarmTriggered = func(h, m int) {
-		log.Printf("UI Handling Alarm: %d:%02d", h, m)
+	daemon.OnAlarmTriggered = func(h, m int, label string) {
+		log.Printf("UI Handling Alarm: %d:%02d %q", h, m, label)
+		ringingPage.Show(h, m, label)
 		tabs.SetVisible(false)
 
 		ringingBox.SetVisible(true)
@@ -253,21 +238,28 @@ func NewWindow(app *gtk.Application, debugMode bool) *gtk.ApplicationWindow {
 		}
 	}
 
+	daemon.OnAlarmsChanged = func() {
+		log.Println("Alarms changed, refreshing list...")
+		setAlarmCtrl.Refresh()
+	}
+
 	daemon.OnSleepSessionSaved = func() {
 		log.Println("Sleep session saved, refreshing history...")
 		sleepHistoryCtrl.Refresh()
 	}
 
+	daemon.OnBackupImported = func() {
+		log.Println("Backup imported, refreshing all pages...")
+		setAlarmCtrl.Refresh()
+		sleepHistoryCtrl.Refresh()
+		settingsCtrl.Refresh()
+	}
+
 	daemon.OnSleepModeChanged = func(enabled bool) {
 		log.Printf("UI Sleep Mode: %v", enabled)
 		if enabled {
 			fab.AddCSSClass("fab-active")
 
-			if err := storage.SetSleepStartTime(time.Now()); err != nil {
-				log.Printf("Failed to set sleep start time: %v", err)
-			}
-			snoozeCount = 0
-
 			goodnightBox.SetVisible(true)
 			goodnightBox.AddCSSClass("visible")
 			mainBox.AddCSSClass("hidden")
@@ -281,15 +273,6 @@ func NewWindow(app *gtk.Application, debugMode bool) *gtk.ApplicationWindow {
 		} else {
 			fab.RemoveCSSClass("fab-active")
 
-			if startTime, err := storage.GetSleepStartTime(); err == nil && !startTime.IsZero() {
-				endTime := time.Now()
-				if err := daemon.FinalizeSleepSession(startTime, endTime, snoozeCount, false); err != nil {
-					log.Printf("Manual disable save error: %v", err)
-				}
-			}
-
-			storage.ClearSleepStartTime()
-
 			goodnightBox.RemoveCSSClass("visible")
 			mainBox.RemoveCSSClass("hidden")
 
@@ -303,7 +286,8 @@ func NewWindow(app *gtk.Application, debugMode bool) *gtk.ApplicationWindow {
 		}
 	}
 
-	if daemon.IsRinging() {
+	if alarm, ok := d.RingingAlarm(); ok {
+		ringingPage.Show(alarm.Hour, alarm.Minute, alarm.Label)
 		tabs.SetVisible(false)
 		ringingBox.SetVisible(true)
 		fab.SetVisible(false)
@@ -24,10 +24,15 @@ var (
 	speakerSampleRate  = beep.SampleRate(48000)
 )
 
-func resolveAudioPath() string {
-	customPath, _ := storage.GetAlarmAudioPath()
-	log.Printf("[Audio] Resolving path. Custom: %s", customPath)
-	if customPath != "" {
+// resolveAudioPath picks the first playable file out of the alarm's own sound,
+// the global alarm_audio_path setting and the bundled default.
+func resolveAudioPath(st *storage.Store, alarmPath string) string {
+	globalPath, _ := st.GetAlarmAudioPath()
+	log.Printf("[Audio] Resolving path. Alarm: %s, Global: %s", alarmPath, globalPath)
+	for _, customPath := range []string{alarmPath, globalPath} {
+		if customPath == "" {
+			continue
+		}
 		if _, err := os.Stat(customPath); err == nil {
 			return customPath
 		}
@@ -67,8 +72,8 @@ func initSpeaker() error {
 	return nil
 }
 
-func playSound(path string, loopAudio bool) error {
-	log.Printf("[Audio] playSound called for: %s (loop=%v)", path, loopAudio)
+func playSound(path string, loopAudio bool, fade time.Duration) error {
+	log.Printf("[Audio] playSound called for: %s (loop=%v, fade=%v)", path, loopAudio, fade)
 
 	if err := initSpeaker(); err != nil {
 		return fmt.Errorf("failed to init speaker: %w", err)
@@ -115,6 +120,10 @@ func playSound(path string, loopAudio bool) error {
 		stream = beep.Resample(4, format.SampleRate, speakerSampleRate, stream)
 	}
 
+	if fade > 0 {
+		stream = newCrescendo(stream, speakerSampleRate.N(fade))
+	}
+
 	newCtrl := &beep.Ctrl{Streamer: stream, Paused: false}
 
 	log.Println("[Audio] Acquiring speaker lock...")
@@ -139,29 +148,30 @@ func playSound(path string, loopAudio bool) error {
 	return nil
 }
 
-func StartAlarmSound() {
+func (d *Daemon) StartAlarmSound(alarm storage.Alarm) {
 	log.Println("[Audio] StartAlarmSound requested")
-	path := resolveAudioPath()
-	if err := playSound(path, true); err != nil {
+	path := resolveAudioPath(d.store, alarm.AudioPath)
+	volume, fade := alarmLevels(d.store, alarm)
+	if err := playSound(path, true, fade); err != nil {
 		log.Printf("[Audio] StartAlarmSound Error: %v", err)
 		return
 	}
 
 	go func() {
 		time.Sleep(500 * time.Millisecond)
-		ForceSpeakerOutput()
+		d.ForceAlarmOutput(volume)
 	}()
 }
 
-func PreviewAudio(path string) error {
+func PreviewAudio(st *storage.Store, path string) error {
 	log.Printf("[Audio] PreviewAudio requested for: %s", path)
 	StopAlarmSound()
 
 	if path == "" {
-		path = resolveAudioPath()
+		path = resolveAudioPath(st, "")
 	}
 
-	err := playSound(path, false)
+	err := playSound(path, false, 0)
 	if err != nil {
 		log.Printf("[Audio] PreviewAudio failed: %v", err)
 	}
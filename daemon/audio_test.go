@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"circadia/storage"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveAudioPath_Fallbacks(t *testing.T) {
+	t.Parallel()
+	st := storage.NewMemoryStore()
+
+	dir := t.TempDir()
+	alarmSound := filepath.Join(dir, "alarm.ogg")
+	globalSound := filepath.Join(dir, "global.ogg")
+	for _, p := range []string{alarmSound, globalSound} {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", p, err)
+		}
+	}
+	st.SetAlarmAudioPath(globalSound)
+
+	if got := resolveAudioPath(st, alarmSound); got != alarmSound {
+		t.Errorf("Expected per-alarm sound, got %s", got)
+	}
+
+	if got := resolveAudioPath(st, filepath.Join(dir, "missing.ogg")); got != globalSound {
+		t.Errorf("Expected fallback to global sound, got %s", got)
+	}
+
+	st.SetAlarmAudioPath("")
+	if got := resolveAudioPath(st, ""); filepath.Base(got) != "default.ogg" {
+		t.Errorf("Expected bundled default, got %s", got)
+	}
+}
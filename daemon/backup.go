@@ -0,0 +1,28 @@
+package daemon
+
+import (
+	"io"
+
+	"circadia/storage"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// OnBackupImported runs on the main loop after a backup was imported, so the
+// window can reload alarms, history and settings.
+var OnBackupImported func()
+
+// ImportBackup applies an archive written by storage.Store.Export. The scheduler
+// picks up the imported alarms through the store's write hooks.
+func (d *Daemon) ImportBackup(r io.Reader, mode storage.ImportMode) (storage.ImportResult, error) {
+	result, err := d.store.Import(r, mode)
+	if err != nil {
+		return result, err
+	}
+	if OnBackupImported != nil {
+		glib.IdleAdd(func() {
+			OnBackupImported()
+		})
+	}
+	return result, nil
+}
@@ -1,132 +1,303 @@
 package daemon
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"circadia/internal/dbusapi"
 	"circadia/internal/ipc"
+	"circadia/internal/logind"
+	"circadia/internal/notify"
+	"circadia/internal/rtc"
+	"circadia/internal/sleepphase"
 	"circadia/storage"
 
-	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 )
 
-var OnAlarmTriggered func(h, m int)
+var OnAlarmTriggered func(h, m int, label string)
 var OnSleepModeChanged func(enabled bool)
 var OnSmartWakeUpToggled func(enabled bool)
+var OnAlarmsChanged func()
+
+// OnAlarmStopped and OnAlarmSnoozed run after the ringing alarm is silenced,
+// whether from the window or from another client.
+var OnAlarmStopped func()
+var OnAlarmSnoozed func()
+
+// Options give the daemon its data and connect it to whatever shows it to the user.
+type Options struct {
+	Store *storage.Store
+	// Notifier shows notifications. It defaults to logging them.
+	Notifier notify.Notifier
+	// Activate brings up the window when an alarm rings. It is nil when running headless.
+	Activate func()
+}
+
+// Daemon rings the alarms and tracks sleep. Unless noted otherwise, its state is only
+// touched on the GLib main loop.
+type Daemon struct {
+	// store is where the daemon reads and writes alarms, settings and history.
+	store    *storage.Store
+	notifier notify.Notifier
+	activate func()
+
+	// scheduler wakes the daemon for alarms, snoozes and reminders. It is nil until Start.
+	scheduler *Scheduler
+	// state tracks the approaching, ringing or snoozed alarm.
+	state *AlarmMachine
+
+	// ipc publishes events to socket subscribers once the daemon has started.
+	ipc *ipc.Server
+	// dbus is the session bus object, nil if the bus is not available.
+	dbus *dbusapi.Service
+	// sleepGuard keeps the system from suspending right before an alarm. It is nil when logind is not reachable.
+	sleepGuard *logind.Guard
+	// phaseMonitor samples movement during sleep mode. It is nil outside sleep mode or without an accelerometer.
+	phaseMonitor *sleepphase.Monitor
+	// smartWindow is the smart wake window that is currently open, if any.
+	smartWindow *ScheduledEvent
+	// sessionSnoozes counts the snoozes during the current sleep session.
+	sessionSnoozes int
+
+	// lastNextAlarm identifies the next alarm last published. checkNextAlarm runs on any goroutine.
+	nextAlarmMu   sync.Mutex
+	lastNextAlarm string
+}
 
-var globalApp *gio.Application
+// New returns a daemon for opts without starting anything.
+func New(opts Options) *Daemon {
+	d := &Daemon{
+		store:    opts.Store,
+		notifier: opts.Notifier,
+		activate: opts.Activate,
+		state:    NewAlarmMachine(),
+	}
+	if d.notifier == nil {
+		d.notifier = notify.Log{}
+	}
+	return d
+}
 
-func Start(app *gio.Application) {
-	globalApp = app
+// Start runs the scheduler, audio and IPC. It needs a running GLib main loop but no display.
+func Start(opts Options) *Daemon {
+	d := New(opts)
 	log.Println("Daemon starting...")
 
-	err := ipc.StartListener(func(msg string) {
-		log.Printf("Received signal: %s", msg)
-		if msg == "bedtimeChanged" {
-			resetNotificationState()
-		} else if len(msg) > 15 && msg[:15] == "alarmTriggered:" {
-			if OnAlarmTriggered != nil {
-				var h, m int
-				fmt.Sscanf(msg[15:], "%d:%d", &h, &m)
-				glib.IdleAdd(func() {
-					OnAlarmTriggered(h, m)
-				})
-			}
-		} else if len(msg) > 17 && msg[:17] == "sleepModeChanged:" {
-			var enabled bool
-			fmt.Sscanf(msg[17:], "%t", &enabled)
-			if OnSleepModeChanged != nil {
-				glib.IdleAdd(func() {
-					OnSleepModeChanged(enabled)
-				})
-			}
-		} else if len(msg) > 19 && msg[:19] == "smartWakeUpToggled:" {
-			var enabled bool
-			fmt.Sscanf(msg[19:], "%t", &enabled)
-			if OnSmartWakeUpToggled != nil {
-				glib.IdleAdd(func() {
-					OnSmartWakeUpToggled(enabled)
-					RestartTicker()
-				})
-			}
-		}
-	})
-	if err != nil {
-		log.Printf("Failed to start IPC listener: %v", err)
+	if err := d.store.PruneAlarmExceptions(time.Now()); err != nil {
+		log.Printf("Failed to prune alarm exceptions: %v", err)
 	}
 
-	startTicker(app)
+	d.ipc = d.newIPCServer()
+	if err := ipc.StartServer(d.ipc); err != nil {
+		log.Printf("Failed to start IPC server: %v", err)
+	}
+	d.startDBus()
+	d.watchStorage()
+	d.checkNextAlarm()
+
+	d.startSleepGuard()
+	d.startScheduler()
+	d.restoreAlarmState()
+
+	if d.IsSleepModeEnabled() {
+		d.startPhaseMonitor()
+	}
+	return d
 }
 
-var lastNotifiedTime string
+func (d *Daemon) startScheduler() {
+	load := func() (scheduleInput, error) { return loadScheduleInput(d.store) }
+	d.scheduler = NewScheduler(systemClock{}, load, func(e ScheduledEvent) {
+		glib.IdleAdd(func() {
+			d.handleScheduledEvent(e)
+		})
+	})
+	d.scheduler.Reschedule()
 
-func resetNotificationState() {
-	lastNotifiedTime = ""
+	wake := newWakeProgrammer(func() (rtc.Waker, error) { return rtc.New(rtcWakealarmPath) })
+	d.scheduler.OnWakeChanged(func(at time.Time) {
+		wake.Request(at)
+		glib.IdleAdd(d.updateInhibitor)
+	})
 }
 
-func checkAndNotify(app *gio.Application) {
-	enabled, err := storage.GetNotifyBedtime()
-	if err != nil || !enabled {
-		return
+// reschedule recomputes the next event after something it depends on changed.
+func (d *Daemon) reschedule() {
+	if d.scheduler != nil {
+		d.scheduler.Reschedule()
+		glib.IdleAdd(d.dropStalePreAlarm)
 	}
+}
 
-	bedtimeStr, err := storage.GetBedtime()
-	if err != nil {
+// dropStalePreAlarm ends the run-up to an alarm that was disabled, deleted or moved
+// while it was approaching.
+func (d *Daemon) dropStalePreAlarm() {
+	status := d.state.Status()
+	if status.State != StatePreAlarm || d.scheduler == nil {
 		return
 	}
 
-	bedtime, err := time.Parse("15:04", bedtimeStr)
-	if err != nil {
-		log.Printf("Invalid bedtime format: %v", err)
+	var alarm *storage.Alarm
+	if a, err := d.store.GetAlarm(status.AlarmID); err == nil {
+		alarm = &a
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Failed to load approaching alarm: %v", err)
 		return
 	}
+	var ring *ScheduledEvent
+	if e, ok := d.scheduler.PendingRing(status.AlarmID); ok {
+		ring = &e
+	}
 
-	now := time.Now()
-	target := time.Date(now.Year(), now.Month(), now.Day(), bedtime.Hour(), bedtime.Minute(), 0, 0, now.Location())
+	window := preloadWindow(0)
+	if alarm != nil {
+		window = preloadWindow(smartWakeWindowFor(d.store, *alarm))
+	}
+	if preAlarmOver(alarm, ring, window, time.Now()) {
+		log.Printf("Alarm %d no longer approaching, ending its run-up", status.AlarmID)
+		d.endPreAlarm(status.AlarmID)
+	}
+}
 
-	diff := now.Sub(target)
-	if diff >= 0 && diff < time.Minute {
-		if lastNotifiedTime != "bedtime:"+bedtimeStr {
-			sendNotification(app, "It's Bedtime", "Sleep tight!")
-			lastNotifiedTime = "bedtime:" + bedtimeStr
-		}
+// endPreAlarm ends the run-up to alarm id when it is not going to ring, and gives back
+// the audio output the preload took over.
+func (d *Daemon) endPreAlarm(id int64) {
+	d.closeSmartWindow(id)
+	if _, err := d.state.CancelPreAlarm(id, time.Now()); err == nil {
+		go restoreAudioOutput()
 	}
+}
 
-	target30 := target.Add(-30 * time.Minute)
-	diff30 := now.Sub(target30)
-	if diff30 >= 0 && diff30 < time.Minute {
-		if lastNotifiedTime != "30min:"+bedtimeStr {
-			sendNotification(app, "Wind Down", "Bedtime in 30 minutes.")
-			lastNotifiedTime = "30min:" + bedtimeStr
+func (d *Daemon) handleScheduledEvent(e ScheduledEvent) {
+	switch e.Kind {
+	case EventRing:
+		if !isDue(e.Alarm, e.At) {
+			d.endPreAlarm(e.Alarm.ID)
+			return
+		}
+		d.closeSmartWindow(e.Alarm.ID)
+		if e.Late > missedTolerance {
+			d.handleMissedAlarm(e)
+			return
+		}
+		d.triggerAlarm(e.Alarm)
+	case EventSmartWake:
+		if e.Late > missedTolerance {
+			// The ring of the same alarm is just as late and reports the miss.
+			return
+		}
+		log.Printf("Smart wake window open for alarm at %02d:%02d", e.Alarm.Hour, e.Alarm.Minute)
+		d.state.PreAlarm(e.Alarm.ID, time.Now())
+		d.smartWindow = &e
+		d.checkSmartWake(d.currentPhase())
+	case EventPreload:
+		if e.Late > 0 {
+			return
 		}
+		d.state.PreAlarm(e.Alarm.ID, time.Now())
+		window := preloadWindow(smartWakeWindowFor(d.store, e.Alarm))
+		preloaded := d.state.Status().PreloadedAt
+		if preloaded.IsZero() || time.Since(preloaded) >= window {
+			d.runPreloadLoop(window)
+		}
+	case EventSnoozeEnd:
+		d.ringAfterSnooze()
+	case EventKeepAwake:
+		d.updateInhibitor()
+	case EventWindDown, EventBedtime:
+		if e.Late > missedTolerance {
+			log.Printf("Skipping %s reminder, %v late", e.Kind, e.Late.Round(time.Minute))
+			return
+		}
+		if e.Kind == EventWindDown {
+			d.sendNotification("Wind Down", "Bedtime in 30 minutes.")
+		} else {
+			d.sendNotification("It's Bedtime", "Sleep tight!")
+		}
+	}
+}
+
+// onPhaseEpoch is called from the monitor goroutine after every epoch with the estimated phase.
+func (d *Daemon) onPhaseEpoch(phase sleepphase.Phase) {
+	glib.IdleAdd(func() {
+		d.checkSmartWake(phase)
+	})
+}
+
+// checkSmartWake rings the alarm of the open smart wake window early if phase is light sleep.
+// Sleep mode remains active until the alarm is stopped.
+func (d *Daemon) checkSmartWake(phase sleepphase.Phase) {
+	if !ringEarly(d.smartWindow, phase, d.IsRinging(), time.Now()) {
+		return
 	}
 
-	checkAlarms(app, now)
+	e := *d.smartWindow
+	d.smartWindow = nil
+	log.Printf("Smart Wake Up Triggered in light sleep for alarm at %02d:%02d", e.Alarm.Hour, e.Alarm.Minute)
+	if d.scheduler != nil {
+		d.scheduler.SkipRing(e.Alarm, e.Occurrence)
+	}
+	d.triggerAlarm(e.Alarm)
 }
 
-var audioPreloadActive bool
-var lastAudioPreloadSuccess time.Time
+// handleMissedAlarm rings an alarm that was skipped by a suspend or a clock jump if it is
+// still within the grace period, and otherwise leaves a notification about it.
+func (d *Daemon) handleMissedAlarm(e ScheduledEvent) {
+	missed, err := recordMissedAlarm(d.store, e, time.Now())
+	if err != nil {
+		log.Printf("Failed to record missed alarm: %v", err)
+	}
+
+	d.publish(ipc.EventAlarmMissed, ipc.MissedEvent{
+		Alarm:       alarmInfo(e.Alarm, time.Now()),
+		ScheduledAt: missed.ScheduledAt,
+		RangLate:    missed.RangLate,
+	})
+
+	if missed.RangLate {
+		log.Printf("Alarm at %02d:%02d missed by %v, ringing late", e.Alarm.Hour, e.Alarm.Minute, e.Late.Round(time.Second))
+		d.triggerAlarm(e.Alarm)
+		return
+	}
+
+	log.Printf("Alarm at %02d:%02d missed by %v", e.Alarm.Hour, e.Alarm.Minute, e.Late.Round(time.Second))
+	err = d.notifier.Send(fmt.Sprintf("missed-%d", e.Alarm.ID), notify.Notification{
+		Title: fmt.Sprintf("Missed alarm at %02d:%02d", e.Alarm.Hour, e.Alarm.Minute),
+		Body:  e.Alarm.Label,
+	})
+	if err != nil {
+		log.Printf("Failed to notify about missed alarm: %v", err)
+	}
+	d.endPreAlarm(e.Alarm.ID)
+	d.finishOneShot(e.Alarm.ID)
+}
 
-func runPreloadLoop() {
-	if audioPreloadActive {
+// runPreloadLoop takes over the audio output for an alarm, retrying for as long as its
+// preload window lasts.
+func (d *Daemon) runPreloadLoop(window time.Duration) {
+	if !d.state.StartPreload() {
 		return
 	}
-	audioPreloadActive = true
 	log.Println("Starting Audio Preload Loop...")
 
+	volume, _ := alarmLevels(d.store, storage.Alarm{})
+
 	go func() {
-		defer func() { audioPreloadActive = false }()
+		ok := false
+		defer func() { d.state.FinishPreload(ok, time.Now()) }()
 
 		ticker := time.NewTicker(10 * time.Second)
 		defer ticker.Stop()
 
-		timeout := time.After(40 * time.Minute)
+		timeout := time.After(window)
 
-		if err := ForceSpeakerOutput(); err == nil {
+		if err := d.ForceAlarmOutput(volume); err == nil {
 			log.Println("Audio Preload Success!")
-			lastAudioPreloadSuccess = time.Now()
+			ok = true
 			return
 		}
 
@@ -136,10 +307,14 @@ func runPreloadLoop() {
 				log.Println("Audio Preload Timeout")
 				return
 			case <-ticker.C:
+				if d.state.Status().State != StatePreAlarm {
+					log.Println("Audio Preload Stopped, alarm no longer approaching")
+					return
+				}
 				log.Println("Audio Preload Attempt...")
-				if err := ForceSpeakerOutput(); err == nil {
+				if err := d.ForceAlarmOutput(volume); err == nil {
 					log.Println("Audio Preload Success!")
-					lastAudioPreloadSuccess = time.Now()
+					ok = true
 					return
 				}
 			}
@@ -147,200 +322,167 @@ func runPreloadLoop() {
 	}()
 }
 
-var lastTriggeredTime time.Time
+func (d *Daemon) IsRinging() bool {
+	return d.state.Status().State == StateRinging
+}
 
-func checkAlarms(app *gio.Application, now time.Time) {
-	alarms, err := storage.GetAlarms()
+func (d *Daemon) triggerAlarm(alarm storage.Alarm) {
+	t, err := d.state.Ring(alarm.ID, time.Now())
 	if err != nil {
-		log.Printf("Error checking alarms: %v", err)
 		return
 	}
-
-	if !audioPreloadActive {
-		smartEnabled, _ := storage.GetSmartWakeUp()
-		preloadWindow := 5 * time.Minute
-		if smartEnabled {
-			preloadWindow = 35 * time.Minute
-		}
-
-		if lastAudioPreloadSuccess.IsZero() || time.Since(lastAudioPreloadSuccess) >= preloadWindow {
-			for _, a := range alarms {
-				if !a.Enabled {
-					continue
-				}
-				target := time.Date(now.Year(), now.Month(), now.Day(), a.Hour, a.Minute, 0, 0, now.Location())
-				if target.Before(now) {
-					target = target.Add(24 * time.Hour)
-				}
-				diff := target.Sub(now)
-				if diff > 0 && diff <= preloadWindow {
-					runPreloadLoop()
-					break
-				}
-			}
-		}
+	if t.From.State == StateSnoozed && d.scheduler != nil {
+		// The new alarm takes over from the snoozed one.
+		d.scheduler.CancelSnooze()
 	}
+	d.persistAlarmState()
+	d.updateInhibitor()
 
-	if !lastTriggeredTime.IsZero() && now.Sub(lastTriggeredTime) < 1*time.Minute {
-		return
-	}
+	log.Printf("ALARM TRIGGERED: %d:%02d %q", alarm.Hour, alarm.Minute, alarm.Label)
 
-	currentHour := now.Hour()
-	currentMinute := now.Minute()
+	d.StartAlarmSound(alarm)
 
-	for _, alarm := range alarms {
-		if alarm.Enabled && alarm.Hour == currentHour && alarm.Minute == currentMinute {
-			lastTriggeredTime = now
-			triggerAlarm(app, alarm)
-			return
-		}
-	}
-}
+	d.showRinging(alarm)
 
-var activeAlarmID int64 = -1
+	d.publish(ipc.EventAlarmRinging, alarmInfo(alarm, time.Now()))
+	d.checkNextAlarm()
 
-func IsRinging() bool {
-	return activeAlarmID != -1
+	if err := signalAlarmTriggered(alarm); err != nil {
+		log.Printf("Failed to signal alarm to UI: %v", err)
+	}
 }
 
-func triggerAlarm(app *gio.Application, alarm storage.Alarm) {
-	if activeAlarmID == alarm.ID {
-		return
+// RingingAlarm returns the alarm that is currently ringing, if any.
+func (d *Daemon) RingingAlarm() (storage.Alarm, bool) {
+	status := d.state.Status()
+	if status.State != StateRinging {
+		return storage.Alarm{}, false
 	}
-	activeAlarmID = alarm.ID
-
-	log.Printf("ALARM TRIGGERED: %d:%02d", alarm.Hour, alarm.Minute)
-
-	StartAlarmSound()
-
-	app.Activate()
-
-	if err := ipc.SendSignal(fmt.Sprintf("alarmTriggered:%d:%02d", alarm.Hour, alarm.Minute)); err != nil {
-		log.Printf("Failed to signal alarm to UI: %v", err)
+	alarm, err := d.store.GetAlarm(status.AlarmID)
+	if err != nil {
+		log.Printf("Failed to load ringing alarm: %v", err)
+		return storage.Alarm{}, false
 	}
+	return alarm, true
 }
 
-var snoozeTimer *time.Timer
+const alarmNotificationID = "alarm"
 
-func StopAlarm() {
-	StopAlarmSound()
-	activeAlarmID = -1
-	if snoozeTimer != nil {
-		snoozeTimer.Stop()
-		snoozeTimer = nil
+// showRinging brings up the window, if there is one, and notifies about the ringing alarm.
+func (d *Daemon) showRinging(alarm storage.Alarm) {
+	if d.activate != nil {
+		d.activate()
 	}
-}
 
-func sendNotification(app *gio.Application, title, body string) {
-	notification := gio.NewNotification(title)
-	notification.SetBody(body)
-	app.SendNotification(title, notification)
+	title := "Alarm"
+	if alarm.Label != "" {
+		title = alarm.Label
+	}
+	err := d.notifier.Send(alarmNotificationID, notify.Notification{
+		Title:  title,
+		Body:   fmt.Sprintf("Wake up! It's %02d:%02d.", alarm.Hour, alarm.Minute),
+		Urgent: true,
+	})
+	if err != nil {
+		log.Printf("Failed to send alarm notification: %v", err)
+	}
 }
 
-func ToggleSleepMode(enabled bool) {
-	log.Printf("Sleep Mode Toggled: %v", enabled)
+func (d *Daemon) StopAlarm() {
+	StopAlarmSound()
+	if err := d.notifier.Withdraw(alarmNotificationID); err != nil {
+		log.Printf("Failed to withdraw alarm notification: %v", err)
+	}
 
-	go func() {
-		msg := fmt.Sprintf("sleepModeChanged:%v", enabled)
-		if err := ipc.SendSignal(msg); err != nil {
-			log.Println("IPC Signal Error:", err)
+	id := int64(-1)
+	if t, err := d.state.Dismiss(time.Now()); err == nil {
+		id = t.From.AlarmID
+		if alarm, err := d.store.GetAlarm(id); err == nil {
+			d.publish(ipc.EventDismissed, alarmInfo(alarm, time.Now()))
 		}
-	}()
-}
+	}
+	d.persistAlarmState()
 
-var (
-	alarmTicker *time.Ticker
-	tickerQuit  chan struct{}
-)
+	if d.scheduler != nil {
+		d.scheduler.CancelSnooze()
+	}
 
-func startTicker(app *gio.Application) {
-	RestartTicker()
-}
+	go restoreAudioOutput()
 
-func RestartTicker() {
-	if alarmTicker != nil {
-		alarmTicker.Stop()
-		close(tickerQuit)
+	if id != -1 {
+		d.finishOneShot(id)
 	}
 
-	tickerQuit = make(chan struct{})
+	d.updateInhibitor()
 
-	smartEnabled, _ := storage.GetSmartWakeUp()
-	interval := 30 * time.Second
-	if smartEnabled {
-		interval = 29 * time.Minute
+	if d.IsSleepModeEnabled() {
+		d.endSleepSession(true)
+		ToggleSleepMode(false)
 	}
 
-	log.Printf("Starting Ticker with interval: %v (Smart Wake Up: %v)", interval, smartEnabled)
-	alarmTicker = time.NewTicker(interval)
-
-	go func() {
-		for {
-			select {
-			case <-tickerQuit:
-				return
-			case <-alarmTicker.C:
-				if globalApp != nil {
-					glib.IdleAdd(func() {
-						checkAndNotify(globalApp)
-						checkSmartWakeUp()
-					})
-				}
-			}
-		}
-	}()
+	if OnAlarmStopped != nil {
+		glib.IdleAdd(func() {
+			OnAlarmStopped()
+		})
+	}
 }
 
-func checkSmartWakeUp() {
-	log.Println("Checking Smart Wake Up...")
+func restoreAudioOutput() {
+	if err := RestoreAudioOutput(); err != nil {
+		log.Printf("Failed to restore audio output: %v", err)
+	}
+}
 
-	smartEnabled, err := storage.GetSmartWakeUp()
+// finishOneShot disables a one-shot alarm after it has rung, or deletes it if the user asked for that.
+func (d *Daemon) finishOneShot(id int64) {
+	alarm, err := d.store.GetAlarm(id)
 	if err != nil {
-		log.Println("Error reading smart wake up setting:", err)
+		log.Printf("Failed to load stopped alarm: %v", err)
 		return
 	}
-	if !smartEnabled {
+	if !alarm.IsOneShot() {
 		return
 	}
 
-	alarms, err := storage.GetAlarms()
+	if alarm.DeleteAfterRing {
+		log.Printf("Deleting one-shot alarm %d", id)
+		err = d.store.DeleteAlarm(id)
+	} else {
+		log.Printf("Disabling one-shot alarm %d", id)
+		err = d.store.ToggleAlarm(id, false)
+	}
 	if err != nil {
-		log.Println("Error reading alarms for smart wake up:", err)
+		log.Printf("Failed to finish one-shot alarm: %v", err)
 		return
 	}
 
-	now := time.Now()
-
-	for _, a := range alarms {
-		if !a.Enabled {
-			continue
-		}
-
-		target := time.Date(now.Year(), now.Month(), now.Day(), a.Hour, a.Minute, 0, 0, now.Location())
+	if OnAlarmsChanged != nil {
+		glib.IdleAdd(func() {
+			OnAlarmsChanged()
+		})
+	}
+}
 
-		if target.Before(now) {
-			target = target.Add(24 * time.Hour)
-		}
+func (d *Daemon) sendNotification(title, body string) {
+	if err := d.notifier.Send(title, notify.Notification{Title: title, Body: body}); err != nil {
+		log.Printf("Failed to send notification: %v", err)
+	}
+}
 
-		diff := target.Sub(now)
-		if diff > 0 && diff <= 30*time.Minute {
-			log.Printf("Smart Wake Up Triggered for alarm at %02d:%02d (in %v)", a.Hour, a.Minute, diff)
+func ToggleSleepMode(enabled bool) {
+	log.Printf("Sleep Mode Toggled: %v", enabled)
 
-			if globalApp != nil {
-				glib.IdleAdd(func() {
-					triggerAlarm(globalApp, a)
-					// Sleep Mode remains active until alarm is stopped
-				})
-			}
-			return
+	go func() {
+		if err := ipc.Call(ipc.CmdSetSleepMode, ipc.EnabledArgs{Enabled: enabled}, nil); err != nil {
+			log.Println("IPC Signal Error:", err)
 		}
-	}
+	}()
 }
 
 var OnSleepSessionSaved func()
 
-func IsSleepModeEnabled() bool {
-	t, err := storage.GetSleepStartTime()
+func (d *Daemon) IsSleepModeEnabled() bool {
+	t, err := d.store.GetSleepStartTime()
 	return err == nil && !t.IsZero()
 }
 
@@ -351,50 +493,98 @@ func SetDebugMode(enabled bool) {
 	log.Printf("Daemon Debug Mode: %v", debugMode)
 }
 
-func SnoozeAlarm() {
+// SnoozeAlarm silences the ringing alarm and rings it again after its snooze duration.
+// It refuses, and keeps the alarm ringing, when the alarm's snooze policy does not allow it.
+func (d *Daemon) SnoozeAlarm() error {
+	status := d.state.Status()
+	if status.State != StateRinging {
+		return ErrNotRinging
+	}
+
+	alarm, alarmErr := d.store.GetAlarm(status.AlarmID)
+	if alarmErr != nil {
+		alarm.ID = status.AlarmID
+	}
+	policy := snoozePolicy(d.store, alarm)
+	t, err := d.state.Snooze(status.AlarmID, policy, time.Now())
+	if errors.Is(err, ErrInvalidTransition) {
+		return ErrNotRinging
+	}
+	if err != nil {
+		log.Printf("Snooze refused: %v", err)
+		return err
+	}
+
 	StopAlarmSound()
-	activeAlarmID = -1
+	d.sessionSnoozes++
+	d.persistAlarmState()
 
-	if snoozeTimer != nil {
-		snoozeTimer.Stop()
+	go restoreAudioOutput()
+
+	until := t.To.SnoozeUntil
+	event := ipc.SnoozedEvent{Until: until}
+	if alarmErr == nil {
+		info := alarmInfo(alarm, time.Now())
+		event.Alarm = &info
 	}
+	d.publish(ipc.EventSnoozed, event)
 
-	log.Println("Snoozing...")
-	durationMin, err := storage.GetSnoozeDuration()
-	if err != nil {
-		durationMin = 15
+	log.Printf("Snoozing for %v (%d used, max %d)...", policy.Duration, t.To.SnoozesUsed, policy.MaxCount)
+	if d.scheduler != nil {
+		d.scheduler.Snooze(alarm, until)
 	}
+	d.updateInhibitor()
 
-	log.Printf("Snoozing for %d minutes...", durationMin)
-	snoozeTimer = time.AfterFunc(time.Duration(durationMin)*time.Minute, func() {
-		log.Println("Snooze finished! Ringing again.")
+	if OnAlarmSnoozed != nil {
+		glib.IdleAdd(func() {
+			OnAlarmSnoozed()
+		})
+	}
+	return nil
+}
 
-		StartAlarmSound()
+// ringAfterSnooze rings the snoozed alarm again once its snooze is over.
+func (d *Daemon) ringAfterSnooze() {
+	if _, err := d.state.EndSnooze(time.Now()); err != nil {
+		return
+	}
+	log.Println("Snooze finished! Ringing again.")
+	d.announceRinging()
+}
 
-		if globalApp != nil {
-			glib.IdleAdd(func() {
-				globalApp.Activate()
-			})
-		}
+// announceRinging sounds and shows the ringing alarm after a snooze, or when the
+// daemon restarts while it was ringing.
+func (d *Daemon) announceRinging() {
+	d.persistAlarmState()
 
-		h, m := time.Now().Hour(), time.Now().Minute()
-		if err := ipc.SendSignal(fmt.Sprintf("alarmTriggered:%d:%02d", h, m)); err != nil {
-			log.Printf("Failed to signal alarm to UI: %v", err)
-		}
-	})
+	alarm, ok := d.RingingAlarm()
+	if !ok {
+		now := time.Now()
+		alarm = storage.Alarm{Hour: now.Hour(), Minute: now.Minute()}
+	}
+
+	d.StartAlarmSound(alarm)
+	d.publish(ipc.EventAlarmRinging, alarmInfo(alarm, time.Now()))
+
+	d.showRinging(alarm)
+
+	if err := signalAlarmTriggered(alarm); err != nil {
+		log.Printf("Failed to signal alarm to UI: %v", err)
+	}
 }
 
-func FinalizeSleepSession(startTime, endTime time.Time, snoozeCount int, bypassDurationCheck bool) error {
+func (d *Daemon) FinalizeSleepSession(startTime, endTime time.Time, snoozeCount int, bypassDurationCheck bool) error {
 	duration := endTime.Sub(startTime)
 
 	// Only save if duration > 1 hour OR if check is bypassed (e.g. Alarm Stop)
 	if bypassDurationCheck || duration > 1*time.Hour {
 		// Save to DB
-		if err := storage.AddSleepSession(startTime, endTime, snoozeCount); err != nil {
+		if err := d.store.AddSleepSession(startTime, endTime, snoozeCount); err != nil {
 			log.Printf("Failed to save sleep session: %v", err)
 			return err
 		}
 		log.Printf("Sleep Session Saved: %v - %v (Snoozes: %d)", startTime, endTime, snoozeCount)
+		d.publish(ipc.EventSessionSaved, ipc.SessionEvent{Start: startTime, End: endTime, SnoozeCount: snoozeCount})
 
 		if OnSleepSessionSaved != nil {
 			glib.IdleAdd(func() {
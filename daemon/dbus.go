@@ -0,0 +1,233 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"circadia/internal/dbusapi"
+	"circadia/internal/ipc"
+	"circadia/storage"
+)
+
+func (d *Daemon) startDBus() {
+	svc, err := dbusapi.Connect(dbusBackend{d})
+	if err != nil {
+		log.Printf("Failed to start D-Bus service: %v", err)
+		return
+	}
+	d.dbus = svc
+
+	// Start runs on the main loop, which Status needs to be free.
+	go refreshDBus(svc)
+}
+
+func refreshDBus(svc *dbusapi.Service) {
+	if err := svc.Refresh(); err != nil {
+		log.Printf("Failed to refresh D-Bus properties: %v", err)
+	}
+}
+
+// dbusBackend serves the D-Bus methods the same way the socket handlers do.
+type dbusBackend struct {
+	d *Daemon
+}
+
+func (b dbusBackend) ListAlarms() ([]dbusapi.Alarm, error) {
+	alarms, err := b.d.store.GetAlarms()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]dbusapi.Alarm, 0, len(alarms))
+	for _, a := range alarms {
+		out = append(out, dbusAlarm(a, now))
+	}
+	return out, nil
+}
+
+func (b dbusBackend) AddAlarm(hour, minute int, label string, days uint8) (int64, error) {
+	id, err := b.d.store.AddAlarm(storage.Alarm{
+		Hour:    hour,
+		Minute:  minute,
+		Enabled: true,
+		Label:   label,
+		Days:    storage.Weekdays(days),
+	})
+	if err != nil {
+		return 0, err
+	}
+	notifyAlarmsChanged()
+	return id, nil
+}
+
+func (b dbusBackend) UpdateAlarm(a dbusapi.Alarm) error {
+	alarm, err := b.d.store.GetAlarm(a.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: no alarm with ID %d", dbusapi.ErrNotFound, a.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	var date time.Time
+	if a.Date != "" {
+		date, err = time.ParseInLocation(storage.DateLayout, a.Date, time.Local)
+		if err != nil {
+			return fmt.Errorf("%w: invalid date %q", dbusapi.ErrInvalidArgs, a.Date)
+		}
+	}
+
+	alarm.Hour = int(a.Hour)
+	alarm.Minute = int(a.Minute)
+	alarm.Enabled = a.Enabled
+	alarm.Label = a.Label
+	alarm.Days = storage.Weekdays(a.Days)
+	alarm.Date = date
+	if err := b.d.store.UpdateAlarm(alarm); err != nil {
+		return err
+	}
+	notifyAlarmsChanged()
+	return nil
+}
+
+func (b dbusBackend) RemoveAlarm(id int64) error {
+	if _, err := b.d.store.GetAlarm(id); errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: no alarm with ID %d", dbusapi.ErrNotFound, id)
+	}
+	if err := b.d.store.DeleteAlarm(id); err != nil {
+		return err
+	}
+	notifyAlarmsChanged()
+	return nil
+}
+
+func (b dbusBackend) Snooze() (time.Time, error) {
+	until, err := onMainLoop(func() (any, error) {
+		if err := b.d.SnoozeAlarm(); err != nil {
+			return nil, fmt.Errorf("%w: %v", dbusapi.ErrRefused, err)
+		}
+		return b.d.state.Status().SnoozeUntil, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until.(time.Time), nil
+}
+
+func (b dbusBackend) Stop() error {
+	_, err := onMainLoop(func() (any, error) {
+		if !b.d.state.Status().Alerting() {
+			return nil, fmt.Errorf("%w: %v", dbusapi.ErrRefused, ErrNotRinging)
+		}
+		b.d.StopAlarm()
+		return nil, nil
+	})
+	return err
+}
+
+func (b dbusBackend) SetSleepMode(enabled bool) error {
+	_, err := onMainLoop(func() (any, error) {
+		b.d.applySleepMode(enabled)
+		return nil, nil
+	})
+	return err
+}
+
+func (b dbusBackend) Status() (dbusapi.Status, error) {
+	reply, err := onMainLoop(func() (any, error) {
+		return b.d.status(time.Now())
+	})
+	if err != nil {
+		return dbusapi.Status{}, err
+	}
+
+	s := reply.(ipc.StatusReply)
+	out := dbusapi.Status{
+		IsRinging: s.Ringing != nil,
+		SleepMode: s.SleepMode,
+	}
+	if s.NextAlarm != nil && s.NextAlarm.Next != nil {
+		out.NextAlarm = *s.NextAlarm.Next
+	}
+	return out, nil
+}
+
+func dbusAlarm(a storage.Alarm, now time.Time) dbusapi.Alarm {
+	return alarmInfoToDBus(alarmInfo(a, now), a)
+}
+
+func alarmInfoToDBus(info ipc.AlarmInfo, a storage.Alarm) dbusapi.Alarm {
+	out := dbusapi.Alarm{
+		ID:      info.ID,
+		Hour:    int32(info.Hour),
+		Minute:  int32(info.Minute),
+		Enabled: info.Enabled,
+		Label:   info.Label,
+		Days:    uint8(a.Days),
+	}
+	if a.IsDated() {
+		out.Date = a.Date.Format(storage.DateLayout)
+	}
+	if info.Next != nil {
+		out.Next = info.Next.Unix()
+	}
+	return out
+}
+
+// emitDBus mirrors a socket event as a D-Bus signal and refreshes the properties.
+func (d *Daemon) emitDBus(eventType string, data any) {
+	svc := d.dbus
+	if svc == nil {
+		return
+	}
+
+	var err error
+	switch eventType {
+	case ipc.EventAlarmRinging:
+		err = svc.Emit(dbusapi.SignalAlarmRinging, d.eventAlarm(data.(ipc.AlarmInfo)))
+	case ipc.EventDismissed:
+		err = svc.Emit(dbusapi.SignalDismissed, d.eventAlarm(data.(ipc.AlarmInfo)))
+	case ipc.EventSnoozed:
+		e := data.(ipc.SnoozedEvent)
+		var alarm dbusapi.Alarm
+		if e.Alarm != nil {
+			alarm = d.eventAlarm(*e.Alarm)
+		}
+		err = svc.Emit(dbusapi.SignalSnoozed, alarm, e.Until.Unix())
+	case ipc.EventSleepStarted:
+		e := data.(ipc.SleepEvent)
+		err = svc.Emit(dbusapi.SignalSleepStarted, e.Start.Unix())
+	case ipc.EventSleepEnded:
+		e := data.(ipc.SleepEvent)
+		end := time.Now()
+		if e.End != nil {
+			end = *e.End
+		}
+		err = svc.Emit(dbusapi.SignalSleepEnded, e.Start.Unix(), end.Unix())
+	case ipc.EventSessionSaved:
+		e := data.(ipc.SessionEvent)
+		err = svc.Emit(dbusapi.SignalSessionSaved, e.Start.Unix(), e.End.Unix(), int32(e.SnoozeCount))
+	case ipc.EventSettingsChanged:
+		err = svc.Emit(dbusapi.SignalSettingsChanged, data.(ipc.SettingEvent).Key)
+	case ipc.EventNextAlarmChanged:
+		var alarm dbusapi.Alarm
+		if e := data.(ipc.NextAlarmEvent); e.Alarm != nil {
+			alarm = d.eventAlarm(*e.Alarm)
+		}
+		err = svc.Emit(dbusapi.SignalNextAlarmChanged, alarm)
+	}
+	if err != nil {
+		log.Printf("Failed to emit D-Bus signal for %s: %v", eventType, err)
+	}
+
+	// Status hops onto the main loop, and publish is often called from it.
+	go refreshDBus(svc)
+}
+
+// eventAlarm converts an alarm from an event, looking up its schedule in storage.
+func (d *Daemon) eventAlarm(info ipc.AlarmInfo) dbusapi.Alarm {
+	alarm, _ := d.store.GetAlarm(info.ID)
+	return alarmInfoToDBus(info, alarm)
+}
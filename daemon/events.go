@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"circadia/internal/dbusapi"
+	"circadia/internal/ipc"
+	"circadia/storage"
+)
+
+func (d *Daemon) publish(eventType string, data any) {
+	if d.ipc != nil {
+		d.ipc.Publish(eventType, data)
+	}
+	d.emitDBus(eventType, data)
+}
+
+// watchStorage turns writes from anywhere in the process into events.
+func (d *Daemon) watchStorage() {
+	d.store.OnSettingWritten = func(key string) {
+		if slices.Contains(storage.StateSettings, key) {
+			return
+		}
+		d.reschedule()
+		d.publish(ipc.EventSettingsChanged, ipc.SettingEvent{Key: key})
+	}
+	d.store.OnAlarmsWritten = func() {
+		if d.dbus != nil {
+			if err := d.dbus.Emit(dbusapi.SignalAlarmsChanged); err != nil {
+				log.Printf("Failed to emit AlarmsChanged: %v", err)
+			}
+		}
+		d.reschedule()
+		d.checkNextAlarm()
+	}
+}
+
+// checkNextAlarm publishes next_alarm_changed when the first upcoming alarm or its time differs from the last one seen.
+func (d *Daemon) checkNextAlarm() {
+	alarms, err := d.store.GetAlarms()
+	if err != nil {
+		log.Printf("Error checking next alarm: %v", err)
+		return
+	}
+
+	now := time.Now()
+	next, at, ok := NextAlarm(alarms, now)
+
+	key := ""
+	var event ipc.NextAlarmEvent
+	if ok {
+		key = fmt.Sprintf("%d@%s", next.ID, at.Format(time.RFC3339))
+		info := alarmInfo(next, now)
+		event.Alarm = &info
+	}
+
+	d.nextAlarmMu.Lock()
+	changed := key != d.lastNextAlarm
+	d.lastNextAlarm = key
+	d.nextAlarmMu.Unlock()
+
+	if changed {
+		d.publish(ipc.EventNextAlarmChanged, event)
+	}
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"time"
+
+	"circadia/storage"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+)
+
+// fadeStartVolume is where a crescendo starts, in effects.Volume units with base 2 (about -60 dB).
+const fadeStartVolume = -10.0
+
+// fadeStep is how many samples share the same gain while ramping, small enough to avoid audible steps.
+const fadeStep = 512
+
+// crescendo raises the gain of an effects.Volume stage from almost silent to unity over a number of samples.
+type crescendo struct {
+	vol   *effects.Volume
+	total int
+	pos   int
+}
+
+func newCrescendo(s beep.Streamer, total int) *crescendo {
+	c := &crescendo{
+		vol:   &effects.Volume{Streamer: s, Base: 2},
+		total: total,
+	}
+	c.update()
+	return c
+}
+
+func (c *crescendo) update() {
+	if c.total <= 0 || c.pos >= c.total {
+		c.vol.Volume = 0
+		return
+	}
+	progress := float64(c.pos) / float64(c.total)
+	c.vol.Volume = fadeStartVolume * (1 - progress)
+}
+
+func (c *crescendo) Stream(samples [][2]float64) (int, bool) {
+	if c.pos >= c.total {
+		return c.vol.Stream(samples)
+	}
+
+	filled := 0
+	for filled < len(samples) {
+		want := min(fadeStep, len(samples)-filled)
+		n, ok := c.vol.Stream(samples[filled : filled+want])
+		filled += n
+		c.pos += n
+		c.update()
+		if !ok {
+			return filled, filled > 0
+		}
+		if n < want {
+			break
+		}
+	}
+	return filled, true
+}
+
+func (c *crescendo) Err() error {
+	return c.vol.Err()
+}
+
+// alarmLevels returns the sink volume (percent) and fade-in duration for an alarm,
+// applying its overrides to the global settings.
+func alarmLevels(st *storage.Store, alarm storage.Alarm) (volume int, fade time.Duration) {
+	volume, _ = st.GetAlarmVolume()
+	fadeSeconds, _ := st.GetFadeInDuration()
+
+	if alarm.Volume != nil {
+		volume = *alarm.Volume
+	}
+	if alarm.FadeInSeconds != nil {
+		fadeSeconds = *alarm.FadeInSeconds
+	}
+
+	volume = max(1, min(volume, 100))
+	fadeSeconds = max(0, fadeSeconds)
+	return volume, time.Duration(fadeSeconds) * time.Second
+}
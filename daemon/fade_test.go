@@ -0,0 +1,51 @@
+package daemon
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// constant streams an endless run of full-scale samples.
+func constant() beep.Streamer {
+	return beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			samples[i] = [2]float64{1, 1}
+		}
+		return len(samples), true
+	})
+}
+
+func TestCrescendo_RampsToUnity(t *testing.T) {
+	total := 48000
+	c := newCrescendo(constant(), total)
+
+	samples := make([][2]float64, total+fadeStep)
+	n, ok := c.Stream(samples)
+	if !ok || n != len(samples) {
+		t.Fatalf("Expected %d samples, got %d (ok=%v)", len(samples), n, ok)
+	}
+
+	if first := samples[0][0]; first > 0.01 {
+		t.Errorf("Expected the first samples to be nearly silent, got %f", first)
+	}
+	for i := fadeStep; i < total; i += fadeStep {
+		if samples[i][0] < samples[i-fadeStep][0] {
+			t.Fatalf("Gain decreased at sample %d", i)
+		}
+	}
+	if last := samples[len(samples)-1][0]; math.Abs(last-1) > 1e-9 {
+		t.Errorf("Expected unity gain after the fade, got %f", last)
+	}
+}
+
+func TestCrescendo_Disabled(t *testing.T) {
+	c := newCrescendo(constant(), 0)
+
+	samples := make([][2]float64, 10)
+	c.Stream(samples)
+	if samples[0][0] != 1 {
+		t.Errorf("Expected unity gain without a fade, got %f", samples[0][0])
+	}
+}
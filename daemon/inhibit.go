@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"log"
+	"time"
+
+	"circadia/internal/logind"
+)
+
+func (d *Daemon) startSleepGuard() {
+	manager, err := logind.Connect()
+	if err != nil {
+		log.Printf("Suspend inhibitor unavailable: %v", err)
+		return
+	}
+	d.sleepGuard = logind.NewGuard(manager, "Circadia", "An alarm is about to ring")
+}
+
+// updateInhibitor takes or releases the sleep inhibitor to match the alarm state. It runs on the main loop.
+func (d *Daemon) updateInhibitor() {
+	if d.sleepGuard == nil {
+		return
+	}
+
+	horizon, _ := d.store.GetSuspendInhibitHorizon()
+	var next time.Time
+	if d.scheduler != nil {
+		next, _ = d.scheduler.NextAlert()
+	}
+	alerting := d.state.Status().Alerting()
+
+	want := keepAwake(alerting, next, time.Duration(horizon)*time.Minute, time.Now())
+	if want == d.sleepGuard.Held() {
+		return
+	}
+	if err := d.sleepGuard.Set(want); err != nil {
+		log.Printf("Failed to update suspend inhibitor: %v", err)
+		return
+	}
+	log.Printf("Suspend inhibitor held: %v", want)
+}
+
+// keepAwake reports whether suspend should be inhibited: while an alarm rings or is
+// snoozed, and from horizon before the next alert. A zero horizon turns this off.
+func keepAwake(alerting bool, next time.Time, horizon time.Duration, now time.Time) bool {
+	if horizon <= 0 {
+		return false
+	}
+	if alerting {
+		return true
+	}
+	return !next.IsZero() && !now.Before(next.Add(-horizon))
+}
@@ -0,0 +1,35 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeepAwake(t *testing.T) {
+	alarm := monday(6, 30)
+
+	tests := []struct {
+		name     string
+		alerting bool
+		next     time.Time
+		horizon  time.Duration
+		now      time.Time
+		want     bool
+	}{
+		{"outside the horizon", false, alarm, 15 * time.Minute, monday(6, 0), false},
+		{"at the start of the horizon", false, alarm, 15 * time.Minute, monday(6, 15), true},
+		{"inside the horizon", false, alarm, 15 * time.Minute, monday(6, 29), true},
+		{"ringing", true, alarm.AddDate(0, 0, 1), 15 * time.Minute, monday(6, 31), true},
+		{"dismissed", false, alarm.AddDate(0, 0, 1), 15 * time.Minute, monday(6, 31), false},
+		{"no alarm scheduled", false, time.Time{}, 15 * time.Minute, monday(6, 0), false},
+		{"turned off", true, alarm, 0, monday(6, 29), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keepAwake(tt.alerting, tt.next, tt.horizon, tt.now); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package daemon
+
+import (
+	"time"
+
+	"circadia/storage"
+)
+
+// missedTolerance is how late an event may fire before it counts as missed, which
+// leaves room for a busy main loop.
+const missedTolerance = time.Minute
+
+// recordMissedAlarm decides whether a late alarm still rings and stores the decision.
+func recordMissedAlarm(st *storage.Store, e ScheduledEvent, now time.Time) (storage.MissedAlarm, error) {
+	graceMin, _ := st.GetMissedAlarmGrace()
+	missed := storage.MissedAlarm{
+		AlarmID:     e.Alarm.ID,
+		ScheduledAt: e.Occurrence,
+		DetectedAt:  now,
+		RangLate:    e.Late <= time.Duration(graceMin)*time.Minute,
+	}
+	return missed, st.AddMissedAlarm(missed)
+}
@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"circadia/storage"
+)
+
+func TestRecordMissedAlarm(t *testing.T) {
+	tests := []struct {
+		name     string
+		grace    int
+		late     time.Duration
+		rangLate bool
+	}{
+		{"within grace rings late", 10, 5 * time.Minute, true},
+		{"at the end of grace rings late", 10, 10 * time.Minute, true},
+		{"past grace only notifies", 10, 11 * time.Minute, false},
+		{"zero grace never rings late", 0, 2 * time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			st := storage.NewMemoryStore()
+			st.SetMissedAlarmGrace(tt.grace)
+
+			scheduled := time.Now().Add(-tt.late).Truncate(time.Minute)
+			e := ScheduledEvent{
+				Kind:       EventRing,
+				At:         scheduled,
+				Alarm:      storage.Alarm{ID: 7, Hour: scheduled.Hour(), Minute: scheduled.Minute()},
+				Occurrence: scheduled,
+				Late:       tt.late,
+			}
+
+			missed, err := recordMissedAlarm(st, e, time.Now())
+			if err != nil {
+				t.Fatalf("recordMissedAlarm failed: %v", err)
+			}
+			if missed.RangLate != tt.rangLate {
+				t.Errorf("Expected RangLate %v, got %v", tt.rangLate, missed.RangLate)
+			}
+
+			stored, err := st.GetMissedAlarms(scheduled.Add(-time.Minute))
+			if err != nil {
+				t.Fatalf("GetMissedAlarms failed: %v", err)
+			}
+			if len(stored) != 1 || stored[0].AlarmID != 7 || stored[0].RangLate != tt.rangLate {
+				t.Errorf("Unexpected stored missed alarms %+v", stored)
+			}
+		})
+	}
+}
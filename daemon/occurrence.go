@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"fmt"
+	"time"
+
+	"circadia/storage"
+)
+
+// maxLookahead bounds the search for the next occurrence, so a repeating alarm
+// covered by a long vacation is still found while an impossible one is not searched forever.
+const maxLookahead = 366
+
+// NextOccurrence returns the first time at or after from that the alarm is due to ring.
+// One-shot alarms ring at the next matching wall clock time, whichever day that falls on,
+// dated alarms only on their date, and days covered by an exception are skipped.
+func NextOccurrence(a storage.Alarm, from time.Time) (time.Time, bool) {
+	if a.IsDated() {
+		target := time.Date(a.Date.Year(), a.Date.Month(), a.Date.Day(), a.Hour, a.Minute, 0, 0, from.Location())
+		if target.Before(from) || a.IsSkipped(target) {
+			return time.Time{}, false
+		}
+		return target, true
+	}
+
+	for i := 0; i <= maxLookahead; i++ {
+		target := time.Date(from.Year(), from.Month(), from.Day()+i, a.Hour, a.Minute, 0, 0, from.Location())
+		if target.Before(from) || a.IsSkipped(target) {
+			continue
+		}
+		if a.IsOneShot() || a.Days.Has(target.Weekday()) {
+			return target, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isDue reports whether the alarm should ring during the minute containing now.
+func isDue(a storage.Alarm, now time.Time) bool {
+	if !a.Enabled {
+		return false
+	}
+	if a.Hour != now.Hour() || a.Minute != now.Minute() {
+		return false
+	}
+	if a.IsSkipped(now) {
+		return false
+	}
+	if a.IsDated() {
+		return a.Date.Year() == now.Year() && a.Date.Month() == now.Month() && a.Date.Day() == now.Day()
+	}
+	return a.IsOneShot() || a.Days.Has(now.Weekday())
+}
+
+// SkipNextOccurrence silences only the next time a repeating alarm would ring.
+func SkipNextOccurrence(st *storage.Store, a storage.Alarm) error {
+	next, ok := NextOccurrence(a, time.Now())
+	if !ok {
+		return fmt.Errorf("alarm %d has no upcoming occurrence", a.ID)
+	}
+	return st.AddAlarmException(a.ID, next, next)
+}
+
+// NextAlarm returns the enabled alarm that rings first after from.
+func NextAlarm(alarms []storage.Alarm, from time.Time) (storage.Alarm, time.Time, bool) {
+	var next storage.Alarm
+	var at time.Time
+	found := false
+	for _, a := range alarms {
+		if !a.Enabled {
+			continue
+		}
+		t, ok := NextOccurrence(a, from)
+		if !ok {
+			continue
+		}
+		if !found || t.Before(at) {
+			next, at, found = a, t, true
+		}
+	}
+	return next, at, found
+}
@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"circadia/storage"
+	"testing"
+	"time"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	// Wednesday 2026-03-04 12:00
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name  string
+		alarm storage.Alarm
+		want  time.Time
+	}{
+		{"later today", storage.Alarm{Hour: 18, Minute: 30, Days: storage.EveryDay}, time.Date(2026, 3, 4, 18, 30, 0, 0, time.Local)},
+		{"earlier today rolls to tomorrow", storage.Alarm{Hour: 7, Minute: 0, Days: storage.EveryDay}, time.Date(2026, 3, 5, 7, 0, 0, 0, time.Local)},
+		{"exactly now", storage.Alarm{Hour: 12, Minute: 0, Days: storage.EveryDay}, now},
+		{"weekends skip ahead", storage.Alarm{Hour: 9, Minute: 0, Days: storage.Weekend}, time.Date(2026, 3, 7, 9, 0, 0, 0, time.Local)},
+		{"only today but passed waits a week", storage.Alarm{Hour: 6, Minute: 0, Days: storage.Wednesday}, time.Date(2026, 3, 11, 6, 0, 0, 0, time.Local)},
+		{"one-shot later today", storage.Alarm{Hour: 13, Minute: 15}, time.Date(2026, 3, 4, 13, 15, 0, 0, time.Local)},
+		{"one-shot passed rings tomorrow", storage.Alarm{Hour: 6, Minute: 0}, time.Date(2026, 3, 5, 6, 0, 0, 0, time.Local)},
+		{"dated alarm", storage.Alarm{Hour: 4, Minute: 30, Date: date(2026, 11, 3)}, time.Date(2026, 11, 3, 4, 30, 0, 0, time.Local)},
+		{"skipped tomorrow", storage.Alarm{Hour: 7, Minute: 0, Days: storage.EveryDay, Exceptions: []storage.AlarmException{
+			{Start: date(2026, 3, 5), End: date(2026, 3, 5)},
+		}}, time.Date(2026, 3, 6, 7, 0, 0, 0, time.Local)},
+		{"vacation longer than a week", storage.Alarm{Hour: 7, Minute: 0, Days: storage.WorkWeek, Exceptions: []storage.AlarmException{
+			{Start: date(2026, 3, 5), End: date(2026, 3, 20)},
+		}}, time.Date(2026, 3, 23, 7, 0, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NextOccurrence(tt.alarm, now)
+			if !ok {
+				t.Fatalf("Expected an occurrence")
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNextOccurrence_PastDate(t *testing.T) {
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.Local)
+	alarm := storage.Alarm{Hour: 7, Minute: 0, Date: date(2026, 3, 4)}
+
+	if next, ok := NextOccurrence(alarm, now); ok {
+		t.Errorf("Expected no occurrence for a date in the past, got %v", next)
+	}
+}
+
+func TestIsDue_DatedAndSkipped(t *testing.T) {
+	now := time.Date(2026, 11, 3, 4, 30, 10, 0, time.Local)
+
+	dated := storage.Alarm{Hour: 4, Minute: 30, Enabled: true, Date: date(2026, 11, 3)}
+	if !isDue(dated, now) {
+		t.Error("Expected dated alarm to ring on its date")
+	}
+	if isDue(dated, now.AddDate(0, 0, 1)) {
+		t.Error("Dated alarm should not ring the day after")
+	}
+
+	skipped := storage.Alarm{Hour: 4, Minute: 30, Enabled: true, Days: storage.EveryDay, Exceptions: []storage.AlarmException{
+		{Start: date(2026, 11, 1), End: date(2026, 11, 7)},
+	}}
+	if isDue(skipped, now) {
+		t.Error("Alarm should stay silent during its vacation")
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+func TestIsDue_RespectsWeekdays(t *testing.T) {
+	saturday := time.Date(2026, 3, 7, 7, 0, 30, 0, time.Local)
+	alarm := storage.Alarm{Hour: 7, Minute: 0, Enabled: true, Days: storage.WorkWeek}
+
+	if isDue(alarm, saturday) {
+		t.Error("Weekday alarm should not ring on Saturday")
+	}
+
+	alarm.Days = alarm.Days.With(time.Saturday, true)
+	if !isDue(alarm, saturday) {
+		t.Error("Expected alarm to ring once Saturday is selected")
+	}
+
+	alarm.Days = 0
+	if !isDue(alarm, saturday) {
+		t.Error("Expected one-shot alarm to ring on any day")
+	}
+
+	alarm.Enabled = false
+	if isDue(alarm, saturday) {
+		t.Error("Disabled alarm should never be due")
+	}
+}
+
+func TestNextAlarm_PicksEarliestEnabled(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local) // Monday
+	alarms := []storage.Alarm{
+		{ID: 1, Hour: 6, Minute: 0, Enabled: true, Days: storage.EveryDay},
+		{ID: 2, Hour: 13, Minute: 0, Enabled: false, Days: storage.EveryDay},
+		{ID: 3, Hour: 18, Minute: 30, Enabled: true, Days: storage.EveryDay},
+	}
+
+	a, at, ok := NextAlarm(alarms, from)
+	if !ok || a.ID != 3 {
+		t.Fatalf("Expected alarm 3, got %d (found %v)", a.ID, ok)
+	}
+	if want := time.Date(2024, 1, 1, 18, 30, 0, 0, time.Local); !at.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, at)
+	}
+
+	if _, _, ok := NextAlarm(alarms[1:2], from); ok {
+		t.Error("Expected no next alarm when all are disabled")
+	}
+}
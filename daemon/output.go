@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"circadia/storage"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// Sink is a PulseAudio output the user can pin alarms to.
+type Sink struct {
+	Name        string
+	Description string
+	Headphones  bool
+}
+
+// ListSinks returns the outputs PulseAudio currently knows about.
+func ListSinks() ([]Sink, error) {
+	c, conn, err := connectPulse()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var reply proto.GetSinkInfoListReply
+	if err := c.Request(&proto.GetSinkInfoList{}, &reply); err != nil {
+		return nil, fmt.Errorf("list sinks failed: %w", err)
+	}
+
+	var sinks []Sink
+	for _, s := range reply {
+		if s == nil {
+			continue
+		}
+		description := s.Device
+		if description == "" {
+			description = s.SinkName
+		}
+		sinks = append(sinks, Sink{Name: s.SinkName, Description: description, Headphones: isHeadphones(s)})
+	}
+	return sinks, nil
+}
+
+// chooseSink picks the sink an alarm should play on. A pinned sink wins while it is
+// connected; otherwise the policy decides.
+func chooseSink(sinks proto.GetSinkInfoListReply, defaultSink, policy, pinned string) *proto.GetSinkInfoReply {
+	if pinned != "" {
+		if s := findSink(sinks, pinned); s != nil {
+			return s
+		}
+		log.Printf("PulseAudio: Pinned sink %s is not connected, using policy %q", pinned, policy)
+	}
+
+	switch policy {
+	case storage.OutputFollowDefault:
+		if s := findSink(sinks, defaultSink); s != nil {
+			return s
+		}
+	case storage.OutputPreferHeadphones:
+		if s := findSink(sinks, defaultSink); s != nil && isHeadphones(s) {
+			return s
+		}
+		for _, s := range sinks {
+			if s != nil && isHeadphones(s) {
+				return s
+			}
+		}
+	}
+
+	var best *proto.GetSinkInfoReply
+	bestScore := -1
+	for _, s := range sinks {
+		if s == nil {
+			continue
+		}
+		score := speakerScore(s)
+		log.Printf("PulseAudio: Found Sink: %s (Desc: %s) Score: %d", s.SinkName, s.Device, score)
+
+		if score > bestScore {
+			best = s
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func findSink(sinks proto.GetSinkInfoListReply, name string) *proto.GetSinkInfoReply {
+	if name == "" {
+		return nil
+	}
+	for _, s := range sinks {
+		if s != nil && s.SinkName == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// speakerScore rates how likely a sink is the device's built-in speaker.
+func speakerScore(s *proto.GetSinkInfoReply) int {
+	score := 0
+	name := strings.ToLower(s.SinkName)
+	desc := strings.ToLower(s.Device)
+
+	if strings.Contains(name, "speaker") || strings.Contains(desc, "speaker") || strings.Contains(name, "primary") {
+		score += 10
+	}
+	if strings.Contains(name, "pci") || strings.Contains(name, "platform") {
+		score += 2
+	}
+	if strings.Contains(name, "usb") || strings.Contains(name, "bluez") {
+		score -= 5
+	}
+	return score
+}
+
+// isHeadphones reports whether a sink is a headset or headphones, including a wired
+// jack that shares a sink with the speaker but has its headphone port active.
+func isHeadphones(s *proto.GetSinkInfoReply) bool {
+	name := strings.ToLower(s.SinkName)
+	desc := strings.ToLower(s.Device)
+	port := strings.ToLower(s.ActivePortName)
+
+	if strings.Contains(name, "bluez") || strings.Contains(port, "headphone") || strings.Contains(port, "headset") {
+		return true
+	}
+	return strings.Contains(desc, "headphone") || strings.Contains(desc, "headset")
+}
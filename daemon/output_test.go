@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"testing"
+
+	"circadia/storage"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestChooseSink(t *testing.T) {
+	sinks := proto.GetSinkInfoListReply{
+		{SinkIndex: 0, SinkName: "alsa_output.platform-speaker", Device: "Speaker"},
+		{SinkIndex: 1, SinkName: "bluez_output.AA_BB", Device: "Earbuds"},
+		{SinkIndex: 2, SinkName: "alsa_output.usb-dac", Device: "USB DAC"},
+	}
+
+	tests := []struct {
+		name        string
+		defaultSink string
+		policy      string
+		pinned      string
+		want        string
+	}{
+		{"AlwaysSpeaker", "bluez_output.AA_BB", storage.OutputAlwaysSpeaker, "", "alsa_output.platform-speaker"},
+		{"FollowDefault", "alsa_output.usb-dac", storage.OutputFollowDefault, "", "alsa_output.usb-dac"},
+		{"FollowDefault_Unknown", "gone", storage.OutputFollowDefault, "", "alsa_output.platform-speaker"},
+		{"PreferHeadphones", "alsa_output.usb-dac", storage.OutputPreferHeadphones, "", "bluez_output.AA_BB"},
+		{"Pinned", "bluez_output.AA_BB", storage.OutputAlwaysSpeaker, "alsa_output.usb-dac", "alsa_output.usb-dac"},
+		{"Pinned_Disconnected", "alsa_output.usb-dac", storage.OutputFollowDefault, "gone", "alsa_output.usb-dac"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseSink(sinks, tt.defaultSink, tt.policy, tt.pinned)
+			if got == nil {
+				t.Fatalf("Expected %s, got no sink", tt.want)
+			}
+			if got.SinkName != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got.SinkName)
+			}
+		})
+	}
+}
+
+func TestChooseSink_PreferHeadphonesWithoutHeadphones(t *testing.T) {
+	sinks := proto.GetSinkInfoListReply{
+		{SinkIndex: 0, SinkName: "alsa_output.pci-analog", Device: "Built-in Audio", ActivePortName: "analog-output-speaker"},
+	}
+	got := chooseSink(sinks, "", storage.OutputPreferHeadphones, "")
+	if got == nil || got.SinkIndex != 0 {
+		t.Fatalf("Expected fallback to the speaker, got %v", got)
+	}
+
+	sinks[0].ActivePortName = "analog-output-headphones"
+	if !isHeadphones(sinks[0]) {
+		t.Error("Expected a sink with its headphone port active to count as headphones")
+	}
+}
@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"log"
+	"time"
+
+	"circadia/storage"
+)
+
+// maxRestoredAge is how old a saved ringing or snoozed alarm may be before a restarted
+// daemon forgets it instead of ringing. It only matters when the daemon was down for long.
+const maxRestoredAge = 12 * time.Hour
+
+type restoreAction int
+
+const (
+	restoreNothing restoreAction = iota
+	restoreSnooze
+	restoreRinging
+)
+
+// restoreActionFor decides how to continue with a saved state: a snooze that has not run
+// out is armed again, everything else that is recent enough rings.
+func restoreActionFor(s storage.AlarmState, now time.Time) restoreAction {
+	due := s.Since
+	if s.Snoozed {
+		due = s.SnoozeUntil
+	}
+	if now.Sub(due) > maxRestoredAge {
+		return restoreNothing
+	}
+	if s.Snoozed && s.SnoozeUntil.After(now) {
+		return restoreSnooze
+	}
+	return restoreRinging
+}
+
+// persistAlarmState saves the ringing or snoozed alarm, or clears the saved state when there is none.
+func (d *Daemon) persistAlarmState() {
+	status := d.state.Status()
+
+	var err error
+	if status.Alerting() {
+		err = d.store.SaveAlarmState(storage.AlarmState{
+			AlarmID:     status.AlarmID,
+			Snoozed:     status.State == StateSnoozed,
+			Since:       status.Since,
+			SnoozeUntil: status.SnoozeUntil,
+			SnoozesUsed: status.SnoozesUsed,
+		})
+	} else {
+		err = d.store.ClearAlarmState()
+	}
+	if err != nil {
+		log.Printf("Failed to persist alarm state: %v", err)
+	}
+}
+
+// restoreAlarmState picks up the alarm that was ringing or snoozed when the daemon last stopped.
+// It needs the scheduler to be running.
+func (d *Daemon) restoreAlarmState() {
+	saved, ok, err := d.store.GetAlarmState()
+	if err != nil {
+		log.Printf("Failed to restore alarm state: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	status := AlarmStatus{AlarmID: saved.AlarmID, Since: saved.Since, SnoozesUsed: saved.SnoozesUsed}
+	action := restoreActionFor(saved, now)
+	switch action {
+	case restoreSnooze:
+		status.State = StateSnoozed
+		status.SnoozeUntil = saved.SnoozeUntil
+	case restoreRinging:
+		status.State = StateRinging
+		status.Since = now
+	default:
+		log.Printf("Dropping stale state of alarm %d", saved.AlarmID)
+		d.persistAlarmState()
+		return
+	}
+	if _, err := d.state.Restore(status); err != nil {
+		log.Printf("Failed to restore alarm state: %v", err)
+		return
+	}
+
+	if action == restoreSnooze {
+		log.Printf("Restoring snooze of alarm %d until %s", saved.AlarmID, saved.SnoozeUntil.Format("15:04"))
+		alarm, err := d.store.GetAlarm(saved.AlarmID)
+		if err != nil {
+			alarm = storage.Alarm{ID: saved.AlarmID}
+		}
+		if d.scheduler != nil {
+			d.scheduler.Snooze(alarm, saved.SnoozeUntil)
+		}
+	} else {
+		log.Printf("Resuming alarm %d that was ringing or due before the restart", saved.AlarmID)
+		d.announceRinging()
+	}
+	d.updateInhibitor()
+}
@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"circadia/storage"
+)
+
+func TestRestoreActionFor(t *testing.T) {
+	now := monday(7, 0)
+
+	tests := []struct {
+		name  string
+		state storage.AlarmState
+		want  restoreAction
+	}{
+		{"snooze still running", storage.AlarmState{Snoozed: true, Since: monday(6, 55), SnoozeUntil: monday(7, 4)}, restoreSnooze},
+		{"snooze ran out while down", storage.AlarmState{Snoozed: true, Since: monday(6, 50), SnoozeUntil: monday(6, 59)}, restoreRinging},
+		{"was ringing", storage.AlarmState{Since: monday(6, 58)}, restoreRinging},
+		{"rang long ago", storage.AlarmState{Since: monday(7, 0).Add(-13 * time.Hour)}, restoreNothing},
+		{"snooze ran out long ago", storage.AlarmState{Snoozed: true, Since: monday(6, 0).Add(-24 * time.Hour), SnoozeUntil: monday(6, 9).Add(-24 * time.Hour)}, restoreNothing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restoreActionFor(tt.state, now); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// newTestDaemon returns a daemon on a fresh in-memory store, with nothing started.
+func newTestDaemon(t *testing.T) *Daemon {
+	t.Helper()
+	return New(Options{Store: storage.NewMemoryStore()})
+}
+
+func TestRestoreAlarmState_Snooze(t *testing.T) {
+	t.Parallel()
+	d := newTestDaemon(t)
+	st := d.store
+
+	id, err := st.AddAlarm(storage.Alarm{Hour: 7, Minute: 0, Enabled: true, Days: storage.EveryDay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := SnoozePolicy{Enabled: true, Duration: 5 * time.Minute}
+	now := time.Now().Truncate(time.Second)
+
+	d.state.Ring(id, now.Add(-10*time.Minute))
+	d.state.Snooze(id, policy, now.Add(-10*time.Minute))
+	d.state.EndSnooze(now.Add(-5 * time.Minute))
+	snoozed, err := d.state.Snooze(id, policy, now)
+	if err != nil {
+		t.Fatalf("Snooze failed: %v", err)
+	}
+	d.persistAlarmState()
+	until := snoozed.To.SnoozeUntil
+
+	// The daemon restarts.
+	d = New(Options{Store: st})
+	h := newSchedulerHarness(time.Now(), scheduleInput{})
+	defer h.sched.Stop()
+	d.scheduler = h.sched
+
+	d.restoreAlarmState()
+
+	got := d.state.Status()
+	if got.State != StateSnoozed || got.AlarmID != id || !got.SnoozeUntil.Equal(until) || got.SnoozesUsed != 2 {
+		t.Errorf("Expected alarm %d snoozed until %v with 2 snoozes, got %+v", id, until, got)
+	}
+	next, ok := h.sched.Next()
+	if !ok || next.Kind != EventSnoozeEnd || !next.At.Equal(until) || next.Alarm.ID != id {
+		t.Errorf("Expected the snooze to be re-armed for %v, got %+v", until, next)
+	}
+}
+
+func TestPersistAlarmState_ClearedWhenStopped(t *testing.T) {
+	t.Parallel()
+	d := newTestDaemon(t)
+	st := d.store
+
+	d.state.Ring(4, time.Now())
+	d.persistAlarmState()
+	state, ok, err := st.GetAlarmState()
+	if err != nil || !ok || state.AlarmID != 4 || state.Snoozed {
+		t.Fatalf("Expected alarm 4 saved as ringing, got %+v ok=%v err=%v", state, ok, err)
+	}
+
+	d.state.Dismiss(time.Now())
+	d.persistAlarmState()
+	if _, ok, err := st.GetAlarmState(); err != nil || ok {
+		t.Errorf("Expected no saved state after stopping, got ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,510 @@
+package daemon
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"circadia/storage"
+)
+
+// Clock is the time source of the scheduler, replaced by a fake in tests.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is the part of *time.Timer the scheduler uses.
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// EventKind is what the scheduler wakes up for.
+type EventKind int
+
+const (
+	// EventRing is an alarm reaching its time.
+	EventRing EventKind = iota
+	// EventPreload opens the audio output shortly before an alarm, so it is ready when the alarm rings.
+	EventPreload
+	// EventSmartWake opens the smart wake window before an alarm, in which it may ring early
+	// during light sleep. Otherwise the alarm still rings at its time.
+	EventSmartWake
+	// EventSnoozeEnd is a snoozed alarm ringing again.
+	EventSnoozeEnd
+	// EventWindDown is the reminder half an hour before bedtime.
+	EventWindDown
+	// EventBedtime is the bedtime reminder.
+	EventBedtime
+	// EventKeepAwake is an alarm coming within the suspend inhibit horizon.
+	EventKeepAwake
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRing:
+		return "ring"
+	case EventPreload:
+		return "preload"
+	case EventSmartWake:
+		return "smart-wake"
+	case EventSnoozeEnd:
+		return "snooze-end"
+	case EventWindDown:
+		return "wind-down"
+	case EventBedtime:
+		return "bedtime"
+	case EventKeepAwake:
+		return "keep-awake"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// ScheduledEvent is one thing due at a point in time. Alarm is set for the alarm events.
+type ScheduledEvent struct {
+	Kind  EventKind
+	At    time.Time
+	Alarm storage.Alarm
+	// Occurrence is the ring time the event belongs to, for the events that lead up to an alarm.
+	Occurrence time.Time
+	// Late is how long after Occurrence the event fired, when the device was suspended
+	// or the clock jumped over it. It is zero for events that fired in time.
+	Late time.Duration
+}
+
+// key identifies the event across recomputations, so an event is never fired twice.
+func (e ScheduledEvent) key() string {
+	return fmt.Sprintf("%s:%d@%d", e.Kind, e.Alarm.ID, e.Occurrence.Unix())
+}
+
+const (
+	preloadLead       = 5 * time.Minute
+	windDownLead      = 30 * time.Minute
+	schedulerRetry    = time.Minute
+	maxSchedulerSleep = time.Minute
+)
+
+// preloadWindow is how long before an alarm the audio output is prepared. It covers
+// the alarm's smart wake window, because the alarm may ring as soon as it opens.
+func preloadWindow(smartWindow time.Duration) time.Duration {
+	return smartWindow + preloadLead
+}
+
+// preAlarmOver reports whether the run-up to an alarm should end without it ringing: the
+// alarm was deleted (nil) or disabled, or its next ring moved out of the preload window.
+// Without a pending ring the ring is already being handled, and ends the run-up itself.
+func preAlarmOver(alarm *storage.Alarm, ring *ScheduledEvent, window time.Duration, now time.Time) bool {
+	if alarm == nil || !alarm.Enabled {
+		return true
+	}
+	return ring != nil && ring.At.Sub(now) > window
+}
+
+// scheduleInput is everything the upcoming events depend on.
+type scheduleInput struct {
+	Alarms    []storage.Alarm
+	SmartWake bool
+	// SmartWakeWindow is the global smart wake window, which alarms may override.
+	SmartWakeWindow time.Duration
+	// Bedtime is "15:04", or empty when bedtime reminders are off.
+	Bedtime string
+	// InhibitHorizon is how long before an alarm suspend is inhibited, zero for never.
+	InhibitHorizon time.Duration
+}
+
+func loadScheduleInput(st *storage.Store) (scheduleInput, error) {
+	var in scheduleInput
+
+	alarms, err := st.GetAlarms()
+	if err != nil {
+		return in, err
+	}
+	in.Alarms = alarms
+	in.SmartWake, _ = st.GetSmartWakeUp()
+	window, _ := st.GetSmartWakeWindow()
+	in.SmartWakeWindow = time.Duration(window) * time.Minute
+
+	if notify, err := st.GetNotifyBedtime(); err == nil && notify {
+		in.Bedtime, _ = st.GetBedtime()
+	}
+
+	horizon, _ := st.GetSuspendInhibitHorizon()
+	in.InhibitHorizon = time.Duration(max(0, horizon)) * time.Minute
+	return in, nil
+}
+
+// smartWakeWindow is how long before its time an alarm may ring early, or zero when smart wake is off for it.
+func (in scheduleInput) smartWakeWindow(a storage.Alarm) time.Duration {
+	if !in.SmartWake {
+		return 0
+	}
+	if a.SmartWakeWindow != nil {
+		if *a.SmartWakeWindow <= 0 {
+			return 0
+		}
+		return time.Duration(storage.ClampSmartWakeWindow(*a.SmartWakeWindow)) * time.Minute
+	}
+	return in.SmartWakeWindow
+}
+
+// smartWakeWindowFor looks up the smart wake window of alarm in the current settings.
+func smartWakeWindowFor(st *storage.Store, alarm storage.Alarm) time.Duration {
+	in := scheduleInput{}
+	in.SmartWake, _ = st.GetSmartWakeUp()
+	window, _ := st.GetSmartWakeWindow()
+	in.SmartWakeWindow = time.Duration(window) * time.Minute
+	return in.smartWakeWindow(alarm)
+}
+
+// upcoming lists the next event of every kind after now, skipping those in fired.
+// Windows that are already open when they are first seen start at now.
+func upcoming(in scheduleInput, now time.Time, fired map[string]time.Time) []ScheduledEvent {
+	var events []ScheduledEvent
+	add := func(e ScheduledEvent) {
+		if _, done := fired[e.key()]; !done {
+			events = append(events, e)
+		}
+	}
+	after := now.Add(time.Nanosecond)
+
+	for _, a := range in.Alarms {
+		if !a.Enabled {
+			continue
+		}
+		occ, ok := NextOccurrence(a, after)
+		if !ok {
+			continue
+		}
+		window := in.smartWakeWindow(a)
+		add(ScheduledEvent{Kind: EventRing, At: occ, Alarm: a, Occurrence: occ})
+		add(ScheduledEvent{Kind: EventPreload, At: later(occ.Add(-preloadWindow(window)), now), Alarm: a, Occurrence: occ})
+		if window > 0 {
+			add(ScheduledEvent{Kind: EventSmartWake, At: later(occ.Add(-window), now), Alarm: a, Occurrence: occ})
+		}
+		if in.InhibitHorizon > 0 {
+			start := occ.Add(-window)
+			add(ScheduledEvent{Kind: EventKeepAwake, At: later(start.Add(-in.InhibitHorizon), now), Alarm: a, Occurrence: occ})
+		}
+	}
+
+	if in.Bedtime != "" {
+		bedtime, err := time.Parse("15:04", in.Bedtime)
+		if err != nil {
+			log.Printf("Invalid bedtime format: %v", err)
+		} else {
+			bed := nextTimeOfDay(bedtime.Hour(), bedtime.Minute(), after)
+			add(ScheduledEvent{Kind: EventBedtime, At: bed, Occurrence: bed})
+
+			windDown := nextTimeOfDay(bedtime.Hour(), bedtime.Minute(), after.Add(windDownLead)).Add(-windDownLead)
+			add(ScheduledEvent{Kind: EventWindDown, At: windDown, Occurrence: windDown})
+		}
+	}
+	return events
+}
+
+func later(t, u time.Time) time.Time {
+	if t.Before(u) {
+		return u
+	}
+	return t
+}
+
+// nextTimeOfDay returns the first hour:minute at or after from.
+func nextTimeOfDay(hour, minute int, from time.Time) time.Time {
+	t := time.Date(from.Year(), from.Month(), from.Day(), hour, minute, 0, 0, from.Location())
+	if t.Before(from) {
+		t = time.Date(from.Year(), from.Month(), from.Day()+1, hour, minute, 0, 0, from.Location())
+	}
+	return t
+}
+
+// Scheduler keeps a single timer armed for the next event and calls fire when events come due.
+// Call Reschedule whenever something the events depend on changes.
+type Scheduler struct {
+	clock Clock
+	load  func() (scheduleInput, error)
+	fire  func(ScheduledEvent)
+
+	mu      sync.Mutex
+	timer   Timer
+	pending []ScheduledEvent
+	// fired maps the keys of fired events to their occurrence.
+	fired   map[string]time.Time
+	snooze  *ScheduledEvent
+	stopped bool
+
+	onWake   func(time.Time)
+	lastWake time.Time
+}
+
+func NewScheduler(clock Clock, load func() (scheduleInput, error), fire func(ScheduledEvent)) *Scheduler {
+	return &Scheduler{
+		clock: clock,
+		load:  load,
+		fire:  fire,
+		fired: make(map[string]time.Time),
+	}
+}
+
+// Reschedule fires the events that have come due, reloads the inputs and arms the timer for the next event.
+func (s *Scheduler) Reschedule() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+
+	now := s.clock.Now()
+	var due []ScheduledEvent
+	s.prune(now)
+	for _, e := range s.pending {
+		if !e.At.After(now) {
+			due = append(due, s.markFired(e)...)
+		}
+	}
+	if s.snooze != nil && !s.snooze.At.After(now) {
+		due = append(due, *s.snooze)
+		s.snooze = nil
+	}
+
+	in, err := s.load()
+	if err != nil {
+		log.Printf("Scheduler: failed to load alarms: %v", err)
+		s.pending = nil
+		s.arm(now.Add(schedulerRetry), now)
+		s.mu.Unlock()
+		s.fireAll(due)
+		return
+	}
+
+	s.pending = s.pending[:0]
+	for _, e := range sortEvents(upcoming(in, now, s.fired)) {
+		if e.At.After(now) {
+			s.pending = append(s.pending, e)
+			continue
+		}
+		// A window that was already open when we first saw it.
+		due = append(due, s.markFired(e)...)
+	}
+	for i := range due {
+		due[i].Late = max(0, now.Sub(due[i].Occurrence))
+	}
+	sortEvents(due)
+
+	next := time.Time{}
+	for _, e := range s.pending {
+		if next.IsZero() || e.At.Before(next) {
+			next = e.At
+		}
+	}
+	if s.snooze != nil && (next.IsZero() || s.snooze.At.Before(next)) {
+		next = s.snooze.At
+	}
+	s.arm(next, now)
+	s.notifyWake()
+	s.mu.Unlock()
+
+	s.fireAll(due)
+}
+
+// OnWakeChanged sets f to be called with the time the device has to be awake for the next
+// alarm whenever that changes, or with the zero time when no alarm is scheduled. f is
+// called with the scheduler locked, so it must not block or call back into the scheduler.
+func (s *Scheduler) OnWakeChanged(f func(at time.Time)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onWake = f
+	s.lastWake = time.Time{}
+	s.notifyWake()
+}
+
+func (s *Scheduler) notifyWake() {
+	if s.onWake == nil {
+		return
+	}
+	wake := s.nextWake()
+	if wake.Equal(s.lastWake) {
+		return
+	}
+	s.lastWake = wake
+	s.onWake(wake)
+}
+
+// NextAlert returns when the next alarm, smart wake window or snoozed alarm starts.
+func (s *Scheduler) NextAlert() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, e := range s.pending {
+		if e.Kind != EventRing && e.Kind != EventSmartWake {
+			continue
+		}
+		if next.IsZero() || e.At.Before(next) {
+			next = e.At
+		}
+	}
+	if s.snooze != nil && (next.IsZero() || s.snooze.At.Before(next)) {
+		next = s.snooze.At
+	}
+	return next, !next.IsZero()
+}
+
+// nextWake returns the earliest pending event that needs the device awake: the
+// events leading up to an alarm and snoozes, but not reminders.
+func (s *Scheduler) nextWake() time.Time {
+	var wake time.Time
+	for _, e := range s.pending {
+		switch e.Kind {
+		case EventRing, EventPreload, EventSmartWake:
+			if wake.IsZero() || e.At.Before(wake) {
+				wake = e.At
+			}
+		}
+	}
+	if s.snooze != nil && (wake.IsZero() || s.snooze.At.Before(wake)) {
+		wake = s.snooze.At
+	}
+	return wake
+}
+
+// sortEvents orders events by time, then by kind, so that after a gap a smart wake
+// window opens before the ring that closes it.
+func sortEvents(events []ScheduledEvent) []ScheduledEvent {
+	slices.SortStableFunc(events, func(a, b ScheduledEvent) int {
+		if c := a.At.Compare(b.At); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Kind, b.Kind)
+	})
+	return events
+}
+
+// markFired records e as fired and returns it, or nothing if it already was.
+func (s *Scheduler) markFired(e ScheduledEvent) []ScheduledEvent {
+	if _, done := s.fired[e.key()]; done {
+		return nil
+	}
+	s.fired[e.key()] = e.Occurrence
+	return []ScheduledEvent{e}
+}
+
+func dropKey(events []ScheduledEvent, key string) []ScheduledEvent {
+	out := events[:0]
+	for _, e := range events {
+		if e.key() != key {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// arm sets the timer for next, or for nothing when next is zero. The wait is capped
+// so a suspend or a change of the wall clock is noticed soon after it happens.
+func (s *Scheduler) arm(next, now time.Time) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	wait := maxSchedulerSleep
+	if !next.IsZero() {
+		wait = min(next.Sub(now), maxSchedulerSleep)
+	}
+	s.timer = s.clock.AfterFunc(wait, s.Reschedule)
+}
+
+// prune forgets fired events whose occurrence has passed, since they cannot come back.
+func (s *Scheduler) prune(now time.Time) {
+	for key, occ := range s.fired {
+		if occ.Before(now) {
+			delete(s.fired, key)
+		}
+	}
+}
+
+func (s *Scheduler) fireAll(due []ScheduledEvent) {
+	for _, e := range due {
+		log.Printf("Scheduler: %s due at %s", e.Kind, e.At.Format("15:04:05"))
+		s.fire(e)
+	}
+}
+
+// Snooze makes the scheduler fire EventSnoozeEnd for alarm at until.
+func (s *Scheduler) Snooze(alarm storage.Alarm, until time.Time) {
+	s.mu.Lock()
+	s.snooze = &ScheduledEvent{Kind: EventSnoozeEnd, At: until, Alarm: alarm, Occurrence: until}
+	s.mu.Unlock()
+	s.Reschedule()
+}
+
+// CancelSnooze drops a pending EventSnoozeEnd.
+func (s *Scheduler) CancelSnooze() {
+	s.mu.Lock()
+	s.snooze = nil
+	s.mu.Unlock()
+	s.Reschedule()
+}
+
+// SkipRing drops the ring of an alarm occurrence that already rang early in its smart wake window.
+func (s *Scheduler) SkipRing(alarm storage.Alarm, occurrence time.Time) {
+	ring := ScheduledEvent{Kind: EventRing, Alarm: alarm, Occurrence: occurrence}
+	s.mu.Lock()
+	s.fired[ring.key()] = occurrence
+	s.pending = dropKey(s.pending, ring.key())
+	s.mu.Unlock()
+	s.Reschedule()
+}
+
+// Next returns the earliest pending event.
+func (s *Scheduler) Next() (ScheduledEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next ScheduledEvent
+	found := false
+	for _, e := range s.pending {
+		if !found || e.At.Before(next.At) {
+			next, found = e, true
+		}
+	}
+	if s.snooze != nil && (!found || s.snooze.At.Before(next.At)) {
+		next, found = *s.snooze, true
+	}
+	return next, found
+}
+
+// PendingRing returns the next pending ring of alarm id.
+func (s *Scheduler) PendingRing(id int64) (ScheduledEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ring ScheduledEvent
+	found := false
+	for _, e := range s.pending {
+		if e.Kind == EventRing && e.Alarm.ID == id && (!found || e.At.Before(ring.At)) {
+			ring, found = e, true
+		}
+	}
+	return ring, found
+}
+
+// Stop disarms the timer for good.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
@@ -0,0 +1,515 @@
+package daemon
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"circadia/storage"
+)
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	was := !t.stopped
+	t.stopped = true
+	return was
+}
+
+// fakeClock only moves when Advance is called, firing timers in order on the way.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if !t.stopped && !t.at.After(target) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		next.stopped = true
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.mu.Unlock()
+		next.f()
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// Jump moves the wall clock without firing anything, as a suspend or a clock change does.
+func (c *fakeClock) Jump(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// armed counts the timers that have not fired or been stopped.
+func (c *fakeClock) armed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if !t.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+type firedEvent struct {
+	Kind EventKind
+	At   string
+}
+
+type lateEvent struct {
+	Kind EventKind
+	Late time.Duration
+}
+
+type schedulerHarness struct {
+	clock *fakeClock
+	sched *Scheduler
+
+	mu    sync.Mutex
+	in    scheduleInput
+	fired []firedEvent
+	late  []lateEvent
+}
+
+func newSchedulerHarness(start time.Time, in scheduleInput) *schedulerHarness {
+	h := &schedulerHarness{clock: &fakeClock{now: start}, in: in}
+	h.sched = NewScheduler(h.clock, func() (scheduleInput, error) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.in, nil
+	}, func(e ScheduledEvent) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.fired = append(h.fired, firedEvent{e.Kind, h.clock.Now().Format("Mon 15:04")})
+		h.late = append(h.late, lateEvent{e.Kind, e.Late})
+	})
+	h.sched.Reschedule()
+	return h
+}
+
+func (h *schedulerHarness) setInput(in scheduleInput) {
+	h.mu.Lock()
+	h.in = in
+	h.mu.Unlock()
+	h.sched.Reschedule()
+}
+
+func (h *schedulerHarness) events() []firedEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]firedEvent(nil), h.fired...)
+}
+
+func checkFired(t *testing.T, got, want []firedEvent) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Event %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+// monday is Monday 2024-01-01 at the given time.
+func monday(hour, minute int) time.Time {
+	return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+}
+
+func intRef(n int) *int {
+	return &n
+}
+
+func TestScheduler_FiresEventsOnTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   time.Time
+		in      scheduleInput
+		advance time.Duration
+		want    []firedEvent
+	}{
+		{
+			name:    "rings at the exact minute",
+			start:   monday(6, 0),
+			in:      scheduleInput{Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}}},
+			advance: time.Hour,
+			want:    []firedEvent{{EventPreload, "Mon 06:25"}, {EventRing, "Mon 06:30"}},
+		},
+		{
+			name:    "disabled alarm stays silent",
+			start:   monday(6, 0),
+			in:      scheduleInput{Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 30, Days: storage.EveryDay}}},
+			advance: time.Hour,
+		},
+		{
+			name:    "smart wake opens a window and the alarm still rings at its time",
+			start:   monday(6, 0),
+			in:      scheduleInput{SmartWake: true, SmartWakeWindow: 30 * time.Minute, Alarms: []storage.Alarm{{ID: 1, Hour: 7, Minute: 0, Enabled: true, Days: storage.EveryDay}}},
+			advance: 2 * time.Hour,
+			want:    []firedEvent{{EventPreload, "Mon 06:25"}, {EventSmartWake, "Mon 06:30"}, {EventRing, "Mon 07:00"}},
+		},
+		{
+			name:    "window that is already open fires at once",
+			start:   monday(6, 0),
+			in:      scheduleInput{Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 3, Enabled: true, Days: storage.EveryDay}}},
+			advance: 10 * time.Minute,
+			want:    []firedEvent{{EventPreload, "Mon 06:00"}, {EventRing, "Mon 06:03"}},
+		},
+		{
+			name:  "earliest alarm first",
+			start: monday(6, 0),
+			in: scheduleInput{Alarms: []storage.Alarm{
+				{ID: 1, Hour: 8, Minute: 0, Enabled: true, Days: storage.EveryDay},
+				{ID: 2, Hour: 7, Minute: 0, Enabled: true, Days: storage.EveryDay},
+			}},
+			advance: 3 * time.Hour,
+			want: []firedEvent{
+				{EventPreload, "Mon 06:55"}, {EventRing, "Mon 07:00"},
+				{EventPreload, "Mon 07:55"}, {EventRing, "Mon 08:00"},
+			},
+		},
+		{
+			name:    "one-shot alarm earlier in the day rings tomorrow",
+			start:   monday(6, 0),
+			in:      scheduleInput{Alarms: []storage.Alarm{{ID: 1, Hour: 5, Minute: 0, Enabled: true}}},
+			advance: 24 * time.Hour,
+			want:    []firedEvent{{EventPreload, "Tue 04:55"}, {EventRing, "Tue 05:00"}},
+		},
+		{
+			name:    "weekday alarm skips the weekend",
+			start:   time.Date(2024, 1, 5, 7, 0, 0, 0, time.UTC),
+			in:      scheduleInput{Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.WorkWeek}}},
+			advance: 72 * time.Hour,
+			want:    []firedEvent{{EventPreload, "Mon 06:25"}, {EventRing, "Mon 06:30"}},
+		},
+		{
+			name:    "suspend is inhibited ahead of the alarm",
+			start:   monday(6, 0),
+			in:      scheduleInput{InhibitHorizon: 15 * time.Minute, Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}}},
+			advance: time.Hour,
+			want:    []firedEvent{{EventKeepAwake, "Mon 06:15"}, {EventPreload, "Mon 06:25"}, {EventRing, "Mon 06:30"}},
+		},
+		{
+			name:    "shorter smart wake window",
+			start:   monday(6, 0),
+			in:      scheduleInput{SmartWake: true, SmartWakeWindow: 10 * time.Minute, Alarms: []storage.Alarm{{ID: 1, Hour: 7, Minute: 0, Enabled: true, Days: storage.EveryDay}}},
+			advance: 2 * time.Hour,
+			want:    []firedEvent{{EventPreload, "Mon 06:45"}, {EventSmartWake, "Mon 06:50"}, {EventRing, "Mon 07:00"}},
+		},
+		{
+			name:  "alarms override the smart wake window",
+			start: monday(6, 0),
+			in: scheduleInput{SmartWake: true, SmartWakeWindow: 30 * time.Minute, Alarms: []storage.Alarm{
+				{ID: 1, Hour: 7, Minute: 0, Enabled: true, Days: storage.EveryDay, SmartWakeWindow: intRef(45)},
+				{ID: 2, Hour: 8, Minute: 0, Enabled: true, Days: storage.EveryDay, SmartWakeWindow: intRef(0)},
+			}},
+			advance: 2*time.Hour + 30*time.Minute,
+			want: []firedEvent{
+				{EventPreload, "Mon 06:10"}, {EventSmartWake, "Mon 06:15"}, {EventRing, "Mon 07:00"},
+				{EventPreload, "Mon 07:55"}, {EventRing, "Mon 08:00"},
+			},
+		},
+		{
+			name:    "alarm windows need smart wake switched on",
+			start:   monday(6, 0),
+			in:      scheduleInput{SmartWakeWindow: 30 * time.Minute, Alarms: []storage.Alarm{{ID: 1, Hour: 7, Minute: 0, Enabled: true, Days: storage.EveryDay, SmartWakeWindow: intRef(20)}}},
+			advance: 2 * time.Hour,
+			want:    []firedEvent{{EventPreload, "Mon 06:55"}, {EventRing, "Mon 07:00"}},
+		},
+		{
+			name:    "inhibit horizon counts from the smart wake window",
+			start:   monday(5, 0),
+			in:      scheduleInput{SmartWake: true, SmartWakeWindow: 30 * time.Minute, InhibitHorizon: 15 * time.Minute, Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}}},
+			advance: 2 * time.Hour,
+			want:    []firedEvent{{EventKeepAwake, "Mon 05:45"}, {EventPreload, "Mon 05:55"}, {EventSmartWake, "Mon 06:00"}, {EventRing, "Mon 06:30"}},
+		},
+		{
+			name:    "bedtime reminders",
+			start:   monday(21, 0),
+			in:      scheduleInput{Bedtime: "22:00"},
+			advance: 2 * time.Hour,
+			want:    []firedEvent{{EventWindDown, "Mon 21:30"}, {EventBedtime, "Mon 22:00"}},
+		},
+		{
+			name:    "wind down is still ahead after bedtime",
+			start:   monday(21, 45),
+			in:      scheduleInput{Bedtime: "22:00"},
+			advance: 24 * time.Hour,
+			want:    []firedEvent{{EventBedtime, "Mon 22:00"}, {EventWindDown, "Tue 21:30"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newSchedulerHarness(tt.start, tt.in)
+			defer h.sched.Stop()
+
+			h.clock.Advance(tt.advance)
+			checkFired(t, h.events(), tt.want)
+
+			if n := h.clock.armed(); n != 1 {
+				t.Errorf("Expected a single armed timer, got %d", n)
+			}
+		})
+	}
+}
+
+func TestScheduler_RecomputesOnChange(t *testing.T) {
+	alarm := storage.Alarm{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}
+	h := newSchedulerHarness(monday(6, 0), scheduleInput{Alarms: []storage.Alarm{alarm}})
+	defer h.sched.Stop()
+
+	h.clock.Advance(10 * time.Minute)
+
+	alarm.Minute = 15
+	h.setInput(scheduleInput{Alarms: []storage.Alarm{alarm}})
+	checkFired(t, h.events(), []firedEvent{{EventPreload, "Mon 06:10"}})
+	if next, ok := h.sched.Next(); !ok || next.Kind != EventRing || !next.At.Equal(monday(6, 15)) {
+		t.Errorf("Expected the ring at 06:15 to be next, got %v at %v", next.Kind, next.At)
+	}
+
+	h.clock.Advance(30 * time.Minute)
+	checkFired(t, h.events(), []firedEvent{{EventPreload, "Mon 06:10"}, {EventRing, "Mon 06:15"}})
+
+	// An alarm added for a time that has just passed waits for tomorrow.
+	h.setInput(scheduleInput{Alarms: []storage.Alarm{{ID: 2, Hour: 6, Minute: 35, Enabled: true}}})
+	if next, ok := h.sched.Next(); !ok || !next.Occurrence.Equal(monday(6, 35).AddDate(0, 0, 1)) {
+		t.Errorf("Expected the next event to belong to tomorrow's ring, got %v", next.Occurrence)
+	}
+}
+
+func TestScheduler_Snooze(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel bool
+		want   []firedEvent
+	}{
+		{name: "rings again when the snooze is over", want: []firedEvent{{EventSnoozeEnd, "Mon 06:40"}}},
+		{name: "cancelled snooze stays silent", cancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newSchedulerHarness(monday(6, 30), scheduleInput{})
+			defer h.sched.Stop()
+
+			h.sched.Snooze(storage.Alarm{ID: 1, Hour: 6, Minute: 30}, monday(6, 40))
+			h.clock.Advance(5 * time.Minute)
+			if tt.cancel {
+				h.sched.CancelSnooze()
+			}
+			h.clock.Advance(time.Hour)
+
+			checkFired(t, h.events(), tt.want)
+		})
+	}
+}
+
+func TestScheduler_SkipRing(t *testing.T) {
+	alarm := storage.Alarm{ID: 1, Hour: 7, Minute: 0, Enabled: true, Days: storage.EveryDay}
+	h := newSchedulerHarness(monday(6, 0), scheduleInput{SmartWake: true, SmartWakeWindow: 30 * time.Minute, Alarms: []storage.Alarm{alarm}})
+	defer h.sched.Stop()
+
+	h.clock.Advance(40 * time.Minute)
+	h.sched.SkipRing(alarm, monday(7, 0))
+	h.clock.Advance(time.Hour)
+
+	// Tomorrow's occurrence is untouched.
+	h.clock.Advance(24 * time.Hour)
+	checkFired(t, h.events(), []firedEvent{
+		{EventPreload, "Mon 06:25"}, {EventSmartWake, "Mon 06:30"},
+		{EventPreload, "Tue 06:25"}, {EventSmartWake, "Tue 06:30"}, {EventRing, "Tue 07:00"},
+	})
+}
+
+func TestScheduler_PendingRing(t *testing.T) {
+	alarm := storage.Alarm{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}
+	h := newSchedulerHarness(monday(6, 0), scheduleInput{Alarms: []storage.Alarm{alarm}})
+	defer h.sched.Stop()
+
+	h.clock.Advance(10 * time.Minute)
+	if ring, ok := h.sched.PendingRing(1); !ok || !ring.At.Equal(monday(6, 30)) {
+		t.Errorf("Expected the ring at 06:30 to be pending, got %v", ring.At)
+	}
+	if _, ok := h.sched.PendingRing(2); ok {
+		t.Error("Expected no pending ring for an unknown alarm")
+	}
+
+	// Moved past the preload window, the run-up that already started is over.
+	alarm.Hour = 9
+	h.setInput(scheduleInput{Alarms: []storage.Alarm{alarm}})
+	ring, ok := h.sched.PendingRing(1)
+	if !ok || !preAlarmOver(&alarm, &ring, preloadWindow(0), monday(6, 10)) {
+		t.Errorf("Expected the moved alarm to end the run-up, got ring at %v", ring.At)
+	}
+}
+
+func TestPreAlarmOver(t *testing.T) {
+	now := monday(6, 28)
+	alarm := storage.Alarm{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}
+	disabled := alarm
+	disabled.Enabled = false
+	soon := ScheduledEvent{Kind: EventRing, Alarm: alarm, At: monday(6, 30)}
+	later := ScheduledEvent{Kind: EventRing, Alarm: alarm, At: monday(8, 0)}
+
+	tests := []struct {
+		name  string
+		alarm *storage.Alarm
+		ring  *ScheduledEvent
+		want  bool
+	}{
+		{"deleted", nil, nil, true},
+		{"disabled", &disabled, &soon, true},
+		{"moved out of the window", &alarm, &later, true},
+		{"still approaching", &alarm, &soon, false},
+		{"ring being handled", &alarm, nil, false},
+	}
+	for _, tt := range tests {
+		if got := preAlarmOver(tt.alarm, tt.ring, preloadWindow(0), now); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestScheduler_StopDisarms(t *testing.T) {
+	h := newSchedulerHarness(monday(6, 0), scheduleInput{Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}}})
+	h.sched.Stop()
+
+	h.clock.Advance(time.Hour)
+	checkFired(t, h.events(), nil)
+	if n := h.clock.armed(); n != 0 {
+		t.Errorf("Expected no armed timers after Stop, got %d", n)
+	}
+}
+
+func TestScheduler_DetectsGaps(t *testing.T) {
+	alarm := storage.Alarm{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}
+
+	tests := []struct {
+		name string
+		in   scheduleInput
+		jump time.Duration
+		want []lateEvent
+	}{
+		{
+			name: "clock jumps onto the alarm minute",
+			in:   scheduleInput{Alarms: []storage.Alarm{alarm}},
+			jump: 30 * time.Minute,
+			want: []lateEvent{{EventPreload, 0}, {EventRing, 0}},
+		},
+		{
+			name: "suspended across the alarm",
+			in:   scheduleInput{Alarms: []storage.Alarm{alarm}},
+			jump: 40 * time.Minute,
+			want: []lateEvent{{EventPreload, 10 * time.Minute}, {EventRing, 10 * time.Minute}},
+		},
+		{
+			name: "suspended across the whole smart wake window",
+			in:   scheduleInput{SmartWake: true, SmartWakeWindow: 30 * time.Minute, Alarms: []storage.Alarm{{ID: 1, Hour: 7, Minute: 30, Enabled: true, Days: storage.EveryDay}}},
+			jump: 2 * time.Hour,
+			want: []lateEvent{{EventPreload, 30 * time.Minute}, {EventSmartWake, 30 * time.Minute}, {EventRing, 30 * time.Minute}},
+		},
+		{
+			name: "resumed inside the smart wake window",
+			in:   scheduleInput{SmartWake: true, SmartWakeWindow: 30 * time.Minute, Alarms: []storage.Alarm{{ID: 1, Hour: 7, Minute: 30, Enabled: true, Days: storage.EveryDay}}},
+			jump: 75 * time.Minute,
+			want: []lateEvent{{EventPreload, 0}, {EventSmartWake, 0}},
+		},
+		{
+			name: "suspended across bedtime",
+			in:   scheduleInput{Bedtime: "06:20"},
+			jump: 3 * time.Hour,
+			want: []lateEvent{{EventBedtime, 2*time.Hour + 40*time.Minute}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newSchedulerHarness(monday(6, 0), tt.in)
+			defer h.sched.Stop()
+
+			h.clock.Jump(tt.jump)
+			// The capped timer fires right after resume.
+			h.clock.Advance(time.Minute)
+
+			h.mu.Lock()
+			got := append([]lateEvent(nil), h.late...)
+			h.mu.Unlock()
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Event %d: expected %v, got %v", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScheduler_ReportsWakeTime(t *testing.T) {
+	h := newSchedulerHarness(monday(6, 0), scheduleInput{Bedtime: "22:00"})
+	defer h.sched.Stop()
+
+	var wakes []time.Time
+	h.sched.OnWakeChanged(func(at time.Time) {
+		wakes = append(wakes, at)
+	})
+	if len(wakes) != 0 {
+		t.Fatalf("Expected reminders not to need a wake-up, got %v", wakes)
+	}
+
+	h.setInput(scheduleInput{Alarms: []storage.Alarm{{ID: 1, Hour: 6, Minute: 30, Enabled: true, Days: storage.EveryDay}}})
+	h.clock.Advance(26 * time.Minute)
+	h.setInput(scheduleInput{})
+
+	want := []time.Time{monday(6, 25), monday(6, 30), {}}
+	if len(wakes) != len(want) {
+		t.Fatalf("Expected wake-ups %v, got %v", want, wakes)
+	}
+	for i := range want {
+		if !wakes[i].Equal(want[i]) {
+			t.Errorf("Wake-up %d: expected %v, got %v", i, want[i], wakes[i])
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"circadia/internal/ipc"
+	"circadia/storage"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// newIPCServer wires the socket commands to the daemon. Handlers that touch
+// the UI hop onto the main loop.
+func (d *Daemon) newIPCServer() *ipc.Server {
+	s := ipc.NewServer()
+
+	s.Handle(ipc.CmdBedtimeChanged, func(json.RawMessage) (any, error) {
+		d.reschedule()
+		return nil, nil
+	})
+
+	s.Handle(ipc.CmdBedtimeNotificationsChanged, func(json.RawMessage) (any, error) {
+		d.reschedule()
+		return nil, nil
+	})
+
+	s.Handle(ipc.CmdAlarmTriggered, func(raw json.RawMessage) (any, error) {
+		var args ipc.AlarmTriggeredArgs
+		if err := ipc.DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+		if OnAlarmTriggered != nil {
+			glib.IdleAdd(func() {
+				OnAlarmTriggered(args.Hour, args.Minute, args.Label)
+			})
+		}
+		return nil, nil
+	})
+
+	setSleepMode := func(raw json.RawMessage) (any, error) {
+		var args ipc.EnabledArgs
+		if err := ipc.DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+		return onMainLoop(func() (any, error) {
+			d.applySleepMode(args.Enabled)
+			return nil, nil
+		})
+	}
+	s.Handle(ipc.CmdSetSleepMode, setSleepMode)
+	s.Handle(ipc.CmdSleepModeChanged, setSleepMode)
+
+	s.Handle(ipc.CmdSmartWakeUpToggled, func(raw json.RawMessage) (any, error) {
+		var args ipc.EnabledArgs
+		if err := ipc.DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+		if OnSmartWakeUpToggled != nil {
+			glib.IdleAdd(func() {
+				OnSmartWakeUpToggled(args.Enabled)
+			})
+		}
+		d.reschedule()
+		return nil, nil
+	})
+
+	s.Handle(ipc.CmdListAlarms, func(json.RawMessage) (any, error) {
+		alarms, err := d.store.GetAlarms()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		infos := make([]ipc.AlarmInfo, 0, len(alarms))
+		for _, a := range alarms {
+			infos = append(infos, alarmInfo(a, now))
+		}
+		return infos, nil
+	})
+
+	s.Handle(ipc.CmdAddAlarm, func(raw json.RawMessage) (any, error) {
+		var args ipc.AddAlarmArgs
+		if err := ipc.DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+		if args.Hour < 0 || args.Hour > 23 || args.Minute < 0 || args.Minute > 59 {
+			return nil, ipc.Errorf(ipc.ErrInvalidArgs, "invalid time %d:%02d", args.Hour, args.Minute)
+		}
+
+		alarm := storage.Alarm{
+			Hour:    args.Hour,
+			Minute:  args.Minute,
+			Enabled: true,
+			Label:   args.Label,
+			Days:    storage.EveryDay,
+		}
+		id, err := d.store.AddAlarm(alarm)
+		if err != nil {
+			return nil, err
+		}
+		alarm.ID = id
+		notifyAlarmsChanged()
+		return alarmInfo(alarm, time.Now()), nil
+	})
+
+	s.Handle(ipc.CmdSetAlarmEnabled, func(raw json.RawMessage) (any, error) {
+		var args ipc.SetAlarmEnabledArgs
+		if err := ipc.DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+
+		alarm, err := d.store.GetAlarm(args.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ipc.Errorf(ipc.ErrNotFound, "no alarm with ID %d", args.ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := d.store.ToggleAlarm(args.ID, args.Enabled); err != nil {
+			return nil, err
+		}
+		alarm.Enabled = args.Enabled
+		notifyAlarmsChanged()
+		return alarmInfo(alarm, time.Now()), nil
+	})
+
+	s.Handle(ipc.CmdSnooze, func(json.RawMessage) (any, error) {
+		return onMainLoop(func() (any, error) {
+			if err := d.SnoozeAlarm(); err != nil {
+				return nil, ipc.Errorf(ipc.ErrRefused, "%v", err)
+			}
+			return ipc.SnoozeReply{Until: d.state.Status().SnoozeUntil}, nil
+		})
+	})
+
+	s.Handle(ipc.CmdStop, func(json.RawMessage) (any, error) {
+		return onMainLoop(func() (any, error) {
+			if !d.state.Status().Alerting() {
+				return nil, ipc.Errorf(ipc.ErrRefused, "%v", ErrNotRinging)
+			}
+			d.StopAlarm()
+			return nil, nil
+		})
+	})
+
+	s.Handle(ipc.CmdStatus, func(json.RawMessage) (any, error) {
+		return onMainLoop(func() (any, error) {
+			return d.status(time.Now())
+		})
+	})
+
+	s.Handle(ipc.CmdExportBackup, func(json.RawMessage) (any, error) {
+		var buf bytes.Buffer
+		if err := d.store.Export(&buf); err != nil {
+			return nil, err
+		}
+		return json.RawMessage(buf.Bytes()), nil
+	})
+
+	s.Handle(ipc.CmdImportBackup, func(raw json.RawMessage) (any, error) {
+		var args ipc.ImportBackupArgs
+		if err := ipc.DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+		mode := storage.ImportMode(args.Mode)
+		if mode != storage.ImportMerge && mode != storage.ImportReplace {
+			return nil, ipc.Errorf(ipc.ErrInvalidArgs, "unknown import mode %q", args.Mode)
+		}
+
+		result, err := d.ImportBackup(bytes.NewReader(args.Backup), mode)
+		if errors.Is(err, storage.ErrInvalidBackup) {
+			return nil, ipc.Errorf(ipc.ErrInvalidArgs, "%v", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ipc.ImportBackupReply{Alarms: result.Alarms, Settings: result.Settings, SleepSessions: result.SleepSessions}, nil
+	})
+
+	return s
+}
+
+// onMainLoop runs f on the GLib main loop, where the daemon state lives, and waits for its result.
+func onMainLoop(f func() (any, error)) (any, error) {
+	type result struct {
+		value any
+		err   error
+	}
+	done := make(chan result, 1)
+	glib.IdleAdd(func() {
+		v, err := f()
+		done <- result{v, err}
+	})
+	r := <-done
+	return r.value, r.err
+}
+
+func notifyAlarmsChanged() {
+	if OnAlarmsChanged != nil {
+		glib.IdleAdd(func() {
+			OnAlarmsChanged()
+		})
+	}
+}
+
+func alarmInfo(a storage.Alarm, now time.Time) ipc.AlarmInfo {
+	info := ipc.AlarmInfo{
+		ID:      a.ID,
+		Hour:    a.Hour,
+		Minute:  a.Minute,
+		Enabled: a.Enabled,
+		Label:   a.Label,
+		Repeat:  a.Days.String(),
+	}
+	if a.IsDated() {
+		info.Repeat = a.Date.Format(storage.DateLayout)
+	}
+	if a.Enabled {
+		if next, ok := NextOccurrence(a, now); ok {
+			info.Next = &next
+		}
+	}
+	return info
+}
+
+func (d *Daemon) status(now time.Time) (ipc.StatusReply, error) {
+	var reply ipc.StatusReply
+
+	if alarm, ok := d.RingingAlarm(); ok {
+		info := alarmInfo(alarm, now)
+		reply.Ringing = &info
+	}
+	if s := d.state.Status(); s.State == StateSnoozed {
+		if alarm, err := d.store.GetAlarm(s.AlarmID); err == nil {
+			info := alarmInfo(alarm, now)
+			reply.Snoozed = &info
+		}
+		until := s.SnoozeUntil
+		reply.SnoozeUntil = &until
+	}
+
+	if start, err := d.store.GetSleepStartTime(); err == nil && !start.IsZero() {
+		reply.SleepMode = true
+		reply.SleepStart = &start
+	}
+
+	alarms, err := d.store.GetAlarms()
+	if err != nil {
+		return reply, err
+	}
+	if next, _, ok := NextAlarm(alarms, now); ok {
+		info := alarmInfo(next, now)
+		reply.NextAlarm = &info
+	}
+	return reply, nil
+}
+
+func signalAlarmTriggered(alarm storage.Alarm) error {
+	return ipc.Call(ipc.CmdAlarmTriggered, ipc.AlarmTriggeredArgs{
+		Hour:   alarm.Hour,
+		Minute: alarm.Minute,
+		Label:  alarm.Label,
+	}, nil)
+}
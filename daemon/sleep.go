@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"log"
+	"time"
+
+	"circadia/internal/ipc"
+)
+
+// applySleepMode starts or ends the sleep session, then lets the window follow.
+func (d *Daemon) applySleepMode(enabled bool) {
+	log.Printf("Sleep Mode: %v", enabled)
+	if enabled {
+		if !d.IsSleepModeEnabled() {
+			start := time.Now()
+			if err := d.store.SetSleepStartTime(start); err != nil {
+				log.Printf("Failed to set sleep start time: %v", err)
+			}
+			d.sessionSnoozes = 0
+			d.publish(ipc.EventSleepStarted, ipc.SleepEvent{Start: start})
+		}
+		d.startPhaseMonitor()
+	} else {
+		d.endSleepSession(false)
+	}
+
+	if OnSleepModeChanged != nil {
+		OnSleepModeChanged(enabled)
+	}
+}
+
+// endSleepSession saves the running sleep session, if any. bypassDurationCheck keeps
+// short sessions too, as when the user stops the alarm.
+func (d *Daemon) endSleepSession(bypassDurationCheck bool) {
+	d.stopPhaseMonitor()
+
+	startTime, err := d.store.GetSleepStartTime()
+	if err == nil && !startTime.IsZero() {
+		endTime := time.Now()
+		if err := d.FinalizeSleepSession(startTime, endTime, d.sessionSnoozes, bypassDurationCheck); err != nil {
+			log.Printf("Error finalizing sleep session: %v", err)
+		}
+		d.publish(ipc.EventSleepEnded, ipc.SleepEvent{Start: startTime, End: &endTime})
+	}
+
+	if err := d.store.ClearSleepStartTime(); err != nil {
+		log.Printf("Failed to clear sleep start time: %v", err)
+	}
+	d.sessionSnoozes = 0
+}
@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"log"
+	"time"
+
+	"circadia/internal/sleepphase"
+)
+
+// accelerometerRoot is where the sleep phase monitor looks for an accelerometer.
+var accelerometerRoot = sleepphase.DefaultIIORoot
+
+func (d *Daemon) startPhaseMonitor() {
+	if d.phaseMonitor != nil {
+		return
+	}
+	src, err := sleepphase.FindIIO(accelerometerRoot)
+	if err != nil {
+		log.Printf("Sleep phase detection unavailable: %v", err)
+		return
+	}
+	d.phaseMonitor = sleepphase.StartMonitor(src, sleepphase.NewEstimator(), sleepphase.DefaultInterval, d.onPhaseEpoch)
+	log.Printf("Sleep phase detection started on %s", src.Dir)
+}
+
+func (d *Daemon) stopPhaseMonitor() {
+	if d.phaseMonitor == nil {
+		return
+	}
+	d.phaseMonitor.Stop()
+	d.phaseMonitor = nil
+}
+
+// currentPhase returns the latest estimate, or PhaseUnknown when movement is not being sampled.
+func (d *Daemon) currentPhase() sleepphase.Phase {
+	if d.phaseMonitor == nil {
+		return sleepphase.PhaseUnknown
+	}
+	return d.phaseMonitor.Phase()
+}
+
+// closeSmartWindow closes the window of alarmID once its alarm rings at its own time.
+func (d *Daemon) closeSmartWindow(alarmID int64) {
+	if d.smartWindow != nil && d.smartWindow.Alarm.ID == alarmID {
+		d.smartWindow = nil
+	}
+}
+
+// ringEarly reports whether the alarm of an open smart wake window should ring now:
+// only during light sleep, before its set time and while nothing else rings.
+func ringEarly(window *ScheduledEvent, phase sleepphase.Phase, ringing bool, now time.Time) bool {
+	if window == nil || ringing {
+		return false
+	}
+	return phase == sleepphase.PhaseLight && now.Before(window.Occurrence)
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"circadia/internal/sleepphase"
+	"circadia/storage"
+)
+
+func TestRingEarly(t *testing.T) {
+	window := &ScheduledEvent{
+		Kind:       EventSmartWake,
+		At:         monday(6, 30),
+		Alarm:      storage.Alarm{ID: 1, Hour: 7, Minute: 0},
+		Occurrence: monday(7, 0),
+	}
+
+	tests := []struct {
+		name    string
+		window  *ScheduledEvent
+		phase   sleepphase.Phase
+		ringing bool
+		now     time.Time
+		want    bool
+	}{
+		{"light sleep in the window", window, sleepphase.PhaseLight, false, monday(6, 40), true},
+		{"deep sleep waits for the set time", window, sleepphase.PhaseDeep, false, monday(6, 40), false},
+		{"no estimate waits for the set time", window, sleepphase.PhaseUnknown, false, monday(6, 40), false},
+		{"no window open", nil, sleepphase.PhaseLight, false, monday(6, 40), false},
+		{"another alarm is ringing", window, sleepphase.PhaseLight, true, monday(6, 40), false},
+		{"set time reached", window, sleepphase.PhaseLight, false, monday(7, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ringEarly(tt.window, tt.phase, tt.ringing, tt.now); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestRingEarly_Recordings runs recorded nights through the estimator the way the
+// daemon does and checks when a 07:00 alarm with a smart wake window would ring.
+func TestRingEarly_Recordings(t *testing.T) {
+	window := &ScheduledEvent{
+		Kind:       EventSmartWake,
+		At:         monday(6, 30),
+		Alarm:      storage.Alarm{ID: 1, Hour: 7, Minute: 0},
+		Occurrence: monday(7, 0),
+	}
+
+	tests := []struct {
+		file string
+		// want is when the alarm rings early, or zero when it waits for 07:00.
+		want time.Time
+	}{
+		{"deep.csv", time.Time{}},
+		// Turning over starts at 06:55 and the score crosses the threshold after the first restless epoch.
+		{"light.csv", monday(6, 56)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			rec, err := sleepphase.LoadRecording("../internal/sleepphase/testdata/"+tt.file, monday(6, 40))
+			if err != nil {
+				t.Fatal(err)
+			}
+			est := sleepphase.NewEstimator()
+
+			var rang time.Time
+			for {
+				s, err := rec.Read()
+				if err != nil {
+					break
+				}
+				if est.Add(s) && ringEarly(window, est.Phase(), false, s.Time) {
+					rang = s.Time
+					break
+				}
+			}
+			if !rang.Equal(tt.want) {
+				t.Errorf("Expected early ring at %v, got %v", tt.want, rang)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"errors"
+	"time"
+
+	"circadia/storage"
+)
+
+var (
+	ErrNotRinging         = errors.New("no alarm is ringing")
+	ErrSnoozeDisabled     = errors.New("snooze is disabled for this alarm")
+	ErrSnoozeLimitReached = errors.New("snooze limit reached, the alarm has to be stopped")
+)
+
+// SnoozePolicy is the effective snooze behaviour of an alarm after applying its overrides to the global settings.
+type SnoozePolicy struct {
+	Enabled  bool
+	Duration time.Duration
+	// MaxCount is the number of snoozes allowed per ring. Zero means unlimited.
+	MaxCount int
+}
+
+func snoozePolicy(st *storage.Store, alarm storage.Alarm) SnoozePolicy {
+	enabled, err := st.GetSnoozeEnabled()
+	if err != nil {
+		enabled = true
+	}
+	durationMin, err := st.GetSnoozeDuration()
+	if err != nil {
+		durationMin = 15
+	}
+
+	if alarm.SnoozeEnabled != nil {
+		enabled = *alarm.SnoozeEnabled
+	}
+	if alarm.SnoozeDuration != nil && *alarm.SnoozeDuration > 0 {
+		durationMin = *alarm.SnoozeDuration
+	}
+
+	return SnoozePolicy{
+		Enabled:  enabled,
+		Duration: time.Duration(durationMin) * time.Minute,
+		MaxCount: alarm.SnoozeMax,
+	}
+}
+
+// check reports why the alarm cannot be snoozed again after used snoozes, if it cannot.
+func (p SnoozePolicy) check(used int) error {
+	if !p.Enabled {
+		return ErrSnoozeDisabled
+	}
+	if p.MaxCount > 0 && used >= p.MaxCount {
+		return ErrSnoozeLimitReached
+	}
+	return nil
+}
+
+// CanSnooze returns the snooze policy of the ringing alarm and an error if snoozing is not allowed right now.
+func (d *Daemon) CanSnooze() (SnoozePolicy, error) {
+	alarm, _ := d.RingingAlarm()
+	policy := snoozePolicy(d.store, alarm)
+	return policy, policy.check(d.state.Status().SnoozesUsed)
+}
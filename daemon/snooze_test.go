@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"circadia/storage"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnoozePolicy_Overrides(t *testing.T) {
+	t.Parallel()
+	st := storage.NewMemoryStore()
+	st.SetSnoozeEnabled(true)
+	st.SetSnoozeDuration(10)
+
+	policy := snoozePolicy(st, storage.Alarm{})
+	if !policy.Enabled || policy.Duration != 10*time.Minute || policy.MaxCount != 0 {
+		t.Errorf("Expected global policy, got %+v", policy)
+	}
+
+	off := false
+	five := 5
+	policy = snoozePolicy(st, storage.Alarm{SnoozeEnabled: &off, SnoozeDuration: &five, SnoozeMax: 2})
+	if policy.Enabled || policy.Duration != 5*time.Minute || policy.MaxCount != 2 {
+		t.Errorf("Expected overridden policy, got %+v", policy)
+	}
+}
+
+func TestSnoozePolicy_Check(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SnoozePolicy
+		used   int
+		want   error
+	}{
+		{"unlimited", SnoozePolicy{Enabled: true}, 10, nil},
+		{"below limit", SnoozePolicy{Enabled: true, MaxCount: 2}, 1, nil},
+		{"limit reached", SnoozePolicy{Enabled: true, MaxCount: 2}, 2, ErrSnoozeLimitReached},
+		{"disabled", SnoozePolicy{Enabled: false}, 0, ErrSnoozeDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.check(tt.used); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -7,28 +7,30 @@ import (
 )
 
 func TestIsSleepModeEnabled(t *testing.T) {
-	storage.InitDB(":memory:")
+	t.Parallel()
+	d := newTestDaemon(t)
+	st := d.store
 
 	// Initially false
-	if IsSleepModeEnabled() {
+	if d.IsSleepModeEnabled() {
 		t.Error("Expected Sleep Mode to be disabled initially")
 	}
 
 	// Set Start Time
-	storage.SetSleepStartTime(time.Now())
-	if !IsSleepModeEnabled() {
+	st.SetSleepStartTime(time.Now())
+	if !d.IsSleepModeEnabled() {
 		t.Error("Expected Sleep Mode to be enabled after setting start time")
 	}
 
 	// Clear Start Time
-	storage.ClearSleepStartTime()
-	if IsSleepModeEnabled() {
+	st.ClearSleepStartTime()
+	if d.IsSleepModeEnabled() {
 		t.Error("Expected Sleep Mode to be disabled after clearing")
 	}
 }
 
 func TestOnSleepSessionSavedCallback(t *testing.T) {
-	storage.InitDB(":memory:")
+	d := New(Options{Store: storage.NewMemoryStore()})
 
 	callbackCalled := false
 	OnSleepSessionSaved = func() {
@@ -38,7 +40,7 @@ func TestOnSleepSessionSavedCallback(t *testing.T) {
 	// Case 1: Short duration, no force -> Should NOT call callback
 	start := time.Now()
 	end := start.Add(30 * time.Minute)
-	FinalizeSleepSession(start, end, 0, false)
+	d.FinalizeSleepSession(start, end, 0, false)
 
 	if callbackCalled {
 		t.Error("Callback should not be called for short session without force")
@@ -46,7 +48,7 @@ func TestOnSleepSessionSavedCallback(t *testing.T) {
 
 	// Case 2: Short duration, WITH force -> Should call callback
 	callbackCalled = false // Reset
-	FinalizeSleepSession(start, end, 0, true)
+	d.FinalizeSleepSession(start, end, 0, true)
 
 	// Wait for IdleAdd? Tests run in same process, but IdleAdd might behave differently.
 	// The IdleAdd in the code is for GTK thread.
@@ -0,0 +1,260 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// AlarmState is where the daemon is in the life of an alarm.
+type AlarmState int
+
+const (
+	StateIdle AlarmState = iota
+	// StatePreAlarm is the run-up to an alarm, while the audio output is prepared or the smart wake window is open.
+	StatePreAlarm
+	StateRinging
+	StateSnoozed
+	// StateDismissed follows a stopped alarm until the next one approaches.
+	StateDismissed
+)
+
+func (s AlarmState) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StatePreAlarm:
+		return "pre-alarm"
+	case StateRinging:
+		return "ringing"
+	case StateSnoozed:
+		return "snoozed"
+	case StateDismissed:
+		return "dismissed"
+	}
+	return fmt.Sprintf("AlarmState(%d)", int(s))
+}
+
+// transitions lists the states each state may move to. Ringing to ringing is another
+// alarm taking over, snoozed to ringing is either the snooze running out or another alarm.
+var transitions = map[AlarmState][]AlarmState{
+	StateIdle:      {StatePreAlarm, StateRinging},
+	StatePreAlarm:  {StatePreAlarm, StateRinging, StateIdle},
+	StateRinging:   {StateRinging, StateSnoozed, StateDismissed},
+	StateSnoozed:   {StateRinging, StateDismissed},
+	StateDismissed: {StatePreAlarm, StateRinging, StateIdle},
+}
+
+func canTransition(from, to AlarmState) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+var (
+	ErrInvalidTransition = errors.New("invalid alarm state transition")
+	ErrAlreadyRinging    = errors.New("alarm is already ringing")
+)
+
+// AlarmStatus is a consistent view of the state machine.
+type AlarmStatus struct {
+	State AlarmState
+	// AlarmID is the alarm the state is about, or -1 in StateIdle.
+	AlarmID int64
+	// Since is when the current state was entered.
+	Since time.Time
+	// SnoozeUntil is when a snoozed alarm rings again.
+	SnoozeUntil time.Time
+	// SnoozesUsed counts the snoozes since the alarm first rang.
+	SnoozesUsed int
+
+	// Preloading is true while the audio output is being prepared, which runs alongside the states.
+	Preloading bool
+	// PreloadedAt is when the audio output was last prepared successfully.
+	PreloadedAt time.Time
+}
+
+// Alerting reports whether an alarm is ringing or snoozed.
+func (s AlarmStatus) Alerting() bool {
+	return s.State == StateRinging || s.State == StateSnoozed
+}
+
+// Transition is the status before and after a state change.
+type Transition struct {
+	From, To AlarmStatus
+}
+
+// AlarmMachine owns the alarm state. A single goroutine applies every change in turn,
+// so it may be used from the main loop, IPC handlers and audio goroutines alike.
+type AlarmMachine struct {
+	ops chan func(*AlarmStatus)
+}
+
+func NewAlarmMachine() *AlarmMachine {
+	m := &AlarmMachine{ops: make(chan func(*AlarmStatus))}
+	go m.run()
+	return m
+}
+
+func (m *AlarmMachine) run() {
+	status := AlarmStatus{State: StateIdle, AlarmID: -1}
+	for op := range m.ops {
+		op(&status)
+	}
+}
+
+// do runs f on the owner goroutine and returns the status around it. f leaves the
+// status untouched when it returns an error.
+func (m *AlarmMachine) do(f func(s *AlarmStatus) error) (Transition, error) {
+	type result struct {
+		t   Transition
+		err error
+	}
+	reply := make(chan result, 1)
+	m.ops <- func(s *AlarmStatus) {
+		from := *s
+		next := *s
+		if err := f(&next); err != nil {
+			reply <- result{Transition{from, from}, err}
+			return
+		}
+		*s = next
+		reply <- result{Transition{from, next}, nil}
+	}
+	r := <-reply
+	return r.t, r.err
+}
+
+// move changes to state to for alarm id once guard, if any, allows it.
+func (m *AlarmMachine) move(to AlarmState, id int64, now time.Time, guard func(s *AlarmStatus) error) (Transition, error) {
+	return m.do(func(s *AlarmStatus) error {
+		if !canTransition(s.State, to) {
+			return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, s.State, to)
+		}
+		if guard != nil {
+			if err := guard(s); err != nil {
+				return err
+			}
+		}
+		s.State = to
+		s.AlarmID = id
+		s.Since = now
+		if to != StateSnoozed {
+			s.SnoozeUntil = time.Time{}
+		}
+		return nil
+	})
+}
+
+func (m *AlarmMachine) Status() AlarmStatus {
+	t, _ := m.do(func(*AlarmStatus) error { return nil })
+	return t.To
+}
+
+// PreAlarm enters the run-up to alarm id.
+func (m *AlarmMachine) PreAlarm(id int64, now time.Time) (Transition, error) {
+	return m.move(StatePreAlarm, id, now, nil)
+}
+
+// CancelPreAlarm returns to idle when the run-up to alarm id ends without it ringing.
+func (m *AlarmMachine) CancelPreAlarm(id int64, now time.Time) (Transition, error) {
+	return m.move(StateIdle, -1, now, func(s *AlarmStatus) error {
+		if s.State != StatePreAlarm || s.AlarmID != id {
+			return fmt.Errorf("%w: alarm %d is not approaching", ErrInvalidTransition, id)
+		}
+		return nil
+	})
+}
+
+// Ring starts alarm id ringing. Its snooze count starts over.
+func (m *AlarmMachine) Ring(id int64, now time.Time) (Transition, error) {
+	return m.move(StateRinging, id, now, func(s *AlarmStatus) error {
+		if s.State == StateRinging && s.AlarmID == id {
+			return ErrAlreadyRinging
+		}
+		s.SnoozesUsed = 0
+		return nil
+	})
+}
+
+// Snooze silences alarm id until policy's duration has passed, if policy allows another snooze.
+func (m *AlarmMachine) Snooze(id int64, policy SnoozePolicy, now time.Time) (Transition, error) {
+	return m.move(StateSnoozed, id, now, func(s *AlarmStatus) error {
+		if s.AlarmID != id {
+			return fmt.Errorf("%w: alarm %d is not ringing", ErrInvalidTransition, id)
+		}
+		if err := policy.check(s.SnoozesUsed); err != nil {
+			return err
+		}
+		s.SnoozesUsed++
+		s.SnoozeUntil = now.Add(policy.Duration)
+		return nil
+	})
+}
+
+// EndSnooze rings the snoozed alarm again.
+func (m *AlarmMachine) EndSnooze(now time.Time) (Transition, error) {
+	return m.do(func(s *AlarmStatus) error {
+		if s.State != StateSnoozed {
+			return fmt.Errorf("%w: no alarm is snoozed", ErrInvalidTransition)
+		}
+		s.State = StateRinging
+		s.Since = now
+		s.SnoozeUntil = time.Time{}
+		return nil
+	})
+}
+
+// Dismiss stops the ringing or snoozed alarm. The dismissed status keeps its ID.
+func (m *AlarmMachine) Dismiss(now time.Time) (Transition, error) {
+	return m.do(func(s *AlarmStatus) error {
+		if !canTransition(s.State, StateDismissed) {
+			return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, s.State, StateDismissed)
+		}
+		s.State = StateDismissed
+		s.Since = now
+		s.SnoozeUntil = time.Time{}
+		s.SnoozesUsed = 0
+		return nil
+	})
+}
+
+// Restore puts back a ringing or snoozed alarm saved before a restart. It only works while idle.
+func (m *AlarmMachine) Restore(saved AlarmStatus) (Transition, error) {
+	return m.do(func(s *AlarmStatus) error {
+		if s.State != StateIdle {
+			return fmt.Errorf("%w: cannot restore while %s", ErrInvalidTransition, s.State)
+		}
+		if !saved.Alerting() {
+			return fmt.Errorf("%w: cannot restore %s", ErrInvalidTransition, saved.State)
+		}
+		s.State = saved.State
+		s.AlarmID = saved.AlarmID
+		s.Since = saved.Since
+		s.SnoozeUntil = saved.SnoozeUntil
+		s.SnoozesUsed = saved.SnoozesUsed
+		return nil
+	})
+}
+
+// StartPreload claims the audio preload and reports false if one is already running.
+func (m *AlarmMachine) StartPreload() bool {
+	_, err := m.do(func(s *AlarmStatus) error {
+		if s.Preloading {
+			return errors.New("preload already running")
+		}
+		s.Preloading = true
+		return nil
+	})
+	return err == nil
+}
+
+// FinishPreload releases the audio preload, recording the time when it succeeded.
+func (m *AlarmMachine) FinishPreload(ok bool, now time.Time) {
+	m.do(func(s *AlarmStatus) error {
+		s.Preloading = false
+		if ok {
+			s.PreloadedAt = now
+		}
+		return nil
+	})
+}
@@ -0,0 +1,311 @@
+package daemon
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var snoozeTwice = SnoozePolicy{Enabled: true, Duration: 10 * time.Minute, MaxCount: 2}
+
+func TestAlarmMachine_Lifecycle(t *testing.T) {
+	m := NewAlarmMachine()
+	now := monday(6, 25)
+
+	step := func(name string, tr Transition, err error, want AlarmState) Transition {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if tr.To.State != want {
+			t.Fatalf("%s: expected %v, got %v", name, want, tr.To.State)
+		}
+		return tr
+	}
+
+	tr, err := m.PreAlarm(1, now)
+	step("PreAlarm", tr, err, StatePreAlarm)
+
+	tr, err = m.Ring(1, monday(6, 30))
+	step("Ring", tr, err, StateRinging)
+
+	tr, err = m.Snooze(1, snoozeTwice, monday(6, 31))
+	tr = step("Snooze", tr, err, StateSnoozed)
+	if !tr.To.SnoozeUntil.Equal(monday(6, 41)) || tr.To.SnoozesUsed != 1 {
+		t.Errorf("Expected a snooze until 06:41 counting 1, got %v counting %d", tr.To.SnoozeUntil, tr.To.SnoozesUsed)
+	}
+
+	tr, err = m.EndSnooze(monday(6, 41))
+	tr = step("EndSnooze", tr, err, StateRinging)
+	if !tr.To.SnoozeUntil.IsZero() || tr.To.SnoozesUsed != 1 {
+		t.Errorf("Expected the snooze cleared but still counted, got %+v", tr.To)
+	}
+
+	tr, err = m.Dismiss(monday(6, 45))
+	tr = step("Dismiss", tr, err, StateDismissed)
+	if tr.From.AlarmID != 1 || tr.To.AlarmID != 1 || tr.To.SnoozesUsed != 0 {
+		t.Errorf("Expected alarm 1 dismissed with its snoozes reset, got %+v", tr)
+	}
+
+	tr, err = m.PreAlarm(2, monday(7, 25))
+	step("PreAlarm after dismissal", tr, err, StatePreAlarm)
+
+	tr, err = m.CancelPreAlarm(2, monday(7, 30))
+	tr = step("CancelPreAlarm", tr, err, StateIdle)
+	if tr.To.AlarmID != -1 {
+		t.Errorf("Expected no alarm when idle, got %d", tr.To.AlarmID)
+	}
+}
+
+func TestAlarmMachine_GuardsTransitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(m *AlarmMachine)
+		attempt func(m *AlarmMachine) (Transition, error)
+		want    error
+	}{
+		{
+			name:    "snooze while idle",
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.Snooze(1, snoozeTwice, monday(7, 0)) },
+			want:    ErrInvalidTransition,
+		},
+		{
+			name:    "dismiss while idle",
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.Dismiss(monday(7, 0)) },
+			want:    ErrInvalidTransition,
+		},
+		{
+			name:    "end a snooze that does not exist",
+			setup:   func(m *AlarmMachine) { m.Ring(1, monday(7, 0)) },
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.EndSnooze(monday(7, 1)) },
+			want:    ErrInvalidTransition,
+		},
+		{
+			name:    "ring the ringing alarm again",
+			setup:   func(m *AlarmMachine) { m.Ring(1, monday(7, 0)) },
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.Ring(1, monday(7, 1)) },
+			want:    ErrAlreadyRinging,
+		},
+		{
+			name:    "snooze another alarm than the ringing one",
+			setup:   func(m *AlarmMachine) { m.Ring(1, monday(7, 0)) },
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.Snooze(2, snoozeTwice, monday(7, 1)) },
+			want:    ErrInvalidTransition,
+		},
+		{
+			name: "snooze past the limit",
+			setup: func(m *AlarmMachine) {
+				m.Ring(1, monday(7, 0))
+				for i := 0; i < 2; i++ {
+					m.Snooze(1, snoozeTwice, monday(7, 0))
+					m.EndSnooze(monday(7, 10))
+				}
+			},
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.Snooze(1, snoozeTwice, monday(7, 20)) },
+			want:    ErrSnoozeLimitReached,
+		},
+		{
+			name:    "snooze when it is off",
+			setup:   func(m *AlarmMachine) { m.Ring(1, monday(7, 0)) },
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.Snooze(1, SnoozePolicy{}, monday(7, 1)) },
+			want:    ErrSnoozeDisabled,
+		},
+		{
+			name:    "pre-alarm while ringing",
+			setup:   func(m *AlarmMachine) { m.Ring(1, monday(7, 0)) },
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.PreAlarm(2, monday(7, 1)) },
+			want:    ErrInvalidTransition,
+		},
+		{
+			name:    "cancel the run-up to another alarm",
+			setup:   func(m *AlarmMachine) { m.PreAlarm(1, monday(6, 55)) },
+			attempt: func(m *AlarmMachine) (Transition, error) { return m.CancelPreAlarm(2, monday(7, 0)) },
+			want:    ErrInvalidTransition,
+		},
+		{
+			name:  "restore over a ringing alarm",
+			setup: func(m *AlarmMachine) { m.Ring(1, monday(7, 0)) },
+			attempt: func(m *AlarmMachine) (Transition, error) {
+				return m.Restore(AlarmStatus{State: StateSnoozed, AlarmID: 2})
+			},
+			want: ErrInvalidTransition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewAlarmMachine()
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			before := m.Status()
+
+			tr, err := tt.attempt(m)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if tr.To != before {
+				t.Errorf("Expected a refused transition to report the old status %+v, got %+v", before, tr.To)
+			}
+			if after := m.Status(); after != before {
+				t.Errorf("Expected the status to stay %+v, got %+v", before, after)
+			}
+		})
+	}
+}
+
+func TestAlarmMachine_AnotherAlarmTakesOver(t *testing.T) {
+	m := NewAlarmMachine()
+	m.Ring(1, monday(7, 0))
+	m.Snooze(1, snoozeTwice, monday(7, 1))
+
+	tr, err := m.Ring(2, monday(7, 5))
+	if err != nil {
+		t.Fatalf("Ring failed: %v", err)
+	}
+	if tr.From.State != StateSnoozed || tr.To.AlarmID != 2 || tr.To.SnoozesUsed != 0 || !tr.To.SnoozeUntil.IsZero() {
+		t.Errorf("Expected alarm 2 to replace the snoozed alarm 1, got %+v", tr)
+	}
+}
+
+func TestAlarmMachine_Restore(t *testing.T) {
+	m := NewAlarmMachine()
+	saved := AlarmStatus{State: StateSnoozed, AlarmID: 3, Since: monday(7, 0), SnoozeUntil: monday(7, 10), SnoozesUsed: 1}
+
+	if _, err := m.Restore(AlarmStatus{State: StateDismissed, AlarmID: 3}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected only ringing or snoozed alarms to be restored, got %v", err)
+	}
+	if _, err := m.Restore(saved); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got := m.Status(); got != saved {
+		t.Errorf("Expected %+v, got %+v", saved, got)
+	}
+}
+
+// TestAlarmMachine_ConcurrentSnooze presses snooze from many places at once, as the
+// UI, the socket and D-Bus could: only one press may count.
+func TestAlarmMachine_ConcurrentSnooze(t *testing.T) {
+	m := NewAlarmMachine()
+	m.Ring(1, monday(7, 0))
+
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Snooze(1, snoozeTwice, monday(7, 1)); err == nil {
+				won.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := won.Load(); n != 1 {
+		t.Errorf("Expected exactly one snooze to succeed, got %d", n)
+	}
+	if got := m.Status(); got.State != StateSnoozed || got.SnoozesUsed != 1 {
+		t.Errorf("Expected one snooze, got %+v", got)
+	}
+}
+
+func TestAlarmMachine_ConcurrentPreload(t *testing.T) {
+	m := NewAlarmMachine()
+
+	var wg sync.WaitGroup
+	var started atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.StartPreload() {
+				started.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := started.Load(); n != 1 {
+		t.Fatalf("Expected one preload to start, got %d", n)
+	}
+	m.FinishPreload(true, monday(6, 55))
+	if got := m.Status(); got.Preloading || !got.PreloadedAt.Equal(monday(6, 55)) {
+		t.Errorf("Expected the preload to be finished at 06:55, got %+v", got)
+	}
+	if !m.StartPreload() {
+		t.Error("Expected a new preload to start after the last one finished")
+	}
+}
+
+// TestAlarmMachine_Hammer drives every transition from many goroutines while others
+// read the status, and checks that every status seen is consistent.
+func TestAlarmMachine_Hammer(t *testing.T) {
+	m := NewAlarmMachine()
+	policy := SnoozePolicy{Enabled: true, Duration: time.Minute}
+	stop := make(chan struct{})
+
+	var writers sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			id := int64(w%3 + 1)
+			for i := 0; i < 300; i++ {
+				now := monday(7, 0).Add(time.Duration(i) * time.Second)
+				switch (i + w) % 6 {
+				case 0:
+					m.PreAlarm(id, now)
+				case 1:
+					m.Ring(id, now)
+				case 2:
+					m.Snooze(m.Status().AlarmID, policy, now)
+				case 3:
+					m.EndSnooze(now)
+				case 4:
+					m.Dismiss(now)
+				case 5:
+					m.CancelPreAlarm(id, now)
+				}
+			}
+		}(w)
+	}
+
+	var readers sync.WaitGroup
+	errs := make(chan string, 16)
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s := m.Status()
+				switch {
+				case s.State == StateIdle && s.AlarmID != -1:
+					errs <- "idle with an alarm"
+				case s.State != StateIdle && s.AlarmID == -1:
+					errs <- s.State.String() + " without an alarm"
+				case (s.State == StateSnoozed) != !s.SnoozeUntil.IsZero():
+					errs <- s.State.String() + " with snooze time " + s.SnoozeUntil.String()
+				default:
+					continue
+				}
+				return
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+	close(errs)
+	for e := range errs {
+		t.Errorf("Inconsistent status: %s", e)
+	}
+}
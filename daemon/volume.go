@@ -1,26 +1,121 @@
 package daemon
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jfreymuth/pulse/proto"
 )
 
-func ForceSpeakerOutput() error {
-	tryConnect := func(url string) (*proto.Client, net.Conn, error) {
-		if url == "" {
-			return nil, nil, nil
+// pulseRequester is the part of *proto.Client used to change and restore sinks.
+type pulseRequester interface {
+	Request(req proto.RequestArgs, rpl proto.Reply) error
+}
+
+// sinkState is what we change on a sink while an alarm rings.
+type sinkState struct {
+	Name    string
+	Volumes proto.ChannelVolumes
+	Mute    bool
+}
+
+// outputSnapshot records the user's audio setup from before the alarm took over the output.
+type outputSnapshot struct {
+	DefaultSink string
+	Sinks       []sinkState
+}
+
+// errOutputReleased is returned by ForceAlarmOutput when the alarm stopped before the output was taken over.
+var errOutputReleased = errors.New("alarm no longer needs the output")
+
+var (
+	// outputMu serialises changing the output with restoring it, so a routing
+	// pass that is still running cannot undo a restore.
+	outputMu    sync.Mutex
+	savedOutput *outputSnapshot
+)
+
+// takeOutputSnapshot records the default sink and the state of it and of the sink we are about to take over.
+func takeOutputSnapshot(sinks proto.GetSinkInfoListReply, defaultSink, target string) *outputSnapshot {
+	snap := &outputSnapshot{DefaultSink: defaultSink}
+	for _, s := range sinks {
+		if s == nil {
+			continue
 		}
-		log.Printf("PulseAudio: Attempting connect to %s", url)
-		return proto.Connect(url)
+		if s.SinkName != defaultSink && s.SinkName != target {
+			continue
+		}
+		snap.Sinks = append(snap.Sinks, sinkState{
+			Name:    s.SinkName,
+			Volumes: append(proto.ChannelVolumes(nil), s.ChannelVolumes...),
+			Mute:    s.Mute,
+		})
+	}
+	return snap
+}
+
+// restore puts back the volumes, mute state and default sink. Sinks are addressed by
+// name, because indexes change when a device is unplugged and plugged in again.
+func (s *outputSnapshot) restore(c pulseRequester) error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, sink := range s.Sinks {
+		if len(sink.Volumes) > 0 {
+			keep(c.Request(&proto.SetSinkVolume{
+				SinkIndex:      proto.Undefined,
+				SinkName:       sink.Name,
+				ChannelVolumes: sink.Volumes,
+			}, nil))
+		}
+		keep(c.Request(&proto.SetSinkMute{
+			SinkIndex: proto.Undefined,
+			SinkName:  sink.Name,
+			Mute:      sink.Mute,
+		}, nil))
+	}
+	if s.DefaultSink != "" {
+		keep(c.Request(&proto.SetDefaultSink{SinkName: s.DefaultSink}, nil))
+	}
+	return firstErr
+}
+
+// RestoreAudioOutput undoes what ForceAlarmOutput changed. It does nothing if the
+// output was not taken over, so it is safe to call whenever an alarm stops or snoozes.
+func RestoreAudioOutput() error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	if savedOutput == nil {
+		return nil
 	}
 
+	c, conn, err := connectPulse()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.Printf("PulseAudio: Restoring default sink %s", savedOutput.DefaultSink)
+	if err := savedOutput.restore(c); err != nil {
+		return fmt.Errorf("failed to restore audio output: %w", err)
+	}
+	savedOutput = nil
+	return nil
+}
+
+func connectPulse() (*proto.Client, net.Conn, error) {
 	uid := os.Getuid()
 	candidates := []string{
 		os.Getenv("PULSE_SERVER"),
@@ -28,34 +123,42 @@ func ForceSpeakerOutput() error {
 		fmt.Sprintf("unix:@/run/user/%d/pulse/native", uid),
 	}
 
-	var c *proto.Client
-	var conn net.Conn
 	var err error
-
 	for _, url := range candidates {
 		if url == "" {
 			continue
 		}
-		c, conn, err = tryConnect(url)
+		log.Printf("PulseAudio: Attempting connect to %s", url)
+		var c *proto.Client
+		var conn net.Conn
+		c, conn, err = proto.Connect(url)
 		if err == nil {
 			log.Printf("PulseAudio: Connected successfully to %s", url)
-			break
+
+			props := proto.PropList{
+				"application.name": proto.PropListString("circadia-daemon"),
+			}
+			if err := c.Request(&proto.SetClientName{Props: props}, &proto.SetClientNameReply{}); err != nil {
+				log.Printf("PulseAudio: SetClientName error: %v", err)
+			}
+			return c, conn, nil
 		}
 		log.Printf("PulseAudio: Failed to connect to %s: %v", url, err)
 	}
 
-	if c == nil {
-		log.Printf("PulseAudio: All connection attempts failed. Last error: %v", err)
-		return fmt.Errorf("connection failed: %w", err)
-	}
-	defer conn.Close()
+	log.Printf("PulseAudio: All connection attempts failed. Last error: %v", err)
+	return nil, nil, fmt.Errorf("connection failed: %w", err)
+}
 
-	props := proto.PropList{
-		"application.name": proto.PropListString("circadia-daemon"),
-	}
-	if err := c.Request(&proto.SetClientName{Props: props}, &proto.SetClientNameReply{}); err != nil {
-		log.Printf("PulseAudio: SetClientName error: %v", err)
+// ForceAlarmOutput routes our stream to the sink chosen by the output settings,
+// unmutes it and sets it to volume percent. It changes nothing once the alarm has
+// stopped ringing or approaching.
+func (d *Daemon) ForceAlarmOutput(volume int) error {
+	c, conn, err := connectPulse()
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
 
 	var sinks proto.GetSinkInfoListReply
 	err = c.Request(&proto.GetSinkInfoList{}, &sinks)
@@ -64,133 +167,141 @@ func ForceSpeakerOutput() error {
 		return fmt.Errorf("list sinks failed: %w", err)
 	}
 
-	var bestSinkIndex uint32 = 0xFFFFFFFF
-	var bestSinkName string
-	bestScore := -1
-
-	for _, s := range sinks {
-		if s == nil {
-			continue
-		}
-		score := 0
-		name := strings.ToLower(s.SinkName)
-		desc := strings.ToLower(s.Device)
-
-		if strings.Contains(name, "speaker") || strings.Contains(desc, "speaker") || strings.Contains(name, "primary") {
-			score += 10
-		}
-		if strings.Contains(name, "pci") || strings.Contains(name, "platform") {
-			score += 2
-		}
-		if strings.Contains(name, "usb") || strings.Contains(name, "bluez") {
-			score -= 5
-		}
-
-		log.Printf("PulseAudio: Found Sink: %s (Desc: %s) Score: %d", s.SinkName, s.Device, score)
-
-		if score > bestScore {
-			bestScore = score
-			bestSinkIndex = s.SinkIndex
-			bestSinkName = s.SinkName
-		}
+	var info proto.GetServerInfoReply
+	if err := c.Request(&proto.GetServerInfo{}, &info); err != nil {
+		log.Printf("PulseAudio: GetServerInfo error: %v", err)
 	}
 
-	if bestSinkIndex == 0xFFFFFFFF {
+	policy, _ := d.store.GetAudioOutputPolicy()
+	pinned, _ := d.store.GetAudioOutputSink()
+
+	best := chooseSink(sinks, info.DefaultSinkName, policy, pinned)
+	if best == nil {
 		log.Println("PulseAudio: No suitable sink found")
 		return fmt.Errorf("no suitable sink found")
 	}
+	bestSinkIndex := best.SinkIndex
+	bestSinkName := best.SinkName
 
 	log.Printf("PulseAudio: Selected Sink: %s (Index: %d)", bestSinkName, bestSinkIndex)
 
-	var channels int
-	for _, s := range sinks {
-		if s.SinkIndex == bestSinkIndex {
-			channels = len(s.ChannelMap)
-			break
-		}
-	}
+	channels := len(best.ChannelMap)
 	if channels == 0 {
 		channels = 2
 	}
 
 	vol := make(proto.ChannelVolumes, channels)
 	for i := range vol {
-		vol[i] = 0x10000
+		vol[i] = uint32(0x10000 * volume / 100)
+	}
+
+	if err := takeOverSink(c, sinks, info.DefaultSinkName, best, vol, d.needsAlarmOutput); err != nil {
+		log.Printf("PulseAudio: Leaving the output alone: %v", err)
+		return err
+	}
+
+	myPid := strconv.Itoa(os.Getpid())
+
+	for {
+		outputMu.Lock()
+		if !d.IsRinging() {
+			outputMu.Unlock()
+			break
+		}
+		routeOurStreams(c, bestSinkIndex, bestSinkName, vol, myPid)
+		outputMu.Unlock()
+
+		time.Sleep(500 * time.Millisecond)
+	}
+	return nil
+}
+
+// needsAlarmOutput reports whether an alarm is ringing or about to ring.
+func (d *Daemon) needsAlarmOutput() bool {
+	state := d.state.Status().State
+	return state == StateRinging || state == StatePreAlarm
+}
+
+// takeOverSink records the user's output and turns sink up to vol. It checks needed under
+// outputMu first, so a restore either comes after the snapshot and undoes it, or comes
+// before and leaves the output alone.
+func takeOverSink(c pulseRequester, sinks proto.GetSinkInfoListReply, defaultSink string, sink *proto.GetSinkInfoReply, vol proto.ChannelVolumes, needed func() bool) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	if !needed() {
+		return errOutputReleased
+	}
+	if savedOutput == nil {
+		savedOutput = takeOutputSnapshot(sinks, defaultSink, sink.SinkName)
 	}
 
 	if err := c.Request(&proto.SetSinkVolume{
-		SinkIndex:      bestSinkIndex,
+		SinkIndex:      sink.SinkIndex,
 		ChannelVolumes: vol,
 	}, nil); err != nil {
 		log.Printf("PulseAudio: SetVolume error: %v", err)
 	}
 
 	if err := c.Request(&proto.SetSinkMute{
-		SinkIndex: bestSinkIndex,
+		SinkIndex: sink.SinkIndex,
 		Mute:      false,
 	}, nil); err != nil {
 		log.Printf("PulseAudio: SetMute error: %v", err)
 	}
+	return nil
+}
 
-	myPid := strconv.Itoa(os.Getpid())
+// routeOurStreams makes the chosen sink the default and moves our playback streams onto it.
+func routeOurStreams(c pulseRequester, sinkIndex uint32, sinkName string, vol proto.ChannelVolumes, myPid string) {
+	if err := c.Request(&proto.SetDefaultSink{SinkName: sinkName}, nil); err != nil {
+		log.Printf("PulseAudio: SetDefaultSink error: %v", err)
+	}
 
-	for IsRinging() {
-		if err := c.Request(&proto.SetDefaultSink{SinkName: bestSinkName}, nil); err != nil {
-			log.Printf("PulseAudio: SetDefaultSink error: %v", err)
-		}
+	var inputs proto.GetSinkInputInfoListReply
+	if err := c.Request(&proto.GetSinkInputInfoList{}, &inputs); err != nil {
+		log.Printf("PulseAudio: GetSinkInputList error: %v", err)
+		return
+	}
 
-		var inputs proto.GetSinkInputInfoListReply
-		if err := c.Request(&proto.GetSinkInputInfoList{}, &inputs); err != nil {
-			log.Printf("PulseAudio: GetSinkInputList error: %v", err)
-			time.Sleep(1 * time.Second)
+	for _, input := range inputs {
+		if input == nil {
 			continue
 		}
 
-		for _, input := range inputs {
-			if input == nil {
-				continue
+		isMatch := false
+		if pidBytes, ok := input.Properties["application.process.id"]; ok {
+			pidVal := strings.TrimRight(string(pidBytes), "\x00")
+			if pidVal == myPid {
+				isMatch = true
 			}
+		}
 
-			isMatch := false
-			if pidBytes, ok := input.Properties["application.process.id"]; ok {
-				pidVal := strings.TrimRight(string(pidBytes), "\x00")
-				if pidVal == myPid {
+		if !isMatch {
+			if nameBytes, ok := input.Properties["application.name"]; ok {
+				nameVal := strings.TrimRight(string(nameBytes), "\x00")
+				if nameVal == "circadia" || nameVal == "circadia-daemon" {
 					isMatch = true
 				}
 			}
+		}
 
-			if !isMatch {
-				if nameBytes, ok := input.Properties["application.name"]; ok {
-					nameVal := strings.TrimRight(string(nameBytes), "\x00")
-					if nameVal == "circadia" || nameVal == "circadia-daemon" {
-						isMatch = true
-					}
-				}
-			}
-
-			if isMatch {
-				if input.SinkIndex == bestSinkIndex {
-					continue
-				}
-
-				log.Printf("PulseAudio: Moving our stream (Index %d) to sink %d", input.SinkInputIndex, bestSinkIndex)
-				if err := c.Request(&proto.MoveSinkInput{
-					SinkInputIndex: input.SinkInputIndex,
-					DeviceIndex:    bestSinkIndex,
-				}, nil); err != nil {
-					log.Printf("PulseAudio: MoveSinkInput error: %v", err)
-				} else {
-					c.Request(&proto.SetSinkVolume{
-						SinkIndex:      bestSinkIndex,
-						ChannelVolumes: vol,
-					}, nil)
-					c.Request(&proto.SetSinkMute{SinkIndex: bestSinkIndex, Mute: false}, nil)
-				}
-
-			}
+		if !isMatch || input.SinkIndex == sinkIndex {
+			continue
 		}
 
-		time.Sleep(500 * time.Millisecond)
+		log.Printf("PulseAudio: Moving our stream (Index %d) to sink %d", input.SinkInputIndex, sinkIndex)
+		if err := c.Request(&proto.MoveSinkInput{
+			SinkInputIndex: input.SinkInputIndex,
+			DeviceIndex:    sinkIndex,
+		}, nil); err != nil {
+			log.Printf("PulseAudio: MoveSinkInput error: %v", err)
+		} else {
+			c.Request(&proto.SetSinkVolume{
+				SinkIndex:      sinkIndex,
+				ChannelVolumes: vol,
+			}, nil)
+			c.Request(&proto.SetSinkMute{SinkIndex: sinkIndex, Mute: false}, nil)
+		}
 	}
-	return nil
 }
@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+type fakePulse struct {
+	requests []proto.RequestArgs
+}
+
+func (f *fakePulse) Request(req proto.RequestArgs, rpl proto.Reply) error {
+	f.requests = append(f.requests, req)
+	return nil
+}
+
+func TestOutputSnapshot_RestoresDefaultSinkVolumeAndMute(t *testing.T) {
+	sinks := proto.GetSinkInfoListReply{
+		{SinkIndex: 1, SinkName: "headphones", ChannelVolumes: proto.ChannelVolumes{0x4000, 0x4000}, Mute: true},
+		{SinkIndex: 2, SinkName: "speaker", ChannelVolumes: proto.ChannelVolumes{0x8000, 0x8000}},
+		{SinkIndex: 3, SinkName: "hdmi", ChannelVolumes: proto.ChannelVolumes{0x10000}},
+	}
+	pulse := &fakePulse{}
+
+	snap := takeOutputSnapshot(sinks, "headphones", "speaker")
+
+	// The alarm takes over the speaker; the snapshot must not follow.
+	sinks[1].ChannelVolumes[0] = 0x10000
+
+	if err := snap.restore(pulse); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	volumes := map[string]proto.ChannelVolumes{}
+	mutes := map[string]bool{}
+	var defaultSink string
+	for _, req := range pulse.requests {
+		switch r := req.(type) {
+		case *proto.SetSinkVolume:
+			volumes[r.SinkName] = r.ChannelVolumes
+		case *proto.SetSinkMute:
+			mutes[r.SinkName] = r.Mute
+		case *proto.SetDefaultSink:
+			defaultSink = r.SinkName
+		}
+	}
+
+	if defaultSink != "headphones" {
+		t.Errorf("Expected default sink headphones, got %q", defaultSink)
+	}
+	if !slices.Equal(volumes["headphones"], proto.ChannelVolumes{0x4000, 0x4000}) {
+		t.Errorf("Expected headphones volume restored, got %v", volumes["headphones"])
+	}
+	if !slices.Equal(volumes["speaker"], proto.ChannelVolumes{0x8000, 0x8000}) {
+		t.Errorf("Expected speaker volume restored, got %v", volumes["speaker"])
+	}
+	if !mutes["headphones"] || mutes["speaker"] {
+		t.Errorf("Expected headphones muted and speaker unmuted, got %v", mutes)
+	}
+	if _, ok := volumes["hdmi"]; ok {
+		t.Error("Expected untouched sink to be left alone")
+	}
+
+	if _, ok := pulse.requests[len(pulse.requests)-1].(*proto.SetDefaultSink); !ok {
+		t.Error("Expected the default sink to be restored last")
+	}
+}
+
+func TestTakeOverSink_AfterRestore(t *testing.T) {
+	sinks := proto.GetSinkInfoListReply{
+		{SinkIndex: 1, SinkName: "headphones", ChannelVolumes: proto.ChannelVolumes{0x4000, 0x4000}, Mute: true},
+		{SinkIndex: 2, SinkName: "speaker", ChannelVolumes: proto.ChannelVolumes{0x8000, 0x8000}},
+	}
+	vol := proto.ChannelVolumes{0x10000, 0x10000}
+	t.Cleanup(func() { savedOutput = nil })
+
+	// The alarm was stopped and its restore ran before the output was taken over.
+	if err := RestoreAudioOutput(); err != nil {
+		t.Fatalf("RestoreAudioOutput failed: %v", err)
+	}
+	pulse := &fakePulse{}
+	if err := takeOverSink(pulse, sinks, "headphones", sinks[1], vol, func() bool { return false }); !errors.Is(err, errOutputReleased) {
+		t.Errorf("Expected errOutputReleased, got %v", err)
+	}
+	if len(pulse.requests) != 0 || savedOutput != nil {
+		t.Errorf("Expected the sink left untouched, got requests %v and snapshot %+v", pulse.requests, savedOutput)
+	}
+
+	if err := takeOverSink(pulse, sinks, "headphones", sinks[1], vol, func() bool { return true }); err != nil {
+		t.Fatalf("takeOverSink failed: %v", err)
+	}
+	if len(pulse.requests) != 2 || savedOutput == nil || savedOutput.DefaultSink != "headphones" {
+		t.Errorf("Expected the speaker taken over after a snapshot, got requests %v and snapshot %+v", pulse.requests, savedOutput)
+	}
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"circadia/internal/rtc"
+)
+
+// rtcWakealarmPath is the RTC attribute used to resume the device for alarms.
+var rtcWakealarmPath = rtc.DefaultPath
+
+// wakeLead is how long before an event the device resumes, so it has settled by then.
+const wakeLead = time.Minute
+
+// wakeProgrammer keeps the RTC wake-up in step with the scheduler. Finding and writing
+// the RTC can block, so requests are handed to a goroutine that only applies the latest one.
+type wakeProgrammer struct {
+	open func() (rtc.Waker, error)
+
+	mu      sync.Mutex
+	latest  time.Time
+	pending bool
+	kick    chan struct{}
+}
+
+// newWakeProgrammer applies requests to the waker returned by open. If there is none, or
+// it turns out unable to wake the device, it logs that once and ignores further requests.
+func newWakeProgrammer(open func() (rtc.Waker, error)) *wakeProgrammer {
+	w := &wakeProgrammer{open: open, kick: make(chan struct{}, 1)}
+	go w.run()
+	return w
+}
+
+// Request asks for the device to be awake at, or for no wake-up when at is zero. It does not block.
+func (w *wakeProgrammer) Request(at time.Time) {
+	w.mu.Lock()
+	w.latest = at
+	w.pending = true
+	w.mu.Unlock()
+
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (w *wakeProgrammer) run() {
+	waker, err := w.open()
+	if err != nil {
+		logWakeUnavailable(err)
+		return
+	}
+
+	for range w.kick {
+		w.mu.Lock()
+		at, pending := w.latest, w.pending
+		w.pending = false
+		w.mu.Unlock()
+
+		if !pending {
+			continue
+		}
+		if at.IsZero() {
+			if err := waker.ClearWake(); err != nil {
+				log.Printf("Failed to clear RTC wake-up: %v", err)
+			}
+			continue
+		}
+
+		wake := at.Add(-wakeLead)
+		if err := waker.SetWake(wake); errors.Is(err, rtc.ErrUnsupported) {
+			logWakeUnavailable(err)
+			return
+		} else if err != nil {
+			log.Printf("Failed to program RTC wake-up: %v", err)
+			continue
+		}
+		log.Printf("RTC wake-up set for %s", wake.Format("2006-01-02 15:04:05"))
+	}
+}
+
+func logWakeUnavailable(err error) {
+	log.Printf("Alarms cannot wake the device from suspend, it has to stay awake for them: %v", err)
+}
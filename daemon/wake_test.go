@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"circadia/internal/rtc"
+)
+
+func TestWakeProgrammer_WritesWakealarm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wakealarm")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Failed to create fake wakealarm: %v", err)
+	}
+	sysfs := rtc.NewSysfs(path)
+	w := newWakeProgrammer(func() (rtc.Waker, error) { return sysfs, nil })
+
+	waitFor := func(want time.Time, armed bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			got, ok, err := sysfs.Wake()
+			if err == nil && ok == armed && (!armed || got.Equal(want)) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		got, ok, err := sysfs.Wake()
+		t.Fatalf("Expected wake-up %v (armed %v), got %v (armed %v, err %v)", want, armed, got, ok, err)
+	}
+
+	at := time.Date(2024, 1, 2, 6, 25, 0, 0, time.UTC)
+	w.Request(at)
+	waitFor(at.Add(-wakeLead), true)
+
+	w.Request(at.Add(time.Hour))
+	w.Request(at.Add(2 * time.Hour))
+	waitFor(at.Add(2*time.Hour-wakeLead), true)
+
+	w.Request(time.Time{})
+	waitFor(time.Time{}, false)
+}
+
+// requestsReturn fails the test unless Request returns promptly for each of n wake-ups.
+func requestsReturn(t *testing.T, w *wakeProgrammer, n int) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		for i := range n {
+			w.Request(time.Date(2024, 1, 2, 6, i, 0, 0, time.UTC))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Request not to block")
+	}
+}
+
+func TestWakeProgrammer_Unsupported(t *testing.T) {
+	var opens atomic.Int32
+	opened := make(chan struct{})
+	w := newWakeProgrammer(func() (rtc.Waker, error) {
+		if opens.Add(1) == 1 {
+			close(opened)
+		}
+		return nil, rtc.ErrUnsupported
+	})
+	<-opened
+
+	requestsReturn(t, w, 3)
+	time.Sleep(50 * time.Millisecond)
+	if n := opens.Load(); n != 1 {
+		t.Errorf("Expected the waker to be opened once, got %d", n)
+	}
+}
+
+// refusingWaker cannot wake the device, which it only finds out when asked to.
+type refusingWaker struct {
+	sets atomic.Int32
+}
+
+func (r *refusingWaker) SetWake(time.Time) error {
+	r.sets.Add(1)
+	return rtc.ErrUnsupported
+}
+
+func (r *refusingWaker) ClearWake() error { return nil }
+
+func TestWakeProgrammer_UnsupportedOnFirstWake(t *testing.T) {
+	waker := &refusingWaker{}
+	w := newWakeProgrammer(func() (rtc.Waker, error) { return waker, nil })
+
+	w.Request(time.Date(2024, 1, 2, 6, 25, 0, 0, time.UTC))
+	deadline := time.Now().Add(2 * time.Second)
+	for waker.sets.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	requestsReturn(t, w, 3)
+	time.Sleep(50 * time.Millisecond)
+	if n := waker.sets.Load(); n != 1 {
+		t.Errorf("Expected requests to be dropped once waking failed, got %d attempts", n)
+	}
+}
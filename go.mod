@@ -5,6 +5,7 @@ go 1.24.4
 require (
 	github.com/adrg/xdg v0.5.3
 	github.com/diamondburned/gotk4/pkg v0.3.1
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/gopxl/beep/v2 v2.1.1
 	github.com/jfreymuth/pulse v0.1.1
 	github.com/mattn/go-sqlite3 v1.14.33
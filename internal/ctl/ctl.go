@@ -0,0 +1,374 @@
+// Package ctl implements "circadia ctl", a command-line client for the running daemon.
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"circadia/internal/ipc"
+)
+
+const usage = `Usage: circadia ctl [--json] <command>
+
+Commands:
+  list              List alarms
+  add HH:MM [LABEL] Add an alarm that repeats every day
+  enable ID         Enable an alarm
+  disable ID        Disable an alarm
+  snooze            Snooze the ringing alarm
+  stop              Stop the ringing or snoozed alarm
+  status            Show what the daemon is doing
+  sleep on|off      Start or end sleep mode
+  watch [EVENT...]  Print events as they happen, one per line
+  export [FILE]     Back up alarms, settings and sleep history to FILE or stdout
+  import [--replace] FILE
+                    Restore a backup, merged with the current data unless --replace
+`
+
+// errUsage marks mistakes in the command line, as opposed to failures reported by the daemon.
+var errUsage = errors.New("usage")
+
+// Run executes a ctl command line against the daemon listening on socketPath and returns the exit code.
+func Run(socketPath string, args []string, stdout, stderr io.Writer) int {
+	// Flags end at the command, so labels and file names are passed on as they are.
+	asJSON := false
+	rest := args
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		switch rest[0] {
+		case "--json":
+			asJSON = true
+		case "-h", "--help":
+			fmt.Fprint(stdout, usage)
+			return 0
+		default:
+			fmt.Fprintf(stderr, "circadia ctl: unknown flag %s\n\n%s", rest[0], usage)
+			return 2
+		}
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	if rest[0] == "help" {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	if rest[0] == "watch" {
+		return watch(socketPath, rest[1:], asJSON, stdout, stderr)
+	}
+
+	c, err := ipc.Dial(socketPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "circadia ctl: daemon is not running: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	err = run(c, rest, asJSON, stdout)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(stderr, "circadia ctl: %v\n\n%s", err, usage)
+		return 2
+	}
+
+	var ipcErr *ipc.Error
+	if asJSON && errors.As(err, &ipcErr) {
+		writeJSON(stdout, map[string]any{"error": ipcErr})
+	} else {
+		fmt.Fprintf(stderr, "circadia ctl: %v\n", err)
+	}
+	return 1
+}
+
+func run(c *ipc.Client, args []string, asJSON bool, out io.Writer) error {
+	command, params := args[0], args[1:]
+
+	switch command {
+	case "list":
+		if err := wantArgs(params, 0); err != nil {
+			return err
+		}
+		var alarms []ipc.AlarmInfo
+		if err := c.Call(ipc.CmdListAlarms, nil, &alarms); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, alarms)
+		}
+		printAlarms(out, alarms)
+
+	case "add":
+		if len(params) == 0 {
+			return fmt.Errorf("%w: add needs a time such as 06:30", errUsage)
+		}
+		t, err := time.Parse("15:04", params[0])
+		if err != nil {
+			return fmt.Errorf("%w: invalid time %q, expected HH:MM", errUsage, params[0])
+		}
+		addArgs := ipc.AddAlarmArgs{Hour: t.Hour(), Minute: t.Minute(), Label: strings.Join(params[1:], " ")}
+
+		var alarm ipc.AlarmInfo
+		if err := c.Call(ipc.CmdAddAlarm, addArgs, &alarm); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, alarm)
+		}
+		fmt.Fprintf(out, "Added alarm %d at %02d:%02d\n", alarm.ID, alarm.Hour, alarm.Minute)
+
+	case "enable", "disable":
+		if err := wantArgs(params, 1); err != nil {
+			return err
+		}
+		id, err := strconv.ParseInt(params[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid alarm ID %q", errUsage, params[0])
+		}
+
+		var alarm ipc.AlarmInfo
+		if err := c.Call(ipc.CmdSetAlarmEnabled, ipc.SetAlarmEnabledArgs{ID: id, Enabled: command == "enable"}, &alarm); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, alarm)
+		}
+		fmt.Fprintf(out, "Alarm %d at %02d:%02d %sd\n", alarm.ID, alarm.Hour, alarm.Minute, command)
+
+	case "snooze":
+		if err := wantArgs(params, 0); err != nil {
+			return err
+		}
+		var reply ipc.SnoozeReply
+		if err := c.Call(ipc.CmdSnooze, nil, &reply); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, reply)
+		}
+		fmt.Fprintf(out, "Snoozed until %s\n", reply.Until.Local().Format("15:04"))
+
+	case "stop":
+		if err := wantArgs(params, 0); err != nil {
+			return err
+		}
+		if err := c.Call(ipc.CmdStop, nil, nil); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, map[string]bool{"ok": true})
+		}
+		fmt.Fprintln(out, "Alarm stopped")
+
+	case "status":
+		if err := wantArgs(params, 0); err != nil {
+			return err
+		}
+		var status ipc.StatusReply
+		if err := c.Call(ipc.CmdStatus, nil, &status); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, status)
+		}
+		printStatus(out, status)
+
+	case "sleep":
+		if err := wantArgs(params, 1); err != nil {
+			return err
+		}
+		var enabled bool
+		switch params[0] {
+		case "on":
+			enabled = true
+		case "off":
+		default:
+			return fmt.Errorf("%w: sleep takes on or off, not %q", errUsage, params[0])
+		}
+		if err := c.Call(ipc.CmdSetSleepMode, ipc.EnabledArgs{Enabled: enabled}, nil); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, map[string]bool{"sleep_mode": enabled})
+		}
+		fmt.Fprintf(out, "Sleep mode %s\n", params[0])
+
+	case "export":
+		if len(params) > 1 {
+			return fmt.Errorf("%w: export takes at most one file", errUsage)
+		}
+		var backup json.RawMessage
+		if err := c.Call(ipc.CmdExportBackup, nil, &backup); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, backup, "", "  "); err != nil {
+			return fmt.Errorf("failed to format backup: %w", err)
+		}
+		buf.WriteByte('\n')
+
+		if len(params) == 0 || params[0] == "-" {
+			_, err := buf.WriteTo(out)
+			return err
+		}
+		// The backup holds sleep history, so keep it private like the database.
+		if err := os.WriteFile(params[0], buf.Bytes(), 0600); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		if asJSON {
+			return writeJSON(out, map[string]string{"file": params[0]})
+		}
+		fmt.Fprintf(out, "Backup written to %s\n", params[0])
+
+	case "import":
+		mode := "merge"
+		var files []string
+		for _, p := range params {
+			if p == "--replace" {
+				mode = "replace"
+			} else {
+				files = append(files, p)
+			}
+		}
+		if len(files) != 1 {
+			return fmt.Errorf("%w: import needs the backup file", errUsage)
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("%s is not a backup: invalid JSON", files[0])
+		}
+
+		var reply ipc.ImportBackupReply
+		if err := c.Call(ipc.CmdImportBackup, ipc.ImportBackupArgs{Mode: mode, Backup: data}, &reply); err != nil {
+			return err
+		}
+		if asJSON {
+			return writeJSON(out, reply)
+		}
+		fmt.Fprintf(out, "Imported %d alarm(s), %d setting(s) and %d sleep session(s)\n", reply.Alarms, reply.Settings, reply.SleepSessions)
+
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, command)
+	}
+	return nil
+}
+
+func wantArgs(params []string, n int) error {
+	if len(params) != n {
+		return fmt.Errorf("%w: expected %d argument(s), got %d", errUsage, n, len(params))
+	}
+	return nil
+}
+
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printAlarms(out io.Writer, alarms []ipc.AlarmInfo) {
+	if len(alarms) == 0 {
+		fmt.Fprintln(out, "No alarms")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tSTATE\tREPEAT\tNEXT\tLABEL")
+	for _, a := range alarms {
+		state := "off"
+		if a.Enabled {
+			state = "on"
+		}
+		next := "-"
+		if a.Next != nil {
+			next = a.Next.Local().Format("Mon 2 Jan 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%02d:%02d\t%s\t%s\t%s\t%s\n", a.ID, a.Hour, a.Minute, state, a.Repeat, next, a.Label)
+	}
+	w.Flush()
+}
+
+func describeAlarm(a *ipc.AlarmInfo) string {
+	s := fmt.Sprintf("%02d:%02d", a.Hour, a.Minute)
+	if a.Label != "" {
+		s += " " + a.Label
+	}
+	return s
+}
+
+func printStatus(out io.Writer, s ipc.StatusReply) {
+	switch {
+	case s.Ringing != nil:
+		fmt.Fprintf(out, "Ringing: %s\n", describeAlarm(s.Ringing))
+	case s.SnoozeUntil != nil:
+		alarm := "alarm"
+		if s.Snoozed != nil {
+			alarm = describeAlarm(s.Snoozed)
+		}
+		fmt.Fprintf(out, "Snoozed: %s until %s\n", alarm, s.SnoozeUntil.Local().Format("15:04"))
+	default:
+		fmt.Fprintln(out, "Idle")
+	}
+
+	if s.SleepMode && s.SleepStart != nil {
+		fmt.Fprintf(out, "Sleep mode: on since %s\n", s.SleepStart.Local().Format("Mon 15:04"))
+	} else {
+		fmt.Fprintln(out, "Sleep mode: off")
+	}
+
+	if s.NextAlarm != nil && s.NextAlarm.Next != nil {
+		fmt.Fprintf(out, "Next alarm: %s on %s\n", describeAlarm(s.NextAlarm), s.NextAlarm.Next.Local().Format("Mon 2 Jan"))
+	} else {
+		fmt.Fprintln(out, "Next alarm: none")
+	}
+}
+
+// watch streams events until the daemon goes away.
+func watch(socketPath string, events []string, asJSON bool, stdout, stderr io.Writer) int {
+	sub, err := ipc.Subscribe(socketPath, events...)
+	if err != nil {
+		if ipc.IsCode(err, ipc.ErrInvalidArgs) {
+			fmt.Fprintf(stderr, "circadia ctl: %v\n", err)
+			return 2
+		}
+		fmt.Fprintf(stderr, "circadia ctl: daemon is not running: %v\n", err)
+		return 1
+	}
+	defer sub.Close()
+
+	for {
+		ev, err := sub.Next()
+		if errors.Is(err, io.EOF) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "circadia ctl: %v\n", err)
+			return 1
+		}
+
+		if asJSON {
+			line, _ := json.Marshal(ev)
+			fmt.Fprintf(stdout, "%s\n", line)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s %s", ev.Time.Local().Format("15:04:05"), ev.Type)
+		if len(ev.Data) > 0 {
+			fmt.Fprintf(stdout, " %s", ev.Data)
+		}
+		fmt.Fprintln(stdout)
+	}
+}
@@ -0,0 +1,224 @@
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"circadia/internal/ipc"
+)
+
+func startFakeDaemon(t *testing.T) (*ipc.Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "daemon.sock")
+
+	s := ipc.NewServer()
+	if err := s.Listen(path); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func runCtl(path string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(path, args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_AddSendsTimeAndLabel(t *testing.T) {
+	s, path := startFakeDaemon(t)
+
+	var got ipc.AddAlarmArgs
+	s.Handle(ipc.CmdAddAlarm, func(raw json.RawMessage) (any, error) {
+		if err := ipc.DecodeArgs(raw, &got); err != nil {
+			return nil, err
+		}
+		return ipc.AlarmInfo{ID: 4, Hour: got.Hour, Minute: got.Minute, Enabled: true, Label: got.Label}, nil
+	})
+
+	code, out, errOut := runCtl(path, "add", "06:30", "Gym", "day")
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (%s)", code, errOut)
+	}
+	if got.Hour != 6 || got.Minute != 30 || got.Label != "Gym day" {
+		t.Errorf("Expected 06:30 \"Gym day\", got %+v", got)
+	}
+	if out != "Added alarm 4 at 06:30\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+
+	// Words after the command belong to it, even when they look like flags.
+	for _, label := range []string{"help", "--json"} {
+		if code, out, _ := runCtl(path, "add", "07:00", label); code != 0 || got.Label != label || strings.HasPrefix(out, "{") {
+			t.Errorf("Expected label %q, got code %d, %+v and %q", label, code, got, out)
+		}
+	}
+}
+
+func TestRun_ListAsJSON(t *testing.T) {
+	s, path := startFakeDaemon(t)
+
+	alarms := []ipc.AlarmInfo{{ID: 1, Hour: 7, Minute: 5, Enabled: true, Repeat: "Weekdays"}}
+	s.Handle(ipc.CmdListAlarms, func(json.RawMessage) (any, error) {
+		return alarms, nil
+	})
+
+	code, out, _ := runCtl(path, "--json", "list")
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	var got []ipc.AlarmInfo
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, out)
+	}
+	if len(got) != 1 || got[0] != alarms[0] {
+		t.Errorf("Expected %+v, got %+v", alarms, got)
+	}
+
+	code, out, _ = runCtl(path, "list")
+	if code != 0 || !strings.Contains(out, "07:05") || !strings.Contains(out, "Weekdays") {
+		t.Errorf("Unexpected text output (code %d):\n%s", code, out)
+	}
+}
+
+func TestRun_EnableAndSleep(t *testing.T) {
+	s, path := startFakeDaemon(t)
+
+	var enabled ipc.SetAlarmEnabledArgs
+	s.Handle(ipc.CmdSetAlarmEnabled, func(raw json.RawMessage) (any, error) {
+		if err := ipc.DecodeArgs(raw, &enabled); err != nil {
+			return nil, err
+		}
+		if enabled.ID != 2 {
+			return nil, ipc.Errorf(ipc.ErrNotFound, "no alarm with ID %d", enabled.ID)
+		}
+		return ipc.AlarmInfo{ID: 2, Hour: 6, Enabled: enabled.Enabled}, nil
+	})
+
+	var sleep ipc.EnabledArgs
+	s.Handle(ipc.CmdSetSleepMode, func(raw json.RawMessage) (any, error) {
+		return nil, ipc.DecodeArgs(raw, &sleep)
+	})
+
+	if code, _, _ := runCtl(path, "disable", "2"); code != 0 || enabled.Enabled {
+		t.Errorf("Expected alarm 2 disabled, got code %d and %+v", code, enabled)
+	}
+
+	code, out, _ := runCtl(path, "--json", "enable", "9")
+	if code != 1 || !strings.Contains(out, string(ipc.ErrNotFound)) {
+		t.Errorf("Expected not_found error as JSON, got code %d and %q", code, out)
+	}
+
+	if code, _, _ := runCtl(path, "sleep", "on"); code != 0 || !sleep.Enabled {
+		t.Errorf("Expected sleep mode on, got code %d and %+v", code, sleep)
+	}
+}
+
+func TestRun_ExportAndImport(t *testing.T) {
+	s, path := startFakeDaemon(t)
+
+	backup := `{"format":"circadia-backup","version":1,"alarms":[]}`
+	s.Handle(ipc.CmdExportBackup, func(json.RawMessage) (any, error) {
+		return json.RawMessage(backup), nil
+	})
+
+	var got ipc.ImportBackupArgs
+	s.Handle(ipc.CmdImportBackup, func(raw json.RawMessage) (any, error) {
+		if err := ipc.DecodeArgs(raw, &got); err != nil {
+			return nil, err
+		}
+		return ipc.ImportBackupReply{Alarms: 2, Settings: 5, SleepSessions: 9}, nil
+	})
+
+	file := filepath.Join(t.TempDir(), "backup.json")
+	if code, out, errOut := runCtl(path, "export", file); code != 0 || !strings.Contains(out, file) {
+		t.Fatalf("Expected the backup written, got code %d, %q and %q", code, out, errOut)
+	}
+	if code, out, _ := runCtl(path, "export"); code != 0 || !strings.Contains(out, `"format": "circadia-backup"`) {
+		t.Errorf("Expected the backup on stdout, got code %d and %q", code, out)
+	}
+
+	code, out, errOut := runCtl(path, "import", "--replace", file)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (%s)", code, errOut)
+	}
+	var sent bytes.Buffer
+	json.Compact(&sent, got.Backup)
+	if got.Mode != "replace" || sent.String() != backup {
+		t.Errorf("Expected the exported file sent for replacing, got %q and %s", got.Mode, got.Backup)
+	}
+	if out != "Imported 2 alarm(s), 5 setting(s) and 9 sleep session(s)\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+
+	if code, _, _ := runCtl(path, "import", filepath.Join(t.TempDir(), "missing.json")); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing file, got %d", code)
+	}
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	_, path := startFakeDaemon(t)
+
+	tests := [][]string{
+		{},
+		{"bogus"},
+		{"add"},
+		{"add", "25:99"},
+		{"enable", "x"},
+		{"sleep", "maybe"},
+		{"status", "extra"},
+		{"export", "a.json", "b.json"},
+		{"import", "--replace"},
+		{"--verbose", "list"},
+	}
+
+	for _, args := range tests {
+		if code, _, _ := runCtl(path, args...); code != 2 {
+			t.Errorf("%v: Expected exit code 2, got %d", args, code)
+		}
+	}
+}
+
+func TestRun_DaemonNotRunning(t *testing.T) {
+	code, _, errOut := runCtl(filepath.Join(t.TempDir(), "missing.sock"), "status")
+	if code != 1 || !strings.Contains(errOut, "not running") {
+		t.Errorf("Expected exit code 1 with a hint, got %d and %q", code, errOut)
+	}
+}
+
+func TestRun_WatchPrintsEventsUntilDaemonStops(t *testing.T) {
+	s, path := startFakeDaemon(t)
+
+	done := make(chan string)
+	go func() {
+		_, out, _ := runCtl(path, "--json", "watch", ipc.EventSnoozed)
+		done <- out
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// Publish until the subscription is in place, then end the stream.
+		s.Publish(ipc.EventDismissed, nil)
+		s.Publish(ipc.EventSnoozed, ipc.SnoozedEvent{Until: time.Date(2024, 1, 1, 6, 45, 0, 0, time.UTC)})
+		time.Sleep(20 * time.Millisecond)
+		if s.SubscriberCount() > 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	s.Publish(ipc.EventSnoozed, ipc.SnoozedEvent{Until: time.Date(2024, 1, 1, 6, 45, 0, 0, time.UTC)})
+	time.Sleep(200 * time.Millisecond)
+	s.Close()
+
+	out := <-done
+	if strings.Contains(out, ipc.EventDismissed) {
+		t.Errorf("Expected only snoozed events, got:\n%s", out)
+	}
+	if !strings.Contains(out, `"type":"snoozed"`) || !strings.Contains(out, "06:45:00") {
+		t.Errorf("Expected a snoozed event line, got:\n%s", out)
+	}
+}
@@ -0,0 +1,291 @@
+// Package dbusapi publishes the daemon on the D-Bus session bus as io.github.shinyvision.Circadia.Alarms.
+package dbusapi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// The GTK application already owns io.github.shinyvision.Circadia on its own
+// connection, so the service uses a name below it.
+const (
+	BusName    = "io.github.shinyvision.Circadia.Alarms"
+	ObjectPath = dbus.ObjectPath("/io/github/shinyvision/Circadia/Alarms")
+	Interface  = "io.github.shinyvision.Circadia.Alarms"
+
+	errorPrefix = "io.github.shinyvision.Circadia.Error."
+)
+
+// Signals emitted on Interface.
+const (
+	SignalAlarmRinging     = "AlarmRinging"
+	SignalSnoozed          = "Snoozed"
+	SignalDismissed        = "Dismissed"
+	SignalSleepStarted     = "SleepStarted"
+	SignalSleepEnded       = "SleepEnded"
+	SignalSessionSaved     = "SessionSaved"
+	SignalSettingsChanged  = "SettingsChanged"
+	SignalAlarmsChanged    = "AlarmsChanged"
+	SignalNextAlarmChanged = "NextAlarmChanged"
+)
+
+// alarmSignature is the D-Bus signature of Alarm.
+const alarmSignature = "(xiibsysx)"
+
+// Alarm is an alarm as seen over D-Bus.
+type Alarm struct {
+	ID      int64
+	Hour    int32
+	Minute  int32
+	Enabled bool
+	Label   string
+	// Days is the weekday bitmask with Sunday as the lowest bit; 0 means once.
+	Days uint8
+	// Date is YYYY-MM-DD for alarms on a specific date, empty otherwise.
+	Date string
+	// Next is the Unix time of the next ring, or 0 if the alarm will not ring.
+	Next int64
+}
+
+// Status is what the properties report.
+type Status struct {
+	NextAlarm time.Time
+	IsRinging bool
+	SleepMode bool
+}
+
+// Errors a Backend may wrap to pick the D-Bus error name the caller sees.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrRefused     = errors.New("refused")
+	ErrInvalidArgs = errors.New("invalid arguments")
+)
+
+// Backend carries out the method calls. It is called from D-Bus goroutines.
+type Backend interface {
+	ListAlarms() ([]Alarm, error)
+	AddAlarm(hour, minute int, label string, days uint8) (int64, error)
+	// UpdateAlarm changes the schedule, label and state of an existing alarm.
+	UpdateAlarm(a Alarm) error
+	RemoveAlarm(id int64) error
+	Snooze() (time.Time, error)
+	Stop() error
+	SetSleepMode(enabled bool) error
+	Status() (Status, error)
+}
+
+// Service is the exported object.
+type Service struct {
+	conn    *dbus.Conn
+	backend Backend
+	props   *prop.Properties
+}
+
+// Export registers the object, its properties and introspection data on conn and claims BusName.
+// The properties start out empty until the first Refresh.
+func Export(conn *dbus.Conn, backend Backend) (*Service, error) {
+	s := &Service{conn: conn, backend: backend}
+	obj := &alarmsObject{s: s}
+
+	if err := conn.Export(obj, ObjectPath, Interface); err != nil {
+		return nil, fmt.Errorf("failed to export %s: %w", Interface, err)
+	}
+
+	props, err := prop.Export(conn, ObjectPath, prop.Map{
+		Interface: {
+			"NextAlarm": {Value: int64(0), Emit: prop.EmitTrue},
+			"IsRinging": {Value: false, Emit: prop.EmitTrue},
+			"SleepMode": {Value: false, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export properties: %w", err)
+	}
+	s.props = props
+
+	node := &introspect.Node{
+		Name: string(ObjectPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       Interface,
+				Methods:    introspect.Methods(obj),
+				Properties: props.Introspection(Interface),
+				Signals:    signals,
+			},
+		},
+	}
+	if err := conn.Export(introspect.NewIntrospectable(node), ObjectPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return nil, fmt.Errorf("failed to export introspection: %w", err)
+	}
+
+	reply, err := conn.RequestName(BusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request %s: %w", BusName, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner && reply != dbus.RequestNameReplyAlreadyOwner {
+		return nil, fmt.Errorf("%s is already owned by another process", BusName)
+	}
+
+	return s, nil
+}
+
+// Connect exports the service on the session bus.
+func Connect(backend Backend) (*Service, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	s, err := Export(conn, backend)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Service) Close() error {
+	return s.conn.Close()
+}
+
+// Refresh re-reads the status from the backend and updates the properties,
+// which emits PropertiesChanged for those that changed.
+func (s *Service) Refresh() error {
+	status, err := s.backend.Status()
+	if err != nil {
+		return fmt.Errorf("failed to read status: %w", err)
+	}
+
+	next := int64(0)
+	if !status.NextAlarm.IsZero() {
+		next = status.NextAlarm.Unix()
+	}
+	s.setIfChanged("NextAlarm", next)
+	s.setIfChanged("IsRinging", status.IsRinging)
+	s.setIfChanged("SleepMode", status.SleepMode)
+	return nil
+}
+
+func (s *Service) setIfChanged(name string, v any) {
+	current, err := s.props.Get(Interface, name)
+	if err == nil && current.Value() == v {
+		return
+	}
+	s.props.SetMust(Interface, name, v)
+}
+
+// Emit sends one of the Signal constants with its arguments.
+func (s *Service) Emit(signal string, args ...any) error {
+	return s.conn.Emit(ObjectPath, Interface+"."+signal, args...)
+}
+
+var signals = []introspect.Signal{
+	{Name: SignalAlarmRinging, Args: []introspect.Arg{{Name: "alarm", Type: alarmSignature}}},
+	{Name: SignalSnoozed, Args: []introspect.Arg{{Name: "alarm", Type: alarmSignature}, {Name: "until", Type: "x"}}},
+	{Name: SignalDismissed, Args: []introspect.Arg{{Name: "alarm", Type: alarmSignature}}},
+	{Name: SignalSleepStarted, Args: []introspect.Arg{{Name: "start", Type: "x"}}},
+	{Name: SignalSleepEnded, Args: []introspect.Arg{{Name: "start", Type: "x"}, {Name: "end", Type: "x"}}},
+	{Name: SignalSessionSaved, Args: []introspect.Arg{{Name: "start", Type: "x"}, {Name: "end", Type: "x"}, {Name: "snoozes", Type: "i"}}},
+	{Name: SignalSettingsChanged, Args: []introspect.Arg{{Name: "key", Type: "s"}}},
+	{Name: SignalAlarmsChanged},
+	{Name: SignalNextAlarmChanged, Args: []introspect.Arg{{Name: "alarm", Type: alarmSignature}}},
+}
+
+// alarmsObject holds the exported methods; godbus maps every exported method to a D-Bus method.
+type alarmsObject struct {
+	s *Service
+}
+
+func (o *alarmsObject) ListAlarms() ([]Alarm, *dbus.Error) {
+	alarms, err := o.s.backend.ListAlarms()
+	if err != nil {
+		return nil, dbusError(err)
+	}
+	if alarms == nil {
+		alarms = []Alarm{}
+	}
+	return alarms, nil
+}
+
+func (o *alarmsObject) AddAlarm(hour, minute int32, label string, days uint8) (int64, *dbus.Error) {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, dbusError(fmt.Errorf("%w: invalid time %d:%02d", ErrInvalidArgs, hour, minute))
+	}
+	id, err := o.s.backend.AddAlarm(int(hour), int(minute), label, days)
+	if err != nil {
+		return 0, dbusError(err)
+	}
+	return id, o.s.refresh()
+}
+
+func (o *alarmsObject) UpdateAlarm(a Alarm) *dbus.Error {
+	if a.Hour < 0 || a.Hour > 23 || a.Minute < 0 || a.Minute > 59 {
+		return dbusError(fmt.Errorf("%w: invalid time %d:%02d", ErrInvalidArgs, a.Hour, a.Minute))
+	}
+	if err := o.s.backend.UpdateAlarm(a); err != nil {
+		return dbusError(err)
+	}
+	return o.s.refresh()
+}
+
+func (o *alarmsObject) RemoveAlarm(id int64) *dbus.Error {
+	if err := o.s.backend.RemoveAlarm(id); err != nil {
+		return dbusError(err)
+	}
+	return o.s.refresh()
+}
+
+func (o *alarmsObject) Snooze() (int64, *dbus.Error) {
+	until, err := o.s.backend.Snooze()
+	if err != nil {
+		return 0, dbusError(err)
+	}
+	return until.Unix(), o.s.refresh()
+}
+
+func (o *alarmsObject) Stop() *dbus.Error {
+	if err := o.s.backend.Stop(); err != nil {
+		return dbusError(err)
+	}
+	return o.s.refresh()
+}
+
+func (o *alarmsObject) StartSleep() *dbus.Error {
+	if err := o.s.backend.SetSleepMode(true); err != nil {
+		return dbusError(err)
+	}
+	return o.s.refresh()
+}
+
+func (o *alarmsObject) StopSleep() *dbus.Error {
+	if err := o.s.backend.SetSleepMode(false); err != nil {
+		return dbusError(err)
+	}
+	return o.s.refresh()
+}
+
+func (s *Service) refresh() *dbus.Error {
+	if err := s.Refresh(); err != nil {
+		return dbusError(err)
+	}
+	return nil
+}
+
+func dbusError(err error) *dbus.Error {
+	name := "Failed"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		name = "NotFound"
+	case errors.Is(err, ErrRefused):
+		name = "Refused"
+	case errors.Is(err, ErrInvalidArgs):
+		name = "InvalidArgs"
+	}
+	return dbus.NewError(errorPrefix+name, []any{err.Error()})
+}
@@ -0,0 +1,283 @@
+package dbusapi
+
+import (
+	"bufio"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// startBus runs a private session bus for the test and returns its address.
+func startBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--nopidfile", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe failed: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("Failed to connect to private bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+type fakeBackend struct {
+	mu      sync.Mutex
+	alarms  []Alarm
+	nextID  int64
+	ringing bool
+	sleep   bool
+}
+
+func (f *fakeBackend) ListAlarms() ([]Alarm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Alarm(nil), f.alarms...), nil
+}
+
+func (f *fakeBackend) AddAlarm(hour, minute int, label string, days uint8) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	f.alarms = append(f.alarms, Alarm{ID: f.nextID, Hour: int32(hour), Minute: int32(minute), Enabled: true, Label: label, Days: days})
+	return f.nextID, nil
+}
+
+func (f *fakeBackend) UpdateAlarm(a Alarm) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.alarms {
+		if f.alarms[i].ID == a.ID {
+			f.alarms[i] = a
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (f *fakeBackend) RemoveAlarm(id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.alarms {
+		if f.alarms[i].ID == id {
+			f.alarms = append(f.alarms[:i], f.alarms[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (f *fakeBackend) Snooze() (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.ringing {
+		return time.Time{}, errors.Join(ErrRefused, errors.New("no alarm is ringing"))
+	}
+	f.ringing = false
+	return time.Unix(1700000000, 0), nil
+}
+
+func (f *fakeBackend) Stop() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ringing = false
+	return nil
+}
+
+func (f *fakeBackend) SetSleepMode(enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sleep = enabled
+	return nil
+}
+
+func (f *fakeBackend) Status() (Status, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var status Status
+	status.IsRinging = f.ringing
+	status.SleepMode = f.sleep
+	if len(f.alarms) > 0 {
+		status.NextAlarm = time.Unix(1700000000+int64(f.alarms[0].Hour)*3600, 0)
+	}
+	return status, nil
+}
+
+func startService(t *testing.T) (*fakeBackend, *Service, dbus.BusObject, *dbus.Conn) {
+	t.Helper()
+	address := startBus(t)
+
+	backend := &fakeBackend{}
+	svc, err := Export(connect(t, address), backend)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	client := connect(t, address)
+	return backend, svc, client.Object(BusName, ObjectPath), client
+}
+
+func TestService_AlarmMethods(t *testing.T) {
+	_, _, obj, _ := startService(t)
+
+	var id int64
+	if err := obj.Call(Interface+".AddAlarm", 0, int32(6), int32(30), "Gym", uint8(0x3e)).Store(&id); err != nil {
+		t.Fatalf("AddAlarm failed: %v", err)
+	}
+
+	var alarms []Alarm
+	if err := obj.Call(Interface+".ListAlarms", 0).Store(&alarms); err != nil {
+		t.Fatalf("ListAlarms failed: %v", err)
+	}
+	if len(alarms) != 1 || alarms[0].ID != id || alarms[0].Label != "Gym" || alarms[0].Days != 0x3e {
+		t.Fatalf("Unexpected alarms %+v", alarms)
+	}
+
+	updated := alarms[0]
+	updated.Enabled = false
+	if err := obj.Call(Interface+".UpdateAlarm", 0, updated).Err; err != nil {
+		t.Fatalf("UpdateAlarm failed: %v", err)
+	}
+
+	if err := obj.Call(Interface+".RemoveAlarm", 0, id).Err; err != nil {
+		t.Fatalf("RemoveAlarm failed: %v", err)
+	}
+
+	err := obj.Call(Interface+".RemoveAlarm", 0, id).Err
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) || dbusErr.Name != errorPrefix+"NotFound" {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	err = obj.Call(Interface+".AddAlarm", 0, int32(25), int32(0), "", uint8(0)).Err
+	if !errors.As(err, &dbusErr) || dbusErr.Name != errorPrefix+"InvalidArgs" {
+		t.Errorf("Expected InvalidArgs, got %v", err)
+	}
+}
+
+func TestService_PropertiesFollowState(t *testing.T) {
+	backend, svc, obj, _ := startService(t)
+
+	prop, err := obj.GetProperty(Interface + ".IsRinging")
+	if err != nil {
+		t.Fatalf("GetProperty failed: %v", err)
+	}
+	if prop.Value() != false {
+		t.Errorf("Expected IsRinging false, got %v", prop.Value())
+	}
+
+	backend.mu.Lock()
+	backend.ringing = true
+	backend.mu.Unlock()
+	if err := svc.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	prop, _ = obj.GetProperty(Interface + ".IsRinging")
+	if prop.Value() != true {
+		t.Errorf("Expected IsRinging true, got %v", prop.Value())
+	}
+
+	var until int64
+	if err := obj.Call(Interface+".Snooze", 0).Store(&until); err != nil {
+		t.Fatalf("Snooze failed: %v", err)
+	}
+	if until != 1700000000 {
+		t.Errorf("Expected snooze until 1700000000, got %d", until)
+	}
+	prop, _ = obj.GetProperty(Interface + ".IsRinging")
+	if prop.Value() != false {
+		t.Errorf("Expected IsRinging false after snooze, got %v", prop.Value())
+	}
+
+	err = obj.Call(Interface+".Snooze", 0).Err
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) || dbusErr.Name != errorPrefix+"Refused" {
+		t.Errorf("Expected Refused, got %v", err)
+	}
+
+	if err := obj.Call(Interface+".StartSleep", 0).Err; err != nil {
+		t.Fatalf("StartSleep failed: %v", err)
+	}
+	prop, _ = obj.GetProperty(Interface + ".SleepMode")
+	if prop.Value() != true {
+		t.Errorf("Expected SleepMode true, got %v", prop.Value())
+	}
+
+	if _, err := obj.GetProperty(Interface + ".NextAlarm"); err != nil {
+		t.Errorf("Expected NextAlarm to be readable, got %v", err)
+	}
+}
+
+func TestService_EmitsSignals(t *testing.T) {
+	_, svc, _, client := startService(t)
+
+	if err := client.AddMatchSignal(dbus.WithMatchInterface(Interface)); err != nil {
+		t.Fatalf("AddMatchSignal failed: %v", err)
+	}
+	signals := make(chan *dbus.Signal, 4)
+	client.Signal(signals)
+
+	alarm := Alarm{ID: 3, Hour: 6, Minute: 30, Enabled: true, Label: "Gym"}
+	if err := svc.Emit(SignalAlarmRinging, alarm); err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+
+	select {
+	case sig := <-signals:
+		if sig.Name != Interface+"."+SignalAlarmRinging {
+			t.Fatalf("Expected %s, got %s", SignalAlarmRinging, sig.Name)
+		}
+		var got Alarm
+		if err := dbus.Store(sig.Body, &got); err != nil {
+			t.Fatalf("Failed to decode signal: %v", err)
+		}
+		if got != alarm {
+			t.Errorf("Expected %+v, got %+v", alarm, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Signal was not received")
+	}
+}
+
+func TestService_Introspection(t *testing.T) {
+	_, _, obj, _ := startService(t)
+
+	var xml string
+	if err := obj.Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&xml); err != nil {
+		t.Fatalf("Introspect failed: %v", err)
+	}
+	for _, want := range []string{Interface, "ListAlarms", "StartSleep", "NextAlarm", SignalNextAlarmChanged} {
+		if !strings.Contains(xml, want) {
+			t.Errorf("Expected introspection to mention %s", want)
+		}
+	}
+}
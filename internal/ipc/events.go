@@ -0,0 +1,256 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CmdSubscribe turns the connection into a stream of Event frames after its reply.
+const CmdSubscribe = "subscribe"
+
+// Event types published to subscribers.
+const (
+	EventAlarmRinging     = "alarm_ringing"
+	EventSnoozed          = "snoozed"
+	EventDismissed        = "dismissed"
+	EventSleepStarted     = "sleep_started"
+	EventSleepEnded       = "sleep_ended"
+	EventSessionSaved     = "session_saved"
+	EventSettingsChanged  = "settings_changed"
+	EventNextAlarmChanged = "next_alarm_changed"
+	EventAlarmMissed      = "alarm_missed"
+)
+
+var eventTypes = []string{
+	EventAlarmRinging,
+	EventSnoozed,
+	EventDismissed,
+	EventSleepStarted,
+	EventSleepEnded,
+	EventSessionSaved,
+	EventSettingsChanged,
+	EventNextAlarmChanged,
+	EventAlarmMissed,
+}
+
+// subscriberBuffer is how many events may queue for one subscriber before it is
+// considered too slow and dropped.
+const subscriberBuffer = 64
+
+// writeTimeout bounds how long a single event may take to reach a subscriber.
+const writeTimeout = 5 * time.Second
+
+// Event is one state change pushed to subscribers.
+type Event struct {
+	Version int             `json:"version"`
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// SubscribeArgs limits a subscription to some event types. No types means all of them.
+type SubscribeArgs struct {
+	Events []string `json:"events,omitempty"`
+}
+
+// SnoozedEvent is the data of EventSnoozed.
+type SnoozedEvent struct {
+	Alarm *AlarmInfo `json:"alarm,omitempty"`
+	Until time.Time  `json:"until"`
+}
+
+// SleepEvent is the data of EventSleepStarted and EventSleepEnded.
+type SleepEvent struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// SessionEvent is the data of EventSessionSaved.
+type SessionEvent struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	SnoozeCount int       `json:"snooze_count"`
+}
+
+// SettingEvent is the data of EventSettingsChanged. Key is empty when a backup import
+// may have changed any setting.
+type SettingEvent struct {
+	Key string `json:"key"`
+}
+
+// NextAlarmEvent is the data of EventNextAlarmChanged. Alarm is nil when no alarm is scheduled.
+type NextAlarmEvent struct {
+	Alarm *AlarmInfo `json:"alarm,omitempty"`
+}
+
+// MissedEvent is the data of EventAlarmMissed.
+type MissedEvent struct {
+	Alarm       AlarmInfo `json:"alarm"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	RangLate    bool      `json:"rang_late"`
+}
+
+type subscriber struct {
+	events  chan Event
+	filter  []string
+	dropped chan struct{}
+	once    sync.Once
+}
+
+func (sub *subscriber) wants(eventType string) bool {
+	return len(sub.filter) == 0 || slices.Contains(sub.filter, eventType)
+}
+
+func (sub *subscriber) drop() {
+	sub.once.Do(func() { close(sub.dropped) })
+}
+
+// Publish sends an event to every subscriber that wants it. It never blocks:
+// a subscriber whose queue is full is dropped.
+func (s *Server) Publish(eventType string, data any) {
+	ev := Event{Version: ProtocolVersion, Type: eventType, Time: time.Now()}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("IPC failed to encode %s event: %v", eventType, err)
+			return
+		}
+		ev.Data = raw
+	}
+
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for sub := range s.subscribers {
+		if !sub.wants(eventType) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			log.Println("IPC dropping slow subscriber")
+			delete(s.subscribers, sub)
+			sub.drop()
+		}
+	}
+}
+
+// SubscriberCount returns how many clients are currently subscribed.
+func (s *Server) SubscriberCount() int {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	return len(s.subscribers)
+}
+
+func (s *Server) addSubscriber(filter []string) *subscriber {
+	sub := &subscriber{
+		events:  make(chan Event, subscriberBuffer),
+		filter:  filter,
+		dropped: make(chan struct{}),
+	}
+	s.subMu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.subMu.Unlock()
+	return sub
+}
+
+func (s *Server) removeSubscriber(sub *subscriber) {
+	s.subMu.Lock()
+	delete(s.subscribers, sub)
+	s.subMu.Unlock()
+	sub.drop()
+}
+
+// serveSubscription answers a subscribe request and then streams events until
+// the client goes away or falls behind.
+func (s *Server) serveSubscription(conn net.Conn, r *bufio.Reader, req Request) {
+	resp := Response{Version: ProtocolVersion, ID: req.ID}
+
+	var args SubscribeArgs
+	if len(req.Args) > 0 {
+		if err := DecodeArgs(req.Args, &args); err != nil {
+			resp.Error = err.(*Error)
+		}
+	}
+	for _, t := range args.Events {
+		if resp.Error == nil && !slices.Contains(eventTypes, t) {
+			resp.Error = Errorf(ErrInvalidArgs, "unknown event type %q", t)
+		}
+	}
+	if resp.Error != nil {
+		WriteFrame(conn, resp)
+		return
+	}
+
+	sub := s.addSubscriber(args.Events)
+	defer s.removeSubscriber(sub)
+
+	if err := WriteFrame(conn, resp); err != nil {
+		return
+	}
+
+	// Subscribers do not send anything else; reading only notices when they hang up.
+	go func() {
+		io.Copy(io.Discard, r)
+		sub.drop()
+	}()
+
+	for {
+		select {
+		case <-sub.dropped:
+			return
+		case ev := <-sub.events:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := WriteFrame(conn, ev); err != nil {
+				log.Printf("IPC subscriber write error: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// Subscription receives events from the daemon.
+type Subscription struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Subscribe opens a new connection to path and subscribes it to the given event types, or to all when none are given.
+func Subscribe(path string, events ...string) (*Subscription, error) {
+	c, err := Dial(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Call(CmdSubscribe, SubscribeArgs{Events: events}, nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &Subscription{conn: c.conn, r: c.r}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF once the daemon
+// closes the stream, for example because this subscriber fell behind.
+func (s *Subscription) Next() (Event, error) {
+	var ev Event
+	if err := ReadFrame(s.r, &ev); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Event{}, err
+	}
+	if ev.Version > ProtocolVersion {
+		return ev, fmt.Errorf("event version %d is newer than supported %d", ev.Version, ProtocolVersion)
+	}
+	return ev, nil
+}
+
+func (s *Subscription) Close() error {
+	return s.conn.Close()
+}
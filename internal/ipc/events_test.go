@@ -0,0 +1,118 @@
+package ipc
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func subscribeTest(t *testing.T, path string, events ...string) *Subscription {
+	t.Helper()
+	sub, err := Subscribe(path, events...)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { sub.Close() })
+	return sub
+}
+
+func waitForSubscribers(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.SubscriberCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscribers, got %d", n, s.SubscriberCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribe_FansOutToAllSubscribers(t *testing.T) {
+	s, path := startTestServer(t)
+
+	all := subscribeTest(t, path)
+	sleepOnly := subscribeTest(t, path, EventSleepStarted)
+	waitForSubscribers(t, s, 2)
+
+	s.Publish(EventAlarmRinging, AlarmInfo{ID: 3, Hour: 6, Minute: 30})
+	s.Publish(EventSleepStarted, SleepEvent{Start: time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)})
+
+	ev, err := all.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if ev.Type != EventAlarmRinging || !strings.Contains(string(ev.Data), `"id":3`) {
+		t.Errorf("Expected alarm_ringing for alarm 3, got %s %s", ev.Type, ev.Data)
+	}
+	if ev, _ := all.Next(); ev.Type != EventSleepStarted {
+		t.Errorf("Expected sleep_started, got %s", ev.Type)
+	}
+
+	if ev, _ := sleepOnly.Next(); ev.Type != EventSleepStarted {
+		t.Errorf("Expected the filtered subscriber to only get sleep_started, got %s", ev.Type)
+	}
+}
+
+func TestSubscribe_RejectsUnknownEvent(t *testing.T) {
+	_, path := startTestServer(t)
+
+	_, err := Subscribe(path, "alarm_exploded")
+	if !IsCode(err, ErrInvalidArgs) {
+		t.Errorf("Expected %s, got %v", ErrInvalidArgs, err)
+	}
+}
+
+func TestSubscribe_DropsSlowSubscriber(t *testing.T) {
+	s, path := startTestServer(t)
+
+	slow := subscribeTest(t, path)
+	waitForSubscribers(t, s, 1)
+
+	// The slow subscriber never reads, so the socket fills up, then its queue.
+	payload := SettingEvent{Key: strings.Repeat("x", 4096)}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.SubscriberCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Slow subscriber was never dropped")
+		}
+		for i := 0; i < 100; i++ {
+			s.Publish(EventSettingsChanged, payload)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Publishing keeps working for everyone else.
+	fast := subscribeTest(t, path)
+	waitForSubscribers(t, s, 1)
+	s.Publish(EventDismissed, nil)
+	if ev, err := fast.Next(); err != nil || ev.Type != EventDismissed {
+		t.Errorf("Expected dismissed, got %s (%v)", ev.Type, err)
+	}
+
+	// The dropped stream ends after what was already in flight.
+	for {
+		_, err := slow.Next()
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("Expected io.EOF, got %v", err)
+		}
+		break
+	}
+}
+
+func TestSubscribe_ClientHangupUnsubscribes(t *testing.T) {
+	s, path := startTestServer(t)
+
+	sub, err := Subscribe(path)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	waitForSubscribers(t, s, 1)
+
+	sub.Close()
+	waitForSubscribers(t, s, 0)
+}
@@ -1,10 +1,16 @@
 package ipc
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/adrg/xdg"
 )
@@ -15,28 +21,41 @@ func GetSocketPath() (string, error) {
 	return xdg.RuntimeFile(SocketName)
 }
 
-func SendSignal(msg string) error {
-	path, err := GetSocketPath()
-	if err != nil {
-		return err
-	}
+// HandlerFunc runs a command and returns the value to send back as its result.
+// Returning an *Error keeps its code; any other error is reported as ErrInternal.
+type HandlerFunc func(args json.RawMessage) (any, error)
 
-	conn, err := net.Dial("unix", path)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
+// Server dispatches framed requests on a unix socket to registered handlers.
+// Peers that still send legacy newline messages are translated with ParseLegacy.
+type Server struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	listener net.Listener
 
-	_, err = conn.Write([]byte(msg + "\n"))
-	return err
+	subMu       sync.Mutex
+	subscribers map[*subscriber]struct{}
 }
 
-func StartListener(callback func(string)) error {
-	path, err := GetSocketPath()
-	if err != nil {
-		return err
+func NewServer() *Server {
+	s := &Server{
+		handlers:    make(map[string]HandlerFunc),
+		subscribers: make(map[*subscriber]struct{}),
 	}
+	s.Handle(CmdPing, func(json.RawMessage) (any, error) {
+		return nil, nil
+	})
+	return s
+}
+
+// Handle registers h for command, replacing any earlier handler.
+func (s *Server) Handle(command string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[command] = h
+}
 
+// Listen binds the socket at path, replacing a stale one, and serves it in the background.
+func (s *Server) Listen(path string) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 		return err
 	}
@@ -48,31 +67,229 @@ func StartListener(callback func(string)) error {
 		return err
 	}
 
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
 	go func() {
-		defer listener.Close()
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
 				log.Printf("IPC Accept error: %v", err)
 				continue
 			}
-			go handleConn(conn, callback)
+			go s.handleConn(conn)
 		}
 	}()
 
 	return nil
 }
 
-func handleConn(conn net.Conn, callback func(string)) {
+// Close stops accepting connections and ends all event streams.
+func (s *Server) Close() error {
+	s.subMu.Lock()
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		sub.drop()
+	}
+	s.subMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.listener = nil
+	return err
+}
+
+// StartServer serves s on the default socket path.
+func StartServer(s *Server) error {
+	path, err := GetSocketPath()
+	if err != nil {
+		return err
+	}
+	return s.Listen(path)
+}
+
+func (s *Server) handleConn(conn net.Conn) {
 	defer conn.Close()
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
+	r := bufio.NewReader(conn)
+
+	// Frames start with a length prefix whose first byte is zero for any frame we
+	// accept, while legacy messages start with a letter.
+	first, err := r.Peek(1)
 	if err != nil {
 		return
 	}
-	msg := string(buf[:n])
-	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
-		msg = msg[:len(msg)-1]
+	if first[0] != 0 {
+		s.handleLegacy(r)
+		return
+	}
+
+	for {
+		var req Request
+		if err := ReadFrame(r, &req); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("IPC read error: %v", err)
+				WriteFrame(conn, Response{Version: ProtocolVersion, Error: Errorf(ErrBadRequest, "%v", err)})
+			}
+			return
+		}
+		if req.Command == CmdSubscribe && req.Version >= 1 && req.Version <= ProtocolVersion {
+			s.serveSubscription(conn, r, req)
+			return
+		}
+		if err := WriteFrame(conn, s.dispatch(req)); err != nil {
+			log.Printf("IPC write error: %v", err)
+			return
+		}
+	}
+}
+
+func (s *Server) handleLegacy(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			req, perr := ParseLegacy(line)
+			if perr != nil {
+				log.Printf("IPC legacy message rejected: %v", perr)
+			} else if resp := s.dispatch(req); resp.Error != nil {
+				log.Printf("IPC legacy %s failed: %v", req.Command, resp.Error)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(req Request) Response {
+	resp := Response{Version: ProtocolVersion, ID: req.ID}
+
+	if req.Version < 1 || req.Version > ProtocolVersion {
+		resp.Error = Errorf(ErrUnsupportedVersion, "protocol version %d is not supported, want 1 to %d", req.Version, ProtocolVersion)
+		return resp
+	}
+
+	s.mu.RLock()
+	h, ok := s.handlers[req.Command]
+	s.mu.RUnlock()
+	if !ok {
+		resp.Error = Errorf(ErrUnknownCommand, "unknown command %q", req.Command)
+		return resp
+	}
+
+	result, err := h(req.Args)
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			e = Errorf(ErrInternal, "%v", err)
+		}
+		resp.Error = e
+		return resp
+	}
+
+	if result != nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = Errorf(ErrInternal, "failed to encode result: %v", err)
+			return resp
+		}
+		resp.Result = raw
+	}
+	return resp
+}
+
+// Client sends requests over one connection. It is safe for concurrent use.
+type Client struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	r      *bufio.Reader
+	nextID uint64
+}
+
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Call sends command with args and decodes the result into result, which may be nil.
+// Failures reported by the daemon are returned as *Error.
+func (c *Client) Call(command string, args, result any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	req := Request{Version: ProtocolVersion, ID: c.nextID, Command: command}
+	if args != nil {
+		raw, err := json.Marshal(args)
+		if err != nil {
+			return fmt.Errorf("failed to encode arguments: %w", err)
+		}
+		req.Args = raw
+	}
+
+	if err := WriteFrame(c.conn, req); err != nil {
+		return err
+	}
+
+	var resp Response
+	if err := ReadFrame(c.r, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.ID != req.ID {
+		return fmt.Errorf("response %d does not match request %d", resp.ID, req.ID)
+	}
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to decode result: %w", err)
+		}
+	}
+	return nil
+}
+
+// Call sends a single request to the daemon on the default socket.
+func Call(command string, args, result any) error {
+	path, err := GetSocketPath()
+	if err != nil {
+		return err
+	}
+
+	c, err := Dial(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.Call(command, args, result)
+}
+
+// SendSignal sends a legacy newline message such as "sleepModeChanged:true" as a framed request.
+//
+// Deprecated: use Call with one of the Cmd constants.
+func SendSignal(msg string) error {
+	req, err := ParseLegacy(msg)
+	if err != nil {
+		return err
+	}
+	var args any
+	if len(req.Args) > 0 {
+		args = req.Args
 	}
-	callback(msg)
+	return Call(req.Command, args, nil)
 }
@@ -0,0 +1,197 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func startTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "daemon.sock")
+
+	s := NewServer()
+	if err := s.Listen(path); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func dialTest(t *testing.T, path string) *Client {
+	t.Helper()
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCall_TypedArgsAndResult(t *testing.T) {
+	s, path := startTestServer(t)
+	s.Handle(CmdAlarmTriggered, func(raw json.RawMessage) (any, error) {
+		var args AlarmTriggeredArgs
+		if err := DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+		return args, nil
+	})
+
+	c := dialTest(t, path)
+	want := AlarmTriggeredArgs{Hour: 7, Minute: 5, Label: "Flight: AMS 04:30"}
+
+	// Several calls share one connection.
+	for i := 0; i < 3; i++ {
+		var got AlarmTriggeredArgs
+		if err := c.Call(CmdAlarmTriggered, want, &got); err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+}
+
+func TestCall_ErrorCodes(t *testing.T) {
+	s, path := startTestServer(t)
+	s.Handle("fails", func(json.RawMessage) (any, error) {
+		return nil, errors.New("disk on fire")
+	})
+	s.Handle("refuses", func(json.RawMessage) (any, error) {
+		return nil, Errorf(ErrRefused, "not now")
+	})
+	s.Handle(CmdSleepModeChanged, func(raw json.RawMessage) (any, error) {
+		var args EnabledArgs
+		return nil, DecodeArgs(raw, &args)
+	})
+
+	c := dialTest(t, path)
+
+	tests := []struct {
+		command string
+		args    any
+		want    ErrorCode
+	}{
+		{"no_such_command", nil, ErrUnknownCommand},
+		{"fails", nil, ErrInternal},
+		{"refuses", nil, ErrRefused},
+		{CmdSleepModeChanged, nil, ErrInvalidArgs},
+		{CmdSleepModeChanged, map[string]string{"enabled": "maybe"}, ErrInvalidArgs},
+	}
+
+	for _, tt := range tests {
+		err := c.Call(tt.command, tt.args, nil)
+		if !IsCode(err, tt.want) {
+			t.Errorf("%s: Expected %s, got %v", tt.command, tt.want, err)
+		}
+	}
+
+	if err := c.Call(CmdPing, nil, nil); err != nil {
+		t.Errorf("Expected ping to succeed after errors, got %v", err)
+	}
+}
+
+func TestServer_RejectsNewerVersion(t *testing.T) {
+	_, path := startTestServer(t)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := WriteFrame(conn, Request{Version: ProtocolVersion + 1, ID: 9, Command: CmdPing}); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	var resp Response
+	if err := ReadFrame(conn, &resp); err != nil {
+		t.Fatalf("ReadFrame failed: %v", err)
+	}
+	if resp.ID != 9 {
+		t.Errorf("Expected ID 9, got %d", resp.ID)
+	}
+	if resp.Error == nil || resp.Error.Code != ErrUnsupportedVersion {
+		t.Errorf("Expected %s, got %+v", ErrUnsupportedVersion, resp.Error)
+	}
+}
+
+func TestServer_AcceptsLegacyMessages(t *testing.T) {
+	s, path := startTestServer(t)
+
+	got := make(chan AlarmTriggeredArgs, 1)
+	s.Handle(CmdAlarmTriggered, func(raw json.RawMessage) (any, error) {
+		var args AlarmTriggeredArgs
+		if err := DecodeArgs(raw, &args); err != nil {
+			return nil, err
+		}
+		got <- args
+		return nil, nil
+	})
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if _, err := conn.Write([]byte("alarmTriggered:7:05\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	conn.Close()
+
+	select {
+	case args := <-got:
+		if args.Hour != 7 || args.Minute != 5 || args.Label != "" {
+			t.Errorf("Expected 7:05 without label, got %+v", args)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Legacy message was not dispatched")
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	tests := []struct {
+		msg     string
+		command string
+		args    string
+	}{
+		{"bedtimeChanged", CmdBedtimeChanged, ""},
+		{"bedtimeNotificationsChanged\n", CmdBedtimeNotificationsChanged, ""},
+		{"sleepModeChanged:true", CmdSleepModeChanged, `{"enabled":true}`},
+		{"smartWakeUpToggled:false", CmdSmartWakeUpToggled, `{"enabled":false}`},
+		{"alarmTriggered:7:05", CmdAlarmTriggered, `{"hour":7,"minute":5}`},
+		{"alarmTriggered:7:05:Flight: AMS 04:30", CmdAlarmTriggered, `{"hour":7,"minute":5,"label":"Flight: AMS 04:30"}`},
+	}
+
+	for _, tt := range tests {
+		req, err := ParseLegacy(tt.msg)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.msg, err)
+			continue
+		}
+		if req.Command != tt.command {
+			t.Errorf("%q: Expected command %s, got %s", tt.msg, tt.command, req.Command)
+		}
+		if string(req.Args) != tt.args {
+			t.Errorf("%q: Expected args %s, got %s", tt.msg, tt.args, req.Args)
+		}
+	}
+
+	for _, msg := range []string{"alarmTriggered:7", "sleepModeChanged:maybe", "whatever"} {
+		if _, err := ParseLegacy(msg); err == nil {
+			t.Errorf("%q: Expected an error", msg)
+		}
+	}
+}
+
+func TestReadFrame_RejectsOversizedFrame(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{0x7f, 0xff, 0xff, 0xff})
+	var req Request
+	if err := ReadFrame(buf, &req); err == nil {
+		t.Error("Expected an oversized frame to be rejected")
+	}
+}
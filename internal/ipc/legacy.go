@@ -0,0 +1,62 @@
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseLegacy translates a newline message from before the framed protocol,
+// such as "alarmTriggered:7:05" or "sleepModeChanged:true", into a Request.
+func ParseLegacy(msg string) (Request, error) {
+	msg = strings.TrimRight(msg, "\r\n")
+	name, payload, _ := strings.Cut(msg, ":")
+
+	var command string
+	var args any
+
+	switch name {
+	case "bedtimeChanged":
+		command = CmdBedtimeChanged
+	case "bedtimeNotificationsChanged":
+		command = CmdBedtimeNotificationsChanged
+	case "alarmTriggered":
+		// The label goes last because it may itself contain colons.
+		parts := strings.SplitN(payload, ":", 3)
+		if len(parts) < 2 {
+			return Request{}, Errorf(ErrBadRequest, "malformed alarmTriggered message %q", msg)
+		}
+		h, err1 := strconv.Atoi(parts[0])
+		m, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return Request{}, Errorf(ErrBadRequest, "malformed alarmTriggered message %q", msg)
+		}
+		a := AlarmTriggeredArgs{Hour: h, Minute: m}
+		if len(parts) == 3 {
+			a.Label = parts[2]
+		}
+		command, args = CmdAlarmTriggered, a
+	case "sleepModeChanged", "smartWakeUpToggled":
+		enabled, err := strconv.ParseBool(payload)
+		if err != nil {
+			return Request{}, Errorf(ErrBadRequest, "malformed %s message %q", name, msg)
+		}
+		command, args = CmdSleepModeChanged, EnabledArgs{Enabled: enabled}
+		if name == "smartWakeUpToggled" {
+			command = CmdSmartWakeUpToggled
+		}
+	default:
+		return Request{}, Errorf(ErrUnknownCommand, "unknown legacy message %q", msg)
+	}
+
+	req := Request{Version: ProtocolVersion, Command: command}
+	if args != nil {
+		raw, err := json.Marshal(args)
+		if err != nil {
+			return Request{}, fmt.Errorf("failed to encode arguments: %w", err)
+		}
+		req.Args = raw
+	}
+	return req, nil
+}
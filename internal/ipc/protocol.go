@@ -0,0 +1,200 @@
+package ipc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ProtocolVersion is the version of the framed JSON protocol spoken on the socket.
+// A peer rejects requests with a newer version than it understands.
+const ProtocolVersion = 1
+
+// maxFrameSize bounds a single frame so a broken peer cannot make us allocate without limit.
+const maxFrameSize = 1 << 20
+
+// Commands understood by the daemon.
+const (
+	CmdPing                        = "ping"
+	CmdAlarmTriggered              = "alarm_triggered"
+	CmdSleepModeChanged            = "sleep_mode_changed"
+	CmdSmartWakeUpToggled          = "smart_wake_up_toggled"
+	CmdBedtimeChanged              = "bedtime_changed"
+	CmdBedtimeNotificationsChanged = "bedtime_notifications_changed"
+
+	CmdListAlarms      = "list_alarms"
+	CmdAddAlarm        = "add_alarm"
+	CmdSetAlarmEnabled = "set_alarm_enabled"
+	CmdSnooze          = "snooze"
+	CmdStop            = "stop"
+	CmdStatus          = "status"
+	CmdSetSleepMode    = "set_sleep_mode"
+	CmdExportBackup    = "export_backup"
+	CmdImportBackup    = "import_backup"
+)
+
+// Request is one command sent to the daemon. ID is echoed in the matching Response.
+type Request struct {
+	Version int             `json:"version"`
+	ID      uint64          `json:"id"`
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args,omitempty"`
+}
+
+// Response answers a Request. Exactly one of Result and Error is meaningful.
+type Response struct {
+	Version int             `json:"version"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type ErrorCode string
+
+const (
+	ErrBadRequest         ErrorCode = "bad_request"
+	ErrUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrUnknownCommand     ErrorCode = "unknown_command"
+	ErrInvalidArgs        ErrorCode = "invalid_args"
+	ErrNotFound           ErrorCode = "not_found"
+	ErrRefused            ErrorCode = "refused"
+	ErrInternal           ErrorCode = "internal"
+)
+
+// Error is a failure reported by the other side of the socket.
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Errorf builds an Error with the given code.
+func Errorf(code ErrorCode, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// IsCode reports whether err is an Error with the given code.
+func IsCode(err error, code ErrorCode) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// AlarmTriggeredArgs describes the alarm that started ringing.
+type AlarmTriggeredArgs struct {
+	Hour   int    `json:"hour"`
+	Minute int    `json:"minute"`
+	Label  string `json:"label,omitempty"`
+}
+
+// EnabledArgs carries the new state of an on/off setting.
+type EnabledArgs struct {
+	Enabled bool `json:"enabled"`
+}
+
+// AlarmInfo is an alarm as reported to clients.
+type AlarmInfo struct {
+	ID      int64  `json:"id"`
+	Hour    int    `json:"hour"`
+	Minute  int    `json:"minute"`
+	Enabled bool   `json:"enabled"`
+	Label   string `json:"label,omitempty"`
+	// Repeat describes the schedule, e.g. "Weekdays", "Once" or a date.
+	Repeat string     `json:"repeat"`
+	Next   *time.Time `json:"next,omitempty"`
+}
+
+// AddAlarmArgs creates an alarm that repeats every day, like the editor's default.
+type AddAlarmArgs struct {
+	Hour   int    `json:"hour"`
+	Minute int    `json:"minute"`
+	Label  string `json:"label,omitempty"`
+}
+
+type SetAlarmEnabledArgs struct {
+	ID      int64 `json:"id"`
+	Enabled bool  `json:"enabled"`
+}
+
+// SnoozeReply tells when a snoozed alarm rings again.
+type SnoozeReply struct {
+	Until time.Time `json:"until"`
+}
+
+// StatusReply summarises what the daemon is doing.
+type StatusReply struct {
+	Ringing     *AlarmInfo `json:"ringing,omitempty"`
+	Snoozed     *AlarmInfo `json:"snoozed,omitempty"`
+	SnoozeUntil *time.Time `json:"snooze_until,omitempty"`
+	SleepMode   bool       `json:"sleep_mode"`
+	SleepStart  *time.Time `json:"sleep_start,omitempty"`
+	NextAlarm   *AlarmInfo `json:"next_alarm,omitempty"`
+}
+
+// ImportBackupArgs carries a backup as returned by CmdExportBackup. Mode is "merge" or "replace".
+type ImportBackupArgs struct {
+	Mode   string          `json:"mode"`
+	Backup json.RawMessage `json:"backup"`
+}
+
+// ImportBackupReply counts what an import wrote.
+type ImportBackupReply struct {
+	Alarms        int `json:"alarms"`
+	Settings      int `json:"settings"`
+	SleepSessions int `json:"sleep_sessions"`
+}
+
+// DecodeArgs unmarshals command arguments, reporting failures as ErrInvalidArgs.
+func DecodeArgs(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return Errorf(ErrInvalidArgs, "missing arguments")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return Errorf(ErrInvalidArgs, "%v", err)
+	}
+	return nil
+}
+
+// WriteFrame writes v as JSON prefixed with its length as a 4 byte big-endian integer.
+func WriteFrame(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %w", err)
+	}
+	if len(data) > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds limit", len(data))
+	}
+
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err = w.Write(buf)
+	return err
+}
+
+// ReadFrame reads one frame written by WriteFrame into v.
+func ReadFrame(r io.Reader, v any) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds limit", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode frame: %w", err)
+	}
+	return nil
+}
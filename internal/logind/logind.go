@@ -0,0 +1,122 @@
+// Package logind takes systemd-logind inhibitor locks, which keep the system from suspending.
+package logind
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busName    = "org.freedesktop.login1"
+	objectPath = dbus.ObjectPath("/org/freedesktop/login1")
+	managerIfc = "org.freedesktop.login1.Manager"
+)
+
+// Inhibitor modes. A block lock stops suspend outright, a delay lock only postpones it briefly.
+const (
+	ModeBlock = "block"
+	ModeDelay = "delay"
+)
+
+// Lock is a held inhibitor.
+type Lock interface {
+	Release() error
+}
+
+// Inhibitor is the part of the logind manager used here, so tests can replace it.
+type Inhibitor interface {
+	Inhibit(what, who, why, mode string) (Lock, error)
+}
+
+// Manager calls org.freedesktop.login1.Manager over D-Bus.
+type Manager struct {
+	obj dbus.BusObject
+}
+
+func NewManager(conn *dbus.Conn) *Manager {
+	return &Manager{obj: conn.Object(busName, objectPath)}
+}
+
+// Connect returns a Manager on the system bus.
+func Connect() (*Manager, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+	return NewManager(conn), nil
+}
+
+// Inhibit takes a lock on what ("sleep", "shutdown", ...). The lock lasts until it is released.
+func (m *Manager) Inhibit(what, who, why, mode string) (Lock, error) {
+	var fd dbus.UnixFD
+	if err := m.obj.Call(managerIfc+".Inhibit", 0, what, who, why, mode).Store(&fd); err != nil {
+		return nil, fmt.Errorf("failed to take %s inhibitor: %w", mode, err)
+	}
+	return fileLock{os.NewFile(uintptr(fd), "inhibitor")}, nil
+}
+
+// fileLock is the file descriptor logind hands out; closing it releases the lock.
+type fileLock struct {
+	f *os.File
+}
+
+func (l fileLock) Release() error {
+	return l.f.Close()
+}
+
+// Guard holds a sleep inhibitor while it is wanted.
+type Guard struct {
+	inhibitor Inhibitor
+	who, why  string
+
+	mu   sync.Mutex
+	lock Lock
+}
+
+func NewGuard(inhibitor Inhibitor, who, why string) *Guard {
+	return &Guard{inhibitor: inhibitor, who: who, why: why}
+}
+
+// Set takes the inhibitor when held is true and releases it otherwise. It prefers a
+// block lock and settles for a delay lock when logind does not allow blocking.
+func (g *Guard) Set(held bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !held {
+		if g.lock == nil {
+			return nil
+		}
+		err := g.lock.Release()
+		g.lock = nil
+		if err != nil {
+			return fmt.Errorf("failed to release inhibitor: %w", err)
+		}
+		return nil
+	}
+
+	if g.lock != nil {
+		return nil
+	}
+	lock, err := g.inhibitor.Inhibit("sleep", g.who, g.why, ModeBlock)
+	if err != nil {
+		var delayErr error
+		lock, delayErr = g.inhibitor.Inhibit("sleep", g.who, g.why, ModeDelay)
+		if delayErr != nil {
+			return errors.Join(err, delayErr)
+		}
+	}
+	g.lock = lock
+	return nil
+}
+
+// Held reports whether the inhibitor is currently taken.
+func (g *Guard) Held() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lock != nil
+}
@@ -0,0 +1,180 @@
+package logind
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type fakeLock struct {
+	inh      *fakeInhibitor
+	released bool
+}
+
+func (l *fakeLock) Release() error {
+	l.released = true
+	l.inh.held--
+	return nil
+}
+
+type fakeInhibitor struct {
+	refuseBlock bool
+	modes       []string
+	held        int
+}
+
+func (f *fakeInhibitor) Inhibit(what, who, why, mode string) (Lock, error) {
+	f.modes = append(f.modes, mode)
+	if what != "sleep" {
+		return nil, errors.New("unexpected lock type " + what)
+	}
+	if mode == ModeBlock && f.refuseBlock {
+		return nil, errors.New("access denied")
+	}
+	f.held++
+	return &fakeLock{inh: f}, nil
+}
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		name        string
+		refuseBlock bool
+		wantModes   []string
+	}{
+		{name: "takes a block lock", wantModes: []string{ModeBlock}},
+		{name: "falls back to a delay lock", refuseBlock: true, wantModes: []string{ModeBlock, ModeDelay}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inh := &fakeInhibitor{refuseBlock: tt.refuseBlock}
+			g := NewGuard(inh, "circadia", "Alarm soon")
+
+			if err := g.Set(true); err != nil {
+				t.Fatalf("Set(true) failed: %v", err)
+			}
+			if err := g.Set(true); err != nil {
+				t.Fatalf("Second Set(true) failed: %v", err)
+			}
+			if !g.Held() || inh.held != 1 {
+				t.Errorf("Expected exactly one lock, got %d", inh.held)
+			}
+			if strings.Join(inh.modes, ",") != strings.Join(tt.wantModes, ",") {
+				t.Errorf("Expected modes %v, got %v", tt.wantModes, inh.modes)
+			}
+
+			if err := g.Set(false); err != nil {
+				t.Fatalf("Set(false) failed: %v", err)
+			}
+			if g.Held() || inh.held != 0 {
+				t.Errorf("Expected the lock to be released, %d held", inh.held)
+			}
+			if err := g.Set(false); err != nil {
+				t.Errorf("Releasing twice failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestGuard_BothRefused(t *testing.T) {
+	g := NewGuard(inhibitorFunc(func(what, who, why, mode string) (Lock, error) {
+		return nil, errors.New(mode + " refused")
+	}), "circadia", "Alarm soon")
+
+	if err := g.Set(true); err == nil {
+		t.Fatal("Expected an error when no lock can be taken")
+	}
+	if g.Held() {
+		t.Error("Expected no lock to be held")
+	}
+}
+
+type inhibitorFunc func(what, who, why, mode string) (Lock, error)
+
+func (f inhibitorFunc) Inhibit(what, who, why, mode string) (Lock, error) {
+	return f(what, who, why, mode)
+}
+
+// fakeLogind serves Inhibit on a private bus, handing out the read end of a pipe.
+type fakeLogind struct {
+	mu     sync.Mutex
+	calls  [][]string
+	reader *os.File
+	writer *os.File
+}
+
+func (f *fakeLogind) Inhibit(what, who, why, mode string) (dbus.UnixFD, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, []string{what, who, why, mode})
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, dbus.MakeFailedError(err)
+	}
+	f.reader, f.writer = r, w
+	return dbus.UnixFD(r.Fd()), nil
+}
+
+func TestManager_InhibitOverDBus(t *testing.T) {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--nopidfile", "--print-address=1")
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read bus address: %v", err)
+	}
+
+	server, err := dbus.Connect(strings.TrimSpace(address))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer server.Close()
+	fake := &fakeLogind{}
+	if err := server.Export(fake, objectPath, managerIfc); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if _, err := server.RequestName(busName, dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatalf("RequestName failed: %v", err)
+	}
+
+	client, err := dbus.Connect(strings.TrimSpace(address))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	lock, err := NewManager(client).Inhibit("sleep", "circadia", "Alarm soon", ModeBlock)
+	if err != nil {
+		t.Fatalf("Inhibit failed: %v", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	// The bus passed a duplicate, so only the copy we received keeps the pipe open.
+	fake.reader.Close()
+
+	if len(fake.calls) != 1 || strings.Join(fake.calls[0], "|") != "sleep|circadia|Alarm soon|block" {
+		t.Errorf("Unexpected Inhibit calls %v", fake.calls)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Errorf("Release failed: %v", err)
+	}
+	if _, err := fake.writer.Write([]byte("x")); err == nil {
+		t.Error("Expected the pipe to be closed after Release")
+	}
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busName          = "org.freedesktop.Notifications"
+	objectPath       = dbus.ObjectPath("/org/freedesktop/Notifications")
+	notificationsIfc = "org.freedesktop.Notifications"
+)
+
+// Urgency levels of the freedesktop notification specification.
+const (
+	urgencyNormal   byte = 1
+	urgencyCritical byte = 2
+)
+
+// DBus sends notifications to the freedesktop notification server.
+type DBus struct {
+	obj     dbus.BusObject
+	appName string
+	appIcon string
+
+	mu sync.Mutex
+	// ids maps our notification ids to the ones the server handed out.
+	ids map[string]uint32
+}
+
+// NewDBus returns a notifier on conn. appIcon is an icon name or path, and may be empty.
+func NewDBus(conn *dbus.Conn, appName, appIcon string) *DBus {
+	return &DBus{
+		obj:     conn.Object(busName, objectPath),
+		appName: appName,
+		appIcon: appIcon,
+		ids:     make(map[string]uint32),
+	}
+}
+
+// ConnectDBus returns a notifier on the session bus after checking that a notification
+// server is running.
+func ConnectDBus(appName, appIcon string) (*DBus, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	d := NewDBus(conn, appName, appIcon)
+	var name, vendor, version, spec string
+	if err := d.obj.Call(notificationsIfc+".GetServerInformation", 0).Store(&name, &vendor, &version, &spec); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to reach notification server: %w", err)
+	}
+	return d, nil
+}
+
+func (d *DBus) Send(id string, n Notification) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	urgency := urgencyNormal
+	// -1 leaves the timeout to the server, 0 keeps the notification until it is closed.
+	timeout := int32(-1)
+	if n.Urgent {
+		urgency = urgencyCritical
+		timeout = 0
+	}
+	hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(urgency)}
+
+	var serverID uint32
+	err := d.obj.Call(notificationsIfc+".Notify", 0,
+		d.appName, d.ids[id], d.appIcon, n.Title, n.Body, []string{}, hints, timeout,
+	).Store(&serverID)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	d.ids[id] = serverID
+	return nil
+}
+
+func (d *DBus) Withdraw(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	serverID, ok := d.ids[id]
+	if !ok {
+		return nil
+	}
+	delete(d.ids, id)
+	if err := d.obj.Call(notificationsIfc+".CloseNotification", 0, serverID).Err; err != nil {
+		return fmt.Errorf("failed to withdraw notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Package notify shows notifications to the user, on the desktop or in the log.
+package notify
+
+import (
+	"log"
+)
+
+// Notification is a message for the user.
+type Notification struct {
+	Title string
+	Body  string
+	// Urgent notifications stay on screen until they are withdrawn.
+	Urgent bool
+}
+
+// Notifier shows and withdraws notifications. A notification sent with the id of an
+// earlier one replaces it.
+type Notifier interface {
+	Send(id string, n Notification) error
+	Withdraw(id string) error
+}
+
+// Log writes notifications to a logger, for systems without a notification server.
+type Log struct {
+	// Logger defaults to the standard logger.
+	Logger *log.Logger
+}
+
+func (l Log) logger() *log.Logger {
+	if l.Logger == nil {
+		return log.Default()
+	}
+	return l.Logger
+}
+
+func (l Log) Send(id string, n Notification) error {
+	kind := "Notification"
+	if n.Urgent {
+		kind = "Urgent notification"
+	}
+	if n.Body == "" {
+		l.logger().Printf("%s [%s]: %s", kind, id, n.Title)
+	} else {
+		l.logger().Printf("%s [%s]: %s: %s", kind, id, n.Title, n.Body)
+	}
+	return nil
+}
+
+func (l Log) Withdraw(id string) error {
+	l.logger().Printf("Notification [%s] withdrawn", id)
+	return nil
+}
@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := Log{Logger: log.New(&buf, "", 0)}
+
+	l.Send("alarm", Notification{Title: "Gym", Body: "Wake up! It's 06:30.", Urgent: true})
+	l.Send("Wind Down", Notification{Title: "Wind Down"})
+	l.Withdraw("alarm")
+
+	want := "Urgent notification [alarm]: Gym: Wake up! It's 06:30.\n" +
+		"Notification [Wind Down]: Wind Down\n" +
+		"Notification [alarm] withdrawn\n"
+	if buf.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+type sent struct {
+	replaces uint32
+	summary  string
+	body     string
+	urgency  byte
+	timeout  int32
+}
+
+// fakeServer serves the freedesktop notification interface on a private bus.
+type fakeServer struct {
+	mu     sync.Mutex
+	nextID uint32
+	sent   []sent
+	closed []uint32
+}
+
+func (f *fakeServer) GetServerInformation() (string, string, string, string, *dbus.Error) {
+	return "fake", "circadia", "1", "1.2", nil
+}
+
+func (f *fakeServer) Notify(appName string, replaces uint32, icon, summary, body string, actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var urgency byte
+	hints["urgency"].Store(&urgency)
+	f.sent = append(f.sent, sent{replaces, summary, body, urgency, timeout})
+	if replaces != 0 {
+		return replaces, nil
+	}
+	f.nextID++
+	return f.nextID, nil
+}
+
+func (f *fakeServer) CloseNotification(id uint32) *dbus.Error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = append(f.closed, id)
+	return nil
+}
+
+func startBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--nopidfile", "--print-address=1")
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func TestDBus(t *testing.T) {
+	address := startBus(t)
+
+	server, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer server.Close()
+	fake := &fakeServer{}
+	if err := server.Export(fake, objectPath, notificationsIfc); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if _, err := server.RequestName(busName, dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatalf("RequestName failed: %v", err)
+	}
+
+	client, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	d := NewDBus(client, "Circadia", "io.github.shinyvision.Circadia")
+
+	if err := d.Send("alarm", Notification{Title: "Alarm", Body: "Wake up!", Urgent: true}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := d.Send("Wind Down", Notification{Title: "Wind Down", Body: "Bedtime in 30 minutes."}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := d.Send("alarm", Notification{Title: "Alarm", Body: "Still ringing", Urgent: true}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := d.Withdraw("alarm"); err != nil {
+		t.Fatalf("Withdraw failed: %v", err)
+	}
+	if err := d.Withdraw("alarm"); err != nil {
+		t.Errorf("Withdrawing twice failed: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	want := []sent{
+		{0, "Alarm", "Wake up!", urgencyCritical, 0},
+		{0, "Wind Down", "Bedtime in 30 minutes.", urgencyNormal, -1},
+		{1, "Alarm", "Still ringing", urgencyCritical, 0},
+	}
+	if len(fake.sent) != len(want) {
+		t.Fatalf("Expected %d notifications, got %+v", len(want), fake.sent)
+	}
+	for i := range want {
+		if fake.sent[i] != want[i] {
+			t.Errorf("Notification %d: expected %+v, got %+v", i, want[i], fake.sent[i])
+		}
+	}
+	if len(fake.closed) != 1 || fake.closed[0] != 1 {
+		t.Errorf("Expected notification 1 to be closed once, got %v", fake.closed)
+	}
+}
+
+func TestDBus_NoServer(t *testing.T) {
+	address := startBus(t)
+	client, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	if err := NewDBus(client, "Circadia", "").Send("alarm", Notification{Title: "Alarm"}); err == nil {
+		t.Error("Expected an error without a notification server")
+	}
+}
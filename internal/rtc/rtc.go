@@ -0,0 +1,178 @@
+// Package rtc programs the hardware real-time clock to resume a suspended device in time for an alarm.
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPath is the wakealarm attribute of the first RTC.
+const DefaultPath = "/sys/class/rtc/rtc0/wakealarm"
+
+// Waker arms or disarms a wake-up of the device from suspend.
+type Waker interface {
+	// SetWake makes the device resume at t, replacing an earlier wake-up.
+	SetWake(t time.Time) error
+	// ClearWake cancels the wake-up.
+	ClearWake() error
+}
+
+// Sysfs writes wake-ups to an RTC wakealarm file, which holds Unix seconds or is empty when disarmed.
+type Sysfs struct {
+	Path string
+}
+
+func NewSysfs(path string) *Sysfs {
+	return &Sysfs{Path: path}
+}
+
+func (s *Sysfs) SetWake(t time.Time) error {
+	// The kernel refuses a new time while one is armed, so disarm it first.
+	if err := s.ClearWake(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.Path, []byte(strconv.FormatInt(t.Unix(), 10)), 0); err != nil {
+		return fmt.Errorf("failed to set wakealarm: %w", err)
+	}
+	return nil
+}
+
+func (s *Sysfs) ClearWake() error {
+	if err := os.WriteFile(s.Path, []byte("0"), 0); err != nil {
+		return fmt.Errorf("failed to clear wakealarm: %w", err)
+	}
+	return nil
+}
+
+// Wake returns the armed wake-up, if any.
+func (s *Sysfs) Wake() (time.Time, bool, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to read wakealarm: %w", err)
+	}
+	val := strings.TrimSpace(string(data))
+	if val == "" || val == "0" {
+		return time.Time{}, false, nil
+	}
+	sec, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid wakealarm %q: %w", val, err)
+	}
+	return time.Unix(sec, 0), true, nil
+}
+
+// Writable reports whether the wakealarm file exists and this process may write it.
+func (s *Sysfs) Writable() bool {
+	f, err := os.OpenFile(s.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// SystemdUnit is the name of the transient timer Systemd creates.
+const SystemdUnit = "circadia-wake"
+
+// ErrUnsupported is returned when the device cannot be woken from suspend: by New, or by
+// the first SetWake of a Systemd waker that may not start a wake timer.
+var ErrUnsupported = errors.New("waking from suspend is not supported")
+
+// Systemd arms a transient system timer with WakeSystem=yes through systemd-run, for
+// systems where the wakealarm file is only writable by root. User timers cannot wake the
+// system, so this needs polkit to let the user manage system units without a password.
+type Systemd struct {
+	// Run executes a command and returns its output; it defaults to running it with os/exec.
+	Run func(name string, args ...string) (string, error)
+
+	// verified is set once a timer was started and got WakeSystem=yes.
+	verified bool
+}
+
+func NewSystemd() *Systemd {
+	return &Systemd{Run: runCommand}
+}
+
+func runCommand(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// SetWake starts the timer. Until one has been started and read back with WakeSystem=yes,
+// failures are reported as ErrUnsupported, since waking then never worked.
+func (s *Systemd) SetWake(t time.Time) error {
+	if err := s.ClearWake(); err != nil {
+		return err
+	}
+	_, err := s.Run("systemd-run", "--no-ask-password",
+		"--unit="+SystemdUnit,
+		"--on-calendar="+t.UTC().Format("2006-01-02 15:04:05 UTC"),
+		"--timer-property=WakeSystem=yes",
+		"--timer-property=AccuracySec=1s",
+		"true")
+	if err != nil && !s.verified {
+		return fmt.Errorf("%w: failed to start wake timer: %v", ErrUnsupported, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start wake timer: %w", err)
+	}
+	if s.verified {
+		return nil
+	}
+
+	out, err := s.Run("systemctl", "show", "--property=WakeSystem", "--value", SystemdUnit+".timer")
+	if err == nil && strings.TrimSpace(out) != "yes" {
+		err = fmt.Errorf("wake timer has WakeSystem=%s", strings.TrimSpace(out))
+	}
+	if err != nil {
+		s.ClearWake()
+		return fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	s.verified = true
+	return nil
+}
+
+// ClearWake stops the timer. Stopping a timer that does not exist is not an error.
+func (s *Systemd) ClearWake() error {
+	if _, err := s.Run("systemctl", "--no-ask-password", "stop", SystemdUnit+".timer"); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil
+		}
+		return fmt.Errorf("failed to stop wake timer: %w", err)
+	}
+	return nil
+}
+
+// Check reports whether systemd-run can be run, which it cannot in Flatpak. It changes
+// nothing; whether a wake timer may be started shows at the first SetWake.
+func (s *Systemd) Check() error {
+	if _, err := s.Run("systemd-run", "--version"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// New returns a Sysfs waker for path if it can be written, and a Systemd waker if its
+// Check passes. It may run a command, so call it off the main loop.
+func New(path string) (Waker, error) {
+	return newWaker(path, NewSystemd())
+}
+
+func newWaker(path string, systemd *Systemd) (Waker, error) {
+	if s := NewSysfs(path); s.Writable() {
+		return s, nil
+	}
+	if err := systemd.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %s is not writable and %v", ErrUnsupported, path, err)
+	}
+	return systemd, nil
+}
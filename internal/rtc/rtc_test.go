@@ -0,0 +1,180 @@
+package rtc
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeWakealarm creates a file that stands in for /sys/class/rtc/rtc0/wakealarm.
+func fakeWakealarm(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wakealarm")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Failed to create fake wakealarm: %v", err)
+	}
+	return path
+}
+
+func TestSysfs_SetAndClear(t *testing.T) {
+	s := NewSysfs(fakeWakealarm(t))
+
+	if _, ok, err := s.Wake(); err != nil || ok {
+		t.Fatalf("Expected no wake-up initially, got ok=%v err=%v", ok, err)
+	}
+
+	at := time.Date(2024, 1, 2, 6, 25, 0, 0, time.UTC)
+	if err := s.SetWake(at); err != nil {
+		t.Fatalf("SetWake failed: %v", err)
+	}
+	got, ok, err := s.Wake()
+	if err != nil || !ok || !got.Equal(at) {
+		t.Errorf("Expected wake-up at %v, got %v ok=%v err=%v", at, got, ok, err)
+	}
+
+	data, _ := os.ReadFile(s.Path)
+	if string(data) != "1704176700" {
+		t.Errorf("Expected Unix seconds in the file, got %q", data)
+	}
+
+	if err := s.SetWake(at.Add(time.Hour)); err != nil {
+		t.Fatalf("SetWake over an armed wake-up failed: %v", err)
+	}
+	if got, _, _ := s.Wake(); !got.Equal(at.Add(time.Hour)) {
+		t.Errorf("Expected the wake-up to be replaced, got %v", got)
+	}
+
+	if err := s.ClearWake(); err != nil {
+		t.Fatalf("ClearWake failed: %v", err)
+	}
+	if _, ok, _ := s.Wake(); ok {
+		t.Error("Expected no wake-up after ClearWake")
+	}
+}
+
+func TestSysfs_MissingFile(t *testing.T) {
+	s := NewSysfs(filepath.Join(t.TempDir(), "rtc9", "wakealarm"))
+	if s.Writable() {
+		t.Error("Expected a missing wakealarm not to be writable")
+	}
+	if err := s.SetWake(time.Now()); err == nil {
+		t.Error("Expected SetWake to fail without a wakealarm file")
+	}
+}
+
+// fakeSystemctl records commands and answers them like systemd would: systemd-run is
+// missing when installed is false, refuses to start units unless allowed, and the started
+// timer reports wakeSystem.
+type fakeSystemctl struct {
+	calls      []string
+	installed  bool
+	allowed    bool
+	wakeSystem string
+	running    bool
+}
+
+func (f *fakeSystemctl) run(name string, args ...string) (string, error) {
+	f.calls = append(f.calls, name+" "+strings.Join(args, " "))
+	switch {
+	case name == "systemd-run" && !f.installed:
+		return "", exec.ErrNotFound
+	case name == "systemd-run" && args[0] == "--version":
+		return "systemd 255\n", nil
+	case name == "systemd-run" && !f.allowed:
+		return "", errors.New("systemd-run failed: Interactive authentication required")
+	case name == "systemd-run":
+		f.running = true
+	case args[len(args)-2] == "stop":
+		if !f.running {
+			// systemctl exits non-zero when the timer is not loaded.
+			return "", exec.Command("false").Run()
+		}
+		f.running = false
+	case args[0] == "show":
+		return f.wakeSystem + "\n", nil
+	}
+	return "", nil
+}
+
+func TestNew_PrefersSysfs(t *testing.T) {
+	fake := &fakeSystemctl{installed: true, allowed: true, wakeSystem: "yes"}
+	if w, err := newWaker(fakeWakealarm(t), &Systemd{Run: fake.run}); err != nil {
+		t.Errorf("Expected a writable wakealarm to be used directly, got %v", err)
+	} else if _, ok := w.(*Sysfs); !ok {
+		t.Errorf("Expected a writable wakealarm to be used directly, got %T", w)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("Expected no commands, got %q", fake.calls)
+	}
+
+	w, err := newWaker(filepath.Join(t.TempDir(), "missing"), &Systemd{Run: fake.run})
+	if _, ok := w.(*Systemd); !ok || err != nil {
+		t.Errorf("Expected the systemd timer as a fallback, got %T and %v", w, err)
+	}
+	if len(fake.calls) != 1 || fake.calls[0] != "systemd-run --version" {
+		t.Errorf("Expected only systemd-run to be looked for, got %q", fake.calls)
+	}
+}
+
+func TestNew_Unsupported(t *testing.T) {
+	fake := &fakeSystemctl{}
+	w, err := newWaker(filepath.Join(t.TempDir(), "missing"), &Systemd{Run: fake.run})
+	if w != nil || !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported, got %T and %v", w, err)
+	}
+}
+
+func TestSystemd_FirstWakeUnsupported(t *testing.T) {
+	tests := map[string]*fakeSystemctl{
+		"not allowed":   {installed: true},
+		"no WakeSystem": {installed: true, allowed: true, wakeSystem: "no"},
+	}
+	for name, fake := range tests {
+		s := &Systemd{Run: fake.run}
+		if err := s.SetWake(time.Now().Add(time.Hour)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, got %v", name, err)
+		}
+		if fake.running {
+			t.Errorf("%s: expected no timer left running", name)
+		}
+	}
+}
+
+func TestSystemd_Commands(t *testing.T) {
+	fake := &fakeSystemctl{installed: true, allowed: true, wakeSystem: "yes"}
+	s := &Systemd{Run: fake.run}
+
+	at := time.Date(2024, 1, 2, 6, 25, 0, 0, time.UTC)
+	if err := s.SetWake(at); err != nil {
+		t.Fatalf("SetWake failed: %v", err)
+	}
+	if err := s.SetWake(at.Add(time.Hour)); err != nil {
+		t.Fatalf("SetWake failed: %v", err)
+	}
+
+	want := []string{
+		"systemctl --no-ask-password stop circadia-wake.timer",
+		"systemd-run --no-ask-password --unit=circadia-wake --on-calendar=2024-01-02 06:25:00 UTC --timer-property=WakeSystem=yes --timer-property=AccuracySec=1s true",
+		"systemctl show --property=WakeSystem --value circadia-wake.timer",
+		"systemctl --no-ask-password stop circadia-wake.timer",
+		"systemd-run --no-ask-password --unit=circadia-wake --on-calendar=2024-01-02 07:25:00 UTC --timer-property=WakeSystem=yes --timer-property=AccuracySec=1s true",
+	}
+	if len(fake.calls) != len(want) {
+		t.Fatalf("Expected %q, got %q", want, fake.calls)
+	}
+	for i := range want {
+		if fake.calls[i] != want[i] {
+			t.Errorf("Call %d: expected %q, got %q", i, want[i], fake.calls[i])
+		}
+	}
+
+	// Once waking worked, a failure is an ordinary error.
+	fake.allowed = false
+	if err := s.SetWake(at); err == nil || errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected a plain error after waking worked, got %v", err)
+	}
+}
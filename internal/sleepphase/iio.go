@@ -0,0 +1,97 @@
+package sleepphase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultIIORoot is where the kernel lists industrial I/O devices.
+const DefaultIIORoot = "/sys/bus/iio/devices"
+
+// standardGravity converts m/s², the unit of in_accel_scale, to g.
+const standardGravity = 9.80665
+
+// IIO reads an accelerometer through its iio sysfs directory.
+type IIO struct {
+	Dir string
+	// Now is the clock used to timestamp samples; nil means time.Now.
+	Now func() time.Time
+
+	scale [3]float64
+}
+
+// NewIIO opens the accelerometer at dir, reading its scale once.
+func NewIIO(dir string) (*IIO, error) {
+	s := &IIO{Dir: dir}
+	for i, axis := range []string{"x", "y", "z"} {
+		if _, err := os.Stat(filepath.Join(dir, "in_accel_"+axis+"_raw")); err != nil {
+			return nil, fmt.Errorf("failed to find accelerometer axis %s: %w", axis, err)
+		}
+		scale, err := s.readScale(axis)
+		if err != nil {
+			return nil, err
+		}
+		s.scale[i] = scale
+	}
+	return s, nil
+}
+
+// FindIIO returns the first device under root with an accelerometer.
+func FindIIO(root string) (*IIO, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "iio:device*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if s, err := NewIIO(dir); err == nil {
+			return s, nil
+		}
+	}
+	return nil, errors.New("no accelerometer found")
+}
+
+// readScale prefers a per-axis scale and falls back to the shared one. Without either, raw values are taken as m/s².
+func (s *IIO) readScale(axis string) (float64, error) {
+	for _, name := range []string{"in_accel_" + axis + "_scale", "in_accel_scale"} {
+		v, err := s.readFloat(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return v, err
+	}
+	return 1, nil
+}
+
+func (s *IIO) readFloat(name string) (float64, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, name))
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return v, nil
+}
+
+func (s *IIO) Read() (Sample, error) {
+	var v [3]float64
+	for i, axis := range []string{"x", "y", "z"} {
+		raw, err := s.readFloat("in_accel_" + axis + "_raw")
+		if err != nil {
+			return Sample{}, fmt.Errorf("failed to read accelerometer: %w", err)
+		}
+		v[i] = raw * s.scale[i] / standardGravity
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	return Sample{Time: now(), X: v[0], Y: v[1], Z: v[2]}, nil
+}
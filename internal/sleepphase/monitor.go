@@ -0,0 +1,87 @@
+package sleepphase
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often the monitor samples the accelerometer.
+const DefaultInterval = time.Second
+
+// Monitor samples a source in the background and keeps the phase estimate current.
+type Monitor struct {
+	mu   sync.Mutex
+	est  *Estimator
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartMonitor reads src every interval until Stop or until src is exhausted.
+// onEpoch, if not nil, is called from the monitor goroutine with the phase after each completed epoch.
+func StartMonitor(src Source, est *Estimator, interval time.Duration, onEpoch func(Phase)) *Monitor {
+	m := &Monitor{
+		est:  est,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go m.run(src, interval, onEpoch)
+	return m
+}
+
+func (m *Monitor) run(src Source, interval time.Duration, onEpoch func(Phase)) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s, err := src.Read()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			// A sensor that stops answering usually does so on every read, so only log the first failure.
+			if !failing {
+				log.Printf("Failed to sample accelerometer: %v", err)
+				failing = true
+			}
+			continue
+		}
+		failing = false
+
+		m.mu.Lock()
+		completed := m.est.Add(s)
+		phase := m.est.Phase()
+		m.mu.Unlock()
+
+		if completed && onEpoch != nil {
+			onEpoch(phase)
+		}
+	}
+}
+
+// Phase returns the current estimate.
+func (m *Monitor) Phase() Phase {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.est.Phase()
+}
+
+// Stop ends sampling and waits for the monitor goroutine to exit.
+func (m *Monitor) Stop() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+}
@@ -0,0 +1,89 @@
+package sleepphase
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recording replays samples saved as text, one "seconds,x,y,z" line per sample
+// with seconds counted from Start and axes in g. Blank lines and lines starting
+// with # are ignored.
+type Recording struct {
+	Start   time.Time
+	samples []Sample
+	next    int
+}
+
+// LoadRecording reads a recording file.
+func LoadRecording(path string, start time.Time) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+	return ReadRecording(f, start)
+}
+
+// ReadRecording parses a recording from r.
+func ReadRecording(r io.Reader, start time.Time) (*Recording, error) {
+	rec := &Recording{Start: start}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 fields, got %d", line, len(fields))
+		}
+		var v [4]float64
+		for i, field := range fields {
+			f, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			v[i] = f
+		}
+		rec.samples = append(rec.samples, Sample{
+			Time: start.Add(time.Duration(v[0] * float64(time.Second))),
+			X:    v[1],
+			Y:    v[2],
+			Z:    v[3],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	return rec, nil
+}
+
+func (r *Recording) Read() (Sample, error) {
+	if r.next >= len(r.samples) {
+		return Sample{}, io.EOF
+	}
+	s := r.samples[r.next]
+	r.next++
+	return s, nil
+}
+
+// Feed reads src until it is exhausted and adds every sample to e.
+func Feed(e *Estimator, src Source) error {
+	for {
+		s, err := src.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e.Add(s)
+	}
+}
@@ -0,0 +1,140 @@
+// Package sleepphase estimates light and deep sleep from how much the phone moves on the bed.
+package sleepphase
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Sample is one accelerometer reading in units of g.
+type Sample struct {
+	Time    time.Time
+	X, Y, Z float64
+}
+
+// Source produces accelerometer samples. Read returns io.EOF when a finite source is exhausted.
+type Source interface {
+	Read() (Sample, error)
+}
+
+// Phase is the estimated sleep phase.
+type Phase int
+
+const (
+	// PhaseUnknown means there is not enough data yet.
+	PhaseUnknown Phase = iota
+	PhaseDeep
+	PhaseLight
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseUnknown:
+		return "unknown"
+	case PhaseDeep:
+		return "deep"
+	case PhaseLight:
+		return "light"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// Epoch is the movement seen during one fixed stretch of time.
+type Epoch struct {
+	Start time.Time
+	// Activity is the summed change in acceleration above the noise floor, in g.
+	Activity float64
+	Samples  int
+}
+
+const (
+	// DefaultEpoch is the length of an epoch, as in wrist actigraphy.
+	DefaultEpoch = time.Minute
+	// DefaultNoiseFloor is the change in acceleration, in g, that sensor noise stays below.
+	DefaultNoiseFloor = 0.02
+	// DefaultLightThreshold is the restlessness score from which sleep counts as light.
+	DefaultLightThreshold = 0.3
+)
+
+// weights score the most recent epochs, newest first. Movement in the last minutes
+// matters most, but a single twitch should not decide the phase on its own.
+var weights = []float64{0.4, 0.25, 0.15, 0.1, 0.1}
+
+// minEpochs is how many epochs are needed before the phase is estimated.
+const minEpochs = 3
+
+// Estimator turns samples into epochs and scores their restlessness. It is not safe for concurrent use.
+type Estimator struct {
+	Epoch          time.Duration
+	NoiseFloor     float64
+	LightThreshold float64
+
+	epochs  []Epoch
+	current *Epoch
+	last    Sample
+	hasLast bool
+}
+
+func NewEstimator() *Estimator {
+	return &Estimator{
+		Epoch:          DefaultEpoch,
+		NoiseFloor:     DefaultNoiseFloor,
+		LightThreshold: DefaultLightThreshold,
+	}
+}
+
+// Add feeds a sample and reports whether it completed an epoch.
+func (e *Estimator) Add(s Sample) bool {
+	completed := false
+	if e.current != nil && !s.Time.Before(e.current.Start.Add(e.Epoch)) {
+		e.epochs = append(e.epochs, *e.current)
+		e.current = nil
+		completed = true
+	}
+	if e.current == nil {
+		e.current = &Epoch{Start: s.Time.Truncate(e.Epoch)}
+	}
+
+	if e.hasLast {
+		delta := math.Sqrt(sq(s.X-e.last.X) + sq(s.Y-e.last.Y) + sq(s.Z-e.last.Z))
+		if delta > e.NoiseFloor {
+			e.current.Activity += delta
+		}
+	}
+	e.current.Samples++
+	e.last = s
+	e.hasLast = true
+	return completed
+}
+
+func sq(v float64) float64 { return v * v }
+
+// Epochs returns the completed epochs, oldest first.
+func (e *Estimator) Epochs() []Epoch {
+	return append([]Epoch(nil), e.epochs...)
+}
+
+// Score is the weighted restlessness of the latest completed epochs.
+func (e *Estimator) Score() float64 {
+	score := 0.0
+	for i, w := range weights {
+		idx := len(e.epochs) - 1 - i
+		if idx < 0 {
+			break
+		}
+		score += w * e.epochs[idx].Activity
+	}
+	return score
+}
+
+// Phase estimates the current sleep phase from the completed epochs.
+func (e *Estimator) Phase() Phase {
+	if len(e.epochs) < minEpochs {
+		return PhaseUnknown
+	}
+	if e.Score() >= e.LightThreshold {
+		return PhaseLight
+	}
+	return PhaseDeep
+}
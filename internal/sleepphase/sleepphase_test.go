@@ -0,0 +1,189 @@
+package sleepphase
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var recordingStart = time.Date(2024, 1, 2, 6, 10, 0, 0, time.UTC)
+
+func replay(t *testing.T, name string) *Estimator {
+	t.Helper()
+	rec, err := LoadRecording(filepath.Join("testdata", name), recordingStart)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", name, err)
+	}
+	e := NewEstimator()
+	if err := Feed(e, rec); err != nil {
+		t.Fatalf("Failed to replay %s: %v", name, err)
+	}
+	return e
+}
+
+func TestEstimator_Recordings(t *testing.T) {
+	tests := []struct {
+		file string
+		want Phase
+	}{
+		{"deep.csv", PhaseDeep},
+		{"light.csv", PhaseLight},
+		{"settled.csv", PhaseDeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			e := replay(t, tt.file)
+			if got := e.Phase(); got != tt.want {
+				t.Errorf("Expected %v, got %v (score %.3f)", tt.want, got, e.Score())
+			}
+		})
+	}
+}
+
+func TestEstimator_ScoresEachEpoch(t *testing.T) {
+	e := replay(t, "light.csv")
+	epochs := e.Epochs()
+
+	// 20 minutes of samples complete 19 epochs; the last one is still open.
+	if len(epochs) != 19 {
+		t.Fatalf("Expected 19 completed epochs, got %d", len(epochs))
+	}
+	for i, ep := range epochs {
+		if ep.Samples != 60 {
+			t.Errorf("Epoch %d: expected 60 samples, got %d", i, ep.Samples)
+		}
+		if want := recordingStart.Add(time.Duration(i) * time.Minute); !ep.Start.Equal(want) {
+			t.Errorf("Epoch %d: expected start %v, got %v", i, want, ep.Start)
+		}
+	}
+
+	var still, restless float64
+	for _, ep := range epochs[:15] {
+		still += ep.Activity
+	}
+	for _, ep := range epochs[15:] {
+		restless += ep.Activity
+	}
+	if restless <= 10*still {
+		t.Errorf("Expected far more activity while turning over: still=%.3f restless=%.3f", still, restless)
+	}
+}
+
+func TestEstimator_LightDuringRestlessStart(t *testing.T) {
+	rec, err := LoadRecording(filepath.Join("testdata", "settled.csv"), recordingStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEstimator()
+	cutoff := recordingStart.Add(8 * time.Minute)
+	for {
+		s, err := rec.Read()
+		if err != nil || !s.Time.Before(cutoff) {
+			break
+		}
+		e.Add(s)
+	}
+	if got := e.Phase(); got != PhaseLight {
+		t.Errorf("Expected light sleep while turning over, got %v (score %.3f)", got, e.Score())
+	}
+}
+
+func TestEstimator_UnknownUntilEnoughData(t *testing.T) {
+	e := NewEstimator()
+	for i := 0; i < 150; i++ {
+		e.Add(Sample{Time: recordingStart.Add(time.Duration(i) * time.Second), Z: 1})
+	}
+	if got := e.Phase(); got != PhaseUnknown {
+		t.Errorf("Expected unknown after two epochs, got %v", got)
+	}
+}
+
+func TestReadRecording_Invalid(t *testing.T) {
+	for _, input := range []string{"0,1,2", "0,a,0,1"} {
+		if _, err := ReadRecording(strings.NewReader(input), recordingStart); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+// fakeIIO creates a sysfs-like device directory with the given files.
+func fakeIIO(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "iio:device0")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestIIO_Read(t *testing.T) {
+	root := fakeIIO(t, map[string]string{
+		"in_accel_x_raw": "0\n",
+		"in_accel_y_raw": "-512\n",
+		"in_accel_z_raw": "1024\n",
+		// 1024 counts per g.
+		"in_accel_scale": "0.009576806\n",
+	})
+
+	s, err := FindIIO(root)
+	if err != nil {
+		t.Fatalf("FindIIO failed: %v", err)
+	}
+	s.Now = func() time.Time { return recordingStart }
+
+	got, err := s.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !got.Time.Equal(recordingStart) {
+		t.Errorf("Expected the sample to be timestamped by Now, got %v", got.Time)
+	}
+	near := func(a, b float64) bool { return a-b < 1e-4 && b-a < 1e-4 }
+	if !near(got.X, 0) || !near(got.Y, -0.5) || !near(got.Z, 1) {
+		t.Errorf("Expected (0, -0.5, 1) g, got (%.4f, %.4f, %.4f)", got.X, got.Y, got.Z)
+	}
+}
+
+func TestFindIIO_NoAccelerometer(t *testing.T) {
+	// A light sensor is also an iio device, but has no accelerometer axes.
+	root := fakeIIO(t, map[string]string{"in_illuminance_raw": "40\n"})
+	if _, err := FindIIO(root); err == nil {
+		t.Error("Expected no accelerometer to be found")
+	}
+}
+
+func TestMonitor_ReportsEpochs(t *testing.T) {
+	rec, err := LoadRecording(filepath.Join("testdata", "light.csv"), recordingStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phases := make(chan Phase, 32)
+	m := StartMonitor(rec, NewEstimator(), time.Microsecond, func(p Phase) { phases <- p })
+
+	var last Phase
+	for i := 0; i < 19; i++ {
+		select {
+		case last = <-phases:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for epoch %d", i)
+		}
+	}
+	m.Stop()
+
+	if last != PhaseLight {
+		t.Errorf("Expected the last epoch to be light, got %v", last)
+	}
+	if got := m.Phase(); got != PhaseLight {
+		t.Errorf("Expected Phase to report light, got %v", got)
+	}
+}
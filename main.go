@@ -1,47 +1,79 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"circadia/daemon"
+	"circadia/internal/ctl"
+	"circadia/internal/ipc"
+	"circadia/internal/notify"
 	"circadia/storage"
 	"circadia/ui"
 
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
 
+const appID = "io.github.shinyvision.Circadia"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(runCtl(os.Args[2:]))
+	}
+
 	debugMode := false
+	daemonMode := false
 	filteredArgs := []string{}
 	for _, arg := range os.Args {
-		if arg == "--debug" {
+		switch arg {
+		case "--debug":
 			debugMode = true
-		} else {
+		case "--daemon":
+			daemonMode = true
+		default:
 			filteredArgs = append(filteredArgs, arg)
 		}
 	}
 
+	if daemonMode {
+		os.Exit(runDaemon(debugMode))
+	}
+
 	if !debugMode {
 		log.SetOutput(io.Discard)
 	} else {
 		log.Println("Debug mode enabled")
 	}
 
-	app := gtk.NewApplication("io.github.shinyvision.Circadia", gio.ApplicationFlagsNone)
+	app := gtk.NewApplication(appID, gio.ApplicationFlagsNone)
 
+	var (
+		store *storage.Store
+		d     *daemon.Daemon
+	)
 	app.ConnectStartup(func() {
 		log.Println("Service Started")
 
-		if err := storage.InitDB(""); err != nil {
-			log.Printf("Failed to init DB: %v", err)
-			return
+		var err error
+		store, err = storage.InitDB("")
+		if err != nil {
+			// The log is discarded outside debug mode, and there is nothing to show without a store.
+			fmt.Fprintf(os.Stderr, "circadia: failed to open database: %v\n", err)
+			os.Exit(1)
 		}
 
 		daemon.SetDebugMode(debugMode)
-		daemon.Start(&app.Application)
+		d = daemon.Start(daemon.Options{
+			Store:    store,
+			Notifier: ui.AppNotifier{App: &app.Application},
+			Activate: app.Activate,
+		})
 
 		log.Println("Holding application for daemon persistence")
 		app.Hold()
@@ -59,7 +91,7 @@ func main() {
 		}
 
 		ui.ApplyStyles()
-		mainWindow = NewWindow(app, debugMode)
+		mainWindow = NewWindow(app, store, d, debugMode)
 
 		mainWindow.ConnectDestroy(func() {
 			log.Println("Window destroyed")
@@ -74,3 +106,45 @@ func main() {
 		os.Exit(code)
 	}
 }
+
+func runCtl(args []string) int {
+	path, err := ipc.GetSocketPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "circadia ctl: %v\n", err)
+		return 1
+	}
+	return ctl.Run(path, args, os.Stdout, os.Stderr)
+}
+
+// runDaemon runs storage, the scheduler, audio and IPC on a bare GLib main loop, without
+// GTK or a display. It always logs, since the log is all there is to see.
+func runDaemon(debugMode bool) int {
+	log.Println("Starting headless daemon")
+
+	store, err := storage.InitDB("")
+	if err != nil {
+		log.Printf("Failed to init DB: %v", err)
+		return 1
+	}
+
+	var notifier notify.Notifier = notify.Log{}
+	if n, err := notify.ConnectDBus("Circadia", appID); err != nil {
+		log.Printf("Desktop notifications unavailable, logging them instead: %v", err)
+	} else {
+		notifier = n
+	}
+
+	loop := glib.NewMainLoop(nil, false)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v, stopping", sig)
+		glib.IdleAdd(loop.Quit)
+	}()
+
+	daemon.SetDebugMode(debugMode)
+	daemon.Start(daemon.Options{Store: store, Notifier: notifier})
+	loop.Run()
+	return 0
+}
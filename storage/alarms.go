@@ -1,26 +1,203 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// Weekdays is a bitmask of the days an alarm repeats on, indexed by time.Weekday.
+type Weekdays uint8
+
+const (
+	Sunday Weekdays = 1 << iota
+	Monday
+	Tuesday
+	Wednesday
+	Thursday
+	Friday
+	Saturday
+
+	WorkWeek = Monday | Tuesday | Wednesday | Thursday | Friday
+	Weekend  = Saturday | Sunday
+	EveryDay = WorkWeek | Weekend
+)
+
+// WeekOrder lists the days in the order they are shown to the user.
+var WeekOrder = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+}
+
+func (d Weekdays) Has(day time.Weekday) bool {
+	return d&(1<<uint(day)) != 0
+}
+
+func (d Weekdays) With(day time.Weekday, on bool) Weekdays {
+	if on {
+		return d | 1<<uint(day)
+	}
+	return d &^ (1 << uint(day))
+}
+
+// String summarises the mask the way it is shown next to an alarm, e.g. "Weekdays" or "Mon, Wed, Fri".
+func (d Weekdays) String() string {
+	switch d & EveryDay {
+	case EveryDay:
+		return "Every day"
+	case WorkWeek:
+		return "Weekdays"
+	case Weekend:
+		return "Weekends"
+	case 0:
+		return "Once"
+	}
+
+	var names []string
+	for _, day := range WeekOrder {
+		if d.Has(day) {
+			names = append(names, day.String()[:3])
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// DateLayout is how calendar dates are stored for dated alarms and exceptions.
+const DateLayout = "2006-01-02"
+
 type Alarm struct {
 	ID      int64
 	Hour    int
 	Minute  int
 	Enabled bool
+	Label   string
+	// Days is empty for one-shot alarms, which ring at the next matching time and are then switched off.
+	Days Weekdays
+	// Date pins the alarm to a single calendar day (local midnight). Days is ignored when it is set.
+	Date time.Time
+	// DeleteAfterRing removes a one-shot alarm once it has been stopped instead of just disabling it.
+	DeleteAfterRing bool
+	// AudioPath overrides the global alarm_audio_path setting when set.
+	AudioPath string
+	// SnoozeEnabled and SnoozeDuration (minutes) override the global snooze settings when not nil.
+	SnoozeEnabled  *bool
+	SnoozeDuration *int
+	// SnoozeMax limits how often the alarm can be snoozed before it has to be stopped. Zero means unlimited.
+	SnoozeMax int
+	// FadeInSeconds and Volume (percent) override the global fade-in and alarm volume settings when not nil.
+	FadeInSeconds *int
+	Volume        *int
+	// SmartWakeWindow (minutes) overrides the global smart wake window when not nil. Zero turns
+	// smart wake off for this alarm. It has no effect while smart wake is switched off.
+	SmartWakeWindow *int
+	// Exceptions are the days a repeating alarm stays silent. They are loaded by GetAlarms
+	// and managed through AddAlarmException and DeleteAlarmException, not UpdateAlarm.
+	Exceptions []AlarmException
+}
+
+func (a Alarm) IsDated() bool {
+	return !a.Date.IsZero()
+}
+
+func (a Alarm) IsOneShot() bool {
+	return a.Days == 0 || a.IsDated()
+}
+
+// IsSkipped reports whether one of the alarm's exceptions covers the given day.
+func (a Alarm) IsSkipped(day time.Time) bool {
+	for _, e := range a.Exceptions {
+		if e.Covers(day) {
+			return true
+		}
+	}
+	return false
+}
+
+const alarmColumns = "id, hour, minute, enabled, label, days, date, delete_after_ring, audio_path, snooze_enabled, snooze_duration, snooze_max, fade_in_seconds, volume, smart_wake_window"
+
+func scanAlarm(row interface{ Scan(...any) error }) (Alarm, error) {
+	var a Alarm
+	var date sql.NullString
+	var snoozeEnabled sql.NullBool
+	var snoozeDuration, fadeIn, volume, smartWindow sql.NullInt64
+	if err := row.Scan(&a.ID, &a.Hour, &a.Minute, &a.Enabled, &a.Label, &a.Days, &date, &a.DeleteAfterRing, &a.AudioPath,
+		&snoozeEnabled, &snoozeDuration, &a.SnoozeMax, &fadeIn, &volume, &smartWindow); err != nil {
+		return a, err
+	}
+	if snoozeEnabled.Valid {
+		a.SnoozeEnabled = &snoozeEnabled.Bool
+	}
+	a.SnoozeDuration = intPtr(snoozeDuration)
+	a.FadeInSeconds = intPtr(fadeIn)
+	a.Volume = intPtr(volume)
+	a.SmartWakeWindow = intPtr(smartWindow)
+	if date.Valid && date.String != "" {
+		d, err := time.ParseInLocation(DateLayout, date.String, time.Local)
+		if err != nil {
+			return a, fmt.Errorf("invalid date for alarm %d: %w", a.ID, err)
+		}
+		a.Date = d
+	}
+	return a, nil
+}
+
+func formatDate(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(DateLayout), Valid: true}
+}
+
+func nullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
+
+func intPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	i := int(n.Int64)
+	return &i
+}
+
+func nullInt(i *int) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*i), Valid: true}
 }
 
-func AddAlarm(hour, minute int) error {
-	_, err := DB.Exec("INSERT INTO alarms (hour, minute, enabled) VALUES (?, ?, ?)", hour, minute, true)
+func (s *sqlStore) AddAlarm(a Alarm) (int64, error) {
+	res, err := s.db.Exec("INSERT INTO alarms (hour, minute, enabled, label, days, date, delete_after_ring, audio_path, snooze_enabled, snooze_duration, snooze_max, fade_in_seconds, volume, smart_wake_window) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		a.Hour, a.Minute, a.Enabled, a.Label, a.Days, formatDate(a.Date), a.DeleteAfterRing, a.AudioPath,
+		nullBool(a.SnoozeEnabled), nullInt(a.SnoozeDuration), a.SnoozeMax, nullInt(a.FadeInSeconds), nullInt(a.Volume), nullInt(a.SmartWakeWindow))
 	if err != nil {
-		return fmt.Errorf("failed to add alarm: %w", err)
+		return 0, fmt.Errorf("failed to add alarm: %w", err)
 	}
-	return nil
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get new alarm ID: %w", err)
+	}
+	return id, nil
+}
+
+func (s *sqlStore) GetAlarm(id int64) (Alarm, error) {
+	a, err := scanAlarm(s.db.QueryRow("SELECT "+alarmColumns+" FROM alarms WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return Alarm{}, fmt.Errorf("failed to get alarm %d: %w", id, err)
+	}
+	return a, nil
 }
 
-func GetAlarms() ([]Alarm, error) {
-	rows, err := DB.Query("SELECT id, hour, minute, enabled FROM alarms ORDER BY hour, minute ASC")
+func (s *sqlStore) GetAlarms() ([]Alarm, error) {
+	rows, err := s.db.Query("SELECT " + alarmColumns + " FROM alarms ORDER BY hour, minute ASC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query alarms: %w", err)
 	}
@@ -28,33 +205,51 @@ func GetAlarms() ([]Alarm, error) {
 
 	var alarms []Alarm
 	for rows.Next() {
-		var a Alarm
-		if err := rows.Scan(&a.ID, &a.Hour, &a.Minute, &a.Enabled); err != nil {
+		a, err := scanAlarm(rows)
+		if err != nil {
 			return nil, err
 		}
 		alarms = append(alarms, a)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	exceptions, err := s.getAllAlarmExceptions()
+	if err != nil {
+		return nil, err
+	}
+	for i := range alarms {
+		alarms[i].Exceptions = exceptions[alarms[i].ID]
+	}
 	return alarms, nil
 }
 
-func UpdateAlarm(id int64, hour, minute int, enabled bool) error {
-	_, err := DB.Exec("UPDATE alarms SET hour = ?, minute = ?, enabled = ? WHERE id = ?", hour, minute, enabled, id)
+func (s *sqlStore) UpdateAlarm(a Alarm) error {
+	_, err := s.db.Exec("UPDATE alarms SET hour = ?, minute = ?, enabled = ?, label = ?, days = ?, date = ?, delete_after_ring = ?, audio_path = ?, snooze_enabled = ?, snooze_duration = ?, snooze_max = ?, fade_in_seconds = ?, volume = ?, smart_wake_window = ? WHERE id = ?",
+		a.Hour, a.Minute, a.Enabled, a.Label, a.Days, formatDate(a.Date), a.DeleteAfterRing, a.AudioPath,
+		nullBool(a.SnoozeEnabled), nullInt(a.SnoozeDuration), a.SnoozeMax, nullInt(a.FadeInSeconds), nullInt(a.Volume), nullInt(a.SmartWakeWindow), a.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update alarm: %w", err)
 	}
 	return nil
 }
 
-func DeleteAlarm(id int64) error {
-	_, err := DB.Exec("DELETE FROM alarms WHERE id = ?", id)
+func (s *sqlStore) DeleteAlarm(id int64) error {
+	_, err := s.db.Exec("DELETE FROM alarms WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete alarm: %w", err)
 	}
+	_, err = s.db.Exec("DELETE FROM alarm_exceptions WHERE alarm_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete alarm exceptions: %w", err)
+	}
 	return nil
 }
 
-func ToggleAlarm(id int64, enabled bool) error {
-	_, err := DB.Exec("UPDATE alarms SET enabled = ? WHERE id = ?", enabled, id)
+func (s *sqlStore) ToggleAlarm(id int64, enabled bool) error {
+	_, err := s.db.Exec("UPDATE alarms SET enabled = ? WHERE id = ?", enabled, id)
 	if err != nil {
 		return fmt.Errorf("failed to toggle alarm: %w", err)
 	}
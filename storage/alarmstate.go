@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AlarmState is the alarm that is ringing or snoozed, kept so a restarted daemon can carry on with it.
+type AlarmState struct {
+	AlarmID int64
+	// Snoozed is true while the alarm waits for SnoozeUntil and false while it rings.
+	Snoozed bool
+	// Since is when the alarm started ringing or was snoozed.
+	Since       time.Time
+	SnoozeUntil time.Time
+	// SnoozesUsed counts the snoozes since the alarm first rang, so its snooze limit survives a restart.
+	SnoozesUsed int
+}
+
+func (s *sqlStore) SaveAlarmState(st AlarmState) error {
+	var until sql.NullTime
+	if !st.SnoozeUntil.IsZero() {
+		until = sql.NullTime{Time: st.SnoozeUntil, Valid: true}
+	}
+	_, err := s.db.Exec("INSERT OR REPLACE INTO alarm_state (id, alarm_id, snoozed, since, snooze_until, snoozes_used) VALUES (1, ?, ?, ?, ?, ?)",
+		st.AlarmID, st.Snoozed, st.Since, until, st.SnoozesUsed)
+	if err != nil {
+		return fmt.Errorf("failed to save alarm state: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetAlarmState() (AlarmState, bool, error) {
+	var st AlarmState
+	var since, until sql.NullTime
+	err := s.db.QueryRow("SELECT alarm_id, snoozed, since, snooze_until, snoozes_used FROM alarm_state WHERE id = 1").
+		Scan(&st.AlarmID, &st.Snoozed, &since, &until, &st.SnoozesUsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AlarmState{}, false, nil
+	}
+	if err != nil {
+		return AlarmState{}, false, fmt.Errorf("failed to get alarm state: %w", err)
+	}
+	st.Since = since.Time
+	st.SnoozeUntil = until.Time
+	return st, true, nil
+}
+
+func (s *sqlStore) ClearAlarmState() error {
+	if _, err := s.db.Exec("DELETE FROM alarm_state"); err != nil {
+		return fmt.Errorf("failed to clear alarm state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// BackupVersion is the version of the backup format written by Export. Import refuses newer ones.
+const BackupVersion = 1
+
+const backupFormat = "circadia-backup"
+
+// ErrInvalidBackup is returned when an archive cannot be imported. Nothing is changed in that case.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// ImportMode decides what happens to the existing data when a backup is imported.
+type ImportMode string
+
+const (
+	// ImportMerge adds the alarms and sleep sessions that are not there yet and overwrites
+	// the settings found in the backup.
+	ImportMerge ImportMode = "merge"
+	// ImportReplace makes alarms, settings and sleep history match the backup.
+	ImportReplace ImportMode = "replace"
+)
+
+// ImportResult counts what an import wrote.
+type ImportResult struct {
+	Alarms        int
+	Settings      int
+	SleepSessions int
+}
+
+// backup is the archive written by Export: a single JSON document. Alarm IDs are not
+// kept, since they only mean something within one database.
+type backup struct {
+	Format       string            `json:"format"`
+	Version      int               `json:"version"`
+	ExportedAt   time.Time         `json:"exported_at"`
+	Alarms       []backupAlarm     `json:"alarms"`
+	Settings     map[string]string `json:"settings"`
+	SleepHistory []backupSession   `json:"sleep_history"`
+}
+
+type backupAlarm struct {
+	Hour            int               `json:"hour"`
+	Minute          int               `json:"minute"`
+	Enabled         bool              `json:"enabled"`
+	Label           string            `json:"label,omitempty"`
+	Days            int               `json:"days"`
+	Date            string            `json:"date,omitempty"`
+	DeleteAfterRing bool              `json:"delete_after_ring,omitempty"`
+	AudioPath       string            `json:"audio_path,omitempty"`
+	SnoozeEnabled   *bool             `json:"snooze_enabled,omitempty"`
+	SnoozeDuration  *int              `json:"snooze_duration,omitempty"`
+	SnoozeMax       int               `json:"snooze_max,omitempty"`
+	FadeInSeconds   *int              `json:"fade_in_seconds,omitempty"`
+	Volume          *int              `json:"volume,omitempty"`
+	SmartWakeWindow *int              `json:"smart_wake_window,omitempty"`
+	Exceptions      []backupException `json:"exceptions,omitempty"`
+}
+
+type backupException struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type backupSession struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	SnoozeCount int       `json:"snooze_count"`
+}
+
+// Export writes alarms, settings and the kept sleep history to w as a versioned JSON archive.
+func (s *Store) Export(w io.Writer) error {
+	b := backup{Format: backupFormat, Version: BackupVersion, ExportedAt: time.Now()}
+
+	alarms, err := s.GetAlarms()
+	if err != nil {
+		return fmt.Errorf("failed to export alarms: %w", err)
+	}
+	for _, a := range alarms {
+		b.Alarms = append(b.Alarms, newBackupAlarm(a))
+	}
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return fmt.Errorf("failed to export settings: %w", err)
+	}
+	maps.DeleteFunc(settings, func(key, _ string) bool { return slices.Contains(StateSettings, key) })
+	b.Settings = settings
+
+	sessions, err := s.GetHistory(historyDays)
+	if err != nil {
+		return fmt.Errorf("failed to export sleep history: %w", err)
+	}
+	for _, session := range sessions {
+		b.SleepHistory = append(b.SleepHistory, backupSession{Start: session.StartTime, End: session.EndTime, SnoozeCount: session.SnoozeCount})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// Import reads an archive written by Export and applies it according to mode. The whole
+// archive is checked first and then written as one change, so a failed import leaves the
+// store untouched.
+func (s *Store) Import(r io.Reader, mode ImportMode) (ImportResult, error) {
+	var result ImportResult
+	if mode != ImportMerge && mode != ImportReplace {
+		return result, fmt.Errorf("unknown import mode %q", mode)
+	}
+
+	var b backup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if err := b.check(); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	err := s.imports.Atomically(func(alarms AlarmRepository, settings SettingsRepository, history HistoryRepository) error {
+		var err error
+		result, err = b.apply(mode, alarms, settings, history)
+		return err
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	s.alarmsWritten()
+	if s.OnSettingWritten != nil {
+		s.OnSettingWritten("")
+	}
+	return result, nil
+}
+
+// apply writes the checked backup to the repositories, which Import keeps only if it succeeds.
+func (b backup) apply(mode ImportMode, alarms AlarmRepository, settings SettingsRepository, history HistoryRepository) (ImportResult, error) {
+	var result ImportResult
+	existing, err := alarms.GetAlarms()
+	if err != nil {
+		return result, fmt.Errorf("failed to import alarms: %w", err)
+	}
+	if mode == ImportReplace {
+		for _, a := range existing {
+			if err := alarms.DeleteAlarm(a.ID); err != nil {
+				return result, fmt.Errorf("failed to import alarms: %w", err)
+			}
+		}
+		existing = nil
+	}
+	for _, ba := range b.Alarms {
+		a, exceptions, _ := ba.alarm()
+		if slices.ContainsFunc(existing, func(e Alarm) bool { return sameAlarm(e, a) }) {
+			continue
+		}
+		id, err := alarms.AddAlarm(a)
+		if err != nil {
+			return result, fmt.Errorf("failed to import alarms: %w", err)
+		}
+		for _, e := range exceptions {
+			if err := alarms.AddAlarmException(id, e.Start, e.End); err != nil {
+				return result, fmt.Errorf("failed to import alarm exceptions: %w", err)
+			}
+		}
+		result.Alarms++
+	}
+
+	if mode == ImportReplace {
+		current, err := settings.GetSettings()
+		if err != nil {
+			return result, fmt.Errorf("failed to import settings: %w", err)
+		}
+		for key := range current {
+			if _, ok := b.Settings[key]; ok || slices.Contains(StateSettings, key) {
+				continue
+			}
+			if value, ok := defaultSettings[key]; ok {
+				err = settings.SetSetting(key, value)
+			} else {
+				err = settings.DeleteSetting(key)
+			}
+			if err != nil {
+				return result, fmt.Errorf("failed to import settings: %w", err)
+			}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(b.Settings)) {
+		if slices.Contains(StateSettings, key) {
+			continue
+		}
+		if err := settings.SetSetting(key, b.Settings[key]); err != nil {
+			return result, fmt.Errorf("failed to import settings: %w", err)
+		}
+		result.Settings++
+	}
+
+	var sessions []SleepSession
+	if mode == ImportReplace {
+		if err := history.ClearSleepHistory(); err != nil {
+			return result, fmt.Errorf("failed to import sleep history: %w", err)
+		}
+	} else if sessions, err = history.GetHistory(historyDays); err != nil {
+		return result, fmt.Errorf("failed to import sleep history: %w", err)
+	}
+	for _, bs := range b.SleepHistory {
+		if slices.ContainsFunc(sessions, func(e SleepSession) bool { return e.StartTime.Equal(bs.Start) }) {
+			continue
+		}
+		if err := history.AddSleepSession(bs.Start, bs.End, bs.SnoozeCount); err != nil {
+			return result, fmt.Errorf("failed to import sleep history: %w", err)
+		}
+		result.SleepSessions++
+	}
+
+	return result, nil
+}
+
+// sameAlarm reports whether two alarms ring at the same time on the same days with the same
+// label, which is how a merge recognises alarms it already has.
+func sameAlarm(a, b Alarm) bool {
+	return a.Hour == b.Hour && a.Minute == b.Minute && a.Days == b.Days && a.Date.Equal(b.Date) && a.Label == b.Label
+}
+
+func (b backup) check() error {
+	if b.Format != backupFormat {
+		return fmt.Errorf("not a Circadia backup")
+	}
+	if b.Version < 1 || b.Version > BackupVersion {
+		return fmt.Errorf("backup version %d is not supported, newest known is %d", b.Version, BackupVersion)
+	}
+	for i, ba := range b.Alarms {
+		if _, _, err := ba.alarm(); err != nil {
+			return fmt.Errorf("alarm %d: %w", i+1, err)
+		}
+	}
+	for key := range b.Settings {
+		if key == "" {
+			return fmt.Errorf("setting with an empty key")
+		}
+	}
+	for i, bs := range b.SleepHistory {
+		if bs.Start.IsZero() || bs.End.Before(bs.Start) || bs.SnoozeCount < 0 {
+			return fmt.Errorf("sleep session %d: invalid times or snooze count", i+1)
+		}
+	}
+	return nil
+}
+
+func newBackupAlarm(a Alarm) backupAlarm {
+	ba := backupAlarm{
+		Hour:            a.Hour,
+		Minute:          a.Minute,
+		Enabled:         a.Enabled,
+		Label:           a.Label,
+		Days:            int(a.Days),
+		DeleteAfterRing: a.DeleteAfterRing,
+		AudioPath:       a.AudioPath,
+		SnoozeEnabled:   a.SnoozeEnabled,
+		SnoozeDuration:  a.SnoozeDuration,
+		SnoozeMax:       a.SnoozeMax,
+		FadeInSeconds:   a.FadeInSeconds,
+		Volume:          a.Volume,
+		SmartWakeWindow: a.SmartWakeWindow,
+	}
+	if a.IsDated() {
+		ba.Date = a.Date.Format(DateLayout)
+	}
+	for _, e := range a.Exceptions {
+		ba.Exceptions = append(ba.Exceptions, backupException{Start: e.Start.Format(DateLayout), End: e.End.Format(DateLayout)})
+	}
+	return ba
+}
+
+// alarm converts ba back, reporting values the app would never have stored.
+func (ba backupAlarm) alarm() (Alarm, []AlarmException, error) {
+	a := Alarm{
+		Hour:            ba.Hour,
+		Minute:          ba.Minute,
+		Enabled:         ba.Enabled,
+		Label:           ba.Label,
+		Days:            Weekdays(ba.Days),
+		DeleteAfterRing: ba.DeleteAfterRing,
+		AudioPath:       ba.AudioPath,
+		SnoozeEnabled:   ba.SnoozeEnabled,
+		SnoozeDuration:  ba.SnoozeDuration,
+		SnoozeMax:       ba.SnoozeMax,
+		FadeInSeconds:   ba.FadeInSeconds,
+		Volume:          ba.Volume,
+		SmartWakeWindow: ba.SmartWakeWindow,
+	}
+
+	switch {
+	case ba.Hour < 0 || ba.Hour > 23 || ba.Minute < 0 || ba.Minute > 59:
+		return a, nil, fmt.Errorf("invalid time %d:%02d", ba.Hour, ba.Minute)
+	case ba.Days < 0 || ba.Days&^int(EveryDay) != 0:
+		return a, nil, fmt.Errorf("invalid days %d", ba.Days)
+	case ba.SnoozeDuration != nil && *ba.SnoozeDuration < 1, ba.SnoozeMax < 0:
+		return a, nil, fmt.Errorf("invalid snooze settings")
+	case ba.FadeInSeconds != nil && *ba.FadeInSeconds < 0:
+		return a, nil, fmt.Errorf("invalid fade-in %d", *ba.FadeInSeconds)
+	case ba.Volume != nil && (*ba.Volume < 0 || *ba.Volume > 100):
+		return a, nil, fmt.Errorf("invalid volume %d", *ba.Volume)
+	case ba.SmartWakeWindow != nil && (*ba.SmartWakeWindow < 0 || *ba.SmartWakeWindow > MaxSmartWakeWindow):
+		return a, nil, fmt.Errorf("invalid smart wake window %d", *ba.SmartWakeWindow)
+	}
+
+	if ba.Date != "" {
+		d, err := time.ParseInLocation(DateLayout, ba.Date, time.Local)
+		if err != nil {
+			return a, nil, fmt.Errorf("invalid date %q", ba.Date)
+		}
+		a.Date = d
+	}
+
+	var exceptions []AlarmException
+	for _, be := range ba.Exceptions {
+		start, err1 := time.ParseInLocation(DateLayout, be.Start, time.Local)
+		end, err2 := time.ParseInLocation(DateLayout, be.End, time.Local)
+		if err1 != nil || err2 != nil || end.Before(start) {
+			return a, nil, fmt.Errorf("invalid exception %s to %s", be.Start, be.End)
+		}
+		exceptions = append(exceptions, AlarmException{Start: start, End: end})
+	}
+	return a, exceptions, nil
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fill stores one of everything a backup covers and returns the bytes Export writes.
+func fill(t *testing.T, s *Store, now time.Time) []byte {
+	t.Helper()
+	five, seventy := 5, 70
+	off := false
+	gym, _ := s.AddAlarm(Alarm{Hour: 6, Minute: 30, Enabled: true, Label: "Gym", Days: WorkWeek,
+		AudioPath: "/home/user/birds.ogg", SnoozeEnabled: &off, SnoozeDuration: &five, SnoozeMax: 2, Volume: &seventy})
+	s.AddAlarmException(gym, date(2026, time.December, 24), date(2026, time.December, 31))
+	s.AddAlarm(Alarm{Hour: 9, Date: date(2026, time.November, 2), DeleteAfterRing: true})
+
+	s.SetBedtime("22:15")
+	s.SetSnoozeDuration(8)
+	s.SetSleepStartTime(now)
+	s.AddSleepSession(now.AddDate(0, 0, -2), now.AddDate(0, 0, -2).Add(7*time.Hour), 1)
+	s.AddSleepSession(now.AddDate(0, 0, -1), now.AddDate(0, 0, -1).Add(8*time.Hour), 0)
+
+	var buf bytes.Buffer
+	if err := s.Export(&buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBackup_RoundTrip(t *testing.T) {
+	backends(t, func(t *testing.T, src *Store) {
+		now := time.Now().Truncate(time.Second)
+		data := fill(t, src, now)
+		if strings.Contains(string(data), "sleep_start_time") {
+			t.Error("Expected state settings to be left out of the backup")
+		}
+
+		dst := NewMemoryStore()
+		result, err := dst.Import(bytes.NewReader(data), ImportReplace)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if result.Alarms != 2 || result.SleepSessions != 2 {
+			t.Errorf("Unexpected result %+v", result)
+		}
+
+		want, _ := src.GetAlarms()
+		got, _ := dst.GetAlarms()
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d alarms, got %+v", len(want), got)
+		}
+		gym := got[0]
+		if gym.Label != "Gym" || gym.Days != WorkWeek || gym.AudioPath != want[0].AudioPath || gym.SnoozeMax != 2 ||
+			*gym.SnoozeEnabled || *gym.SnoozeDuration != 5 || *gym.Volume != 70 || gym.FadeInSeconds != nil {
+			t.Errorf("Expected %+v, got %+v", want[0], gym)
+		}
+		if len(gym.Exceptions) != 1 || !gym.Exceptions[0].Start.Equal(date(2026, time.December, 24)) || !gym.Exceptions[0].End.Equal(date(2026, time.December, 31)) {
+			t.Errorf("Expected the exception restored, got %+v", gym.Exceptions)
+		}
+		if !got[1].Date.Equal(date(2026, time.November, 2)) || !got[1].DeleteAfterRing || got[1].Enabled {
+			t.Errorf("Expected %+v, got %+v", want[1], got[1])
+		}
+
+		if bedtime, _ := dst.GetBedtime(); bedtime != "22:15" {
+			t.Errorf("Expected bedtime 22:15, got %q", bedtime)
+		}
+		if d, _ := dst.GetSnoozeDuration(); d != 8 {
+			t.Errorf("Expected snooze duration 8, got %d", d)
+		}
+		if start, _ := dst.GetSleepStartTime(); !start.IsZero() {
+			t.Errorf("Expected sleep mode not to be restored, got %v", start)
+		}
+		sessions, _ := dst.GetHistory(30)
+		if len(sessions) != 2 || !sessions[0].StartTime.Equal(now.AddDate(0, 0, -2)) || sessions[0].SnoozeCount != 1 {
+			t.Errorf("Expected both sessions restored, got %+v", sessions)
+		}
+	})
+}
+
+func TestBackup_Merge(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		now := time.Now().Truncate(time.Second)
+		data := fill(t, NewMemoryStore(), now)
+		s.AddAlarm(Alarm{Hour: 6, Minute: 30, Enabled: true, Label: "Gym", Days: WorkWeek})
+		s.AddAlarm(Alarm{Hour: 11, Enabled: true, Days: Weekend})
+		s.SetAlarmVolume(40)
+
+		result, err := s.Import(bytes.NewReader(data), ImportMerge)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if result.Alarms != 1 || result.SleepSessions != 2 {
+			t.Errorf("Expected the existing alarm to be skipped, got %+v", result)
+		}
+		if result, _ = s.Import(bytes.NewReader(data), ImportMerge); result.Alarms != 0 || result.SleepSessions != 0 {
+			t.Errorf("Expected importing again to add nothing, got %+v", result)
+		}
+
+		if alarms, _ := s.GetAlarms(); len(alarms) != 3 {
+			t.Errorf("Expected the own alarm kept next to the imported ones, got %+v", alarms)
+		}
+		if v, _ := s.GetAlarmVolume(); v != 40 {
+			t.Errorf("Expected a setting missing from the backup to be kept, got %d", v)
+		}
+		if bedtime, _ := s.GetBedtime(); bedtime != "22:15" {
+			t.Errorf("Expected the imported bedtime, got %q", bedtime)
+		}
+		if sessions, _ := s.GetHistory(30); len(sessions) != 2 {
+			t.Errorf("Expected no duplicate sessions, got %+v", sessions)
+		}
+	})
+}
+
+func TestBackup_Replace(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		now := time.Now().Truncate(time.Second)
+		data := fill(t, NewMemoryStore(), now)
+		s.AddAlarm(Alarm{Hour: 11, Enabled: true, Days: Weekend})
+		s.SetAlarmVolume(40)
+		s.SetNotifyBedtime(false)
+		s.AddSleepSession(now.AddDate(0, 0, -5), now.AddDate(0, 0, -5).Add(6*time.Hour), 3)
+
+		alarmWrites := 0
+		var settingWrites []string
+		s.OnAlarmsWritten = func() { alarmWrites++ }
+		s.OnSettingWritten = func(key string) { settingWrites = append(settingWrites, key) }
+		if _, err := s.Import(bytes.NewReader(data), ImportReplace); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if alarmWrites != 1 || len(settingWrites) != 1 || settingWrites[0] != "" {
+			t.Errorf("Expected one report per hook, got %d alarm writes and settings %q", alarmWrites, settingWrites)
+		}
+
+		alarms, _ := s.GetAlarms()
+		if len(alarms) != 2 || alarms[0].Label != "Gym" {
+			t.Errorf("Expected only the imported alarms, got %+v", alarms)
+		}
+		if v, _ := s.GetAlarmVolume(); v != 100 {
+			t.Errorf("Expected a setting missing from the backup to fall back to its default, got %d", v)
+		}
+		if notify, _ := s.GetNotifyBedtime(); !notify {
+			t.Error("Expected notify_bedtime from the backup")
+		}
+		sessions, _ := s.GetHistory(30)
+		if len(sessions) != 2 || sessions[0].SnoozeCount != 1 {
+			t.Errorf("Expected only the imported sessions, got %+v", sessions)
+		}
+	})
+}
+
+func TestBackup_FailedImport(t *testing.T) {
+	path := t.TempDir() + "/user.db"
+	s, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	data := fill(t, NewMemoryStore(), now)
+	s.AddAlarm(Alarm{Hour: 11, Enabled: true, Days: Weekend})
+	s.SetAlarmVolume(40)
+
+	// Sleep history is written last, so everything before it must be rolled back.
+	db := openRaw(t, path)
+	if _, err := db.Exec("CREATE TRIGGER fail_import BEFORE INSERT ON sleep_history BEGIN SELECT RAISE(ABORT, 'disk full'); END"); err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	writes := 0
+	s.OnAlarmsWritten = func() { writes++ }
+	s.OnSettingWritten = func(string) { writes++ }
+	if result, err := s.Import(bytes.NewReader(data), ImportReplace); err == nil || result != (ImportResult{}) {
+		t.Fatalf("Expected the import to fail without a result, got %+v, %v", result, err)
+	}
+	if writes != 0 {
+		t.Errorf("Expected no writes reported, got %d", writes)
+	}
+
+	if alarms, _ := s.GetAlarms(); len(alarms) != 1 || alarms[0].Hour != 11 {
+		t.Errorf("Expected the alarms untouched, got %+v", alarms)
+	}
+	if v, _ := s.GetAlarmVolume(); v != 40 {
+		t.Errorf("Expected the settings untouched, got volume %d", v)
+	}
+}
+
+func TestBackup_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not JSON":      `alarms: 6:30`,
+		"wrong format":  `{"format": "something-else", "version": 1}`,
+		"newer version": `{"format": "circadia-backup", "version": 99}`,
+		"bad time":      `{"format": "circadia-backup", "version": 1, "alarms": [{"hour": 24, "minute": 0, "days": 127}]}`,
+		"bad days":      `{"format": "circadia-backup", "version": 1, "alarms": [{"hour": 6, "minute": 0, "days": 200}]}`,
+		"bad exception": `{"format": "circadia-backup", "version": 1, "alarms": [{"hour": 6, "minute": 0, "days": 127, "exceptions": [{"start": "2026-05-02", "end": "2026-05-01"}]}]}`,
+		"bad session":   `{"format": "circadia-backup", "version": 1, "sleep_history": [{"start": "2026-10-15T07:00:00Z", "end": "2026-10-14T23:00:00Z"}]}`,
+	}
+
+	backends(t, func(t *testing.T, s *Store) {
+		s.AddAlarm(Alarm{Hour: 7, Enabled: true, Days: EveryDay})
+		for name, data := range tests {
+			// The valid alarm in front must not be imported either.
+			data = strings.Replace(data, `"alarms": [`, `"alarms": [{"hour": 5, "minute": 0, "days": 127}, `, 1)
+			if _, err := s.Import(strings.NewReader(data), ImportReplace); !errors.Is(err, ErrInvalidBackup) {
+				t.Errorf("%s: expected ErrInvalidBackup, got %v", name, err)
+			}
+		}
+		if alarms, _ := s.GetAlarms(); len(alarms) != 1 || alarms[0].Hour != 7 {
+			t.Errorf("Expected the store untouched, got %+v", alarms)
+		}
+		if _, err := s.Import(strings.NewReader(`{}`), "overwrite"); err == nil {
+			t.Error("Expected an unknown mode to be refused")
+		}
+	})
+}
@@ -11,20 +11,35 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+// sqlStore keeps everything in a SQLite database.
+type sqlStore struct {
+	// db runs the queries: the database itself, or the transaction of an import.
+	db queryer
+	// conn is the database, which transactions are started on.
+	conn *sql.DB
+}
+
+// queryer is what *sql.DB and *sql.Tx have in common.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
 
-func InitDB(connStr string) error {
+// InitDB opens the SQLite database at connStr, or at the user's data directory when
+// connStr is empty, brings its schema up to date and returns a Store backed by it.
+func InitDB(connStr string) (*Store, error) {
 	var dbPath string
 	var err error
 
 	if connStr == "" {
 		dbPath, err = xdg.DataFile("circadia/user.db")
 		if err != nil {
-			return fmt.Errorf("could not resolve data file path: %w", err)
+			return nil, fmt.Errorf("could not resolve data file path: %w", err)
 		}
 
 		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-			return fmt.Errorf("could not create data directory: %w", err)
+			return nil, fmt.Errorf("could not create data directory: %w", err)
 		}
 		log.Printf("Opening database at %s", dbPath)
 	} else {
@@ -34,70 +49,56 @@ func InitDB(connStr string) error {
 
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		return fmt.Errorf("could not open database: %w", err)
+		return nil, fmt.Errorf("could not open database: %w", err)
 	}
 
-	DB = db
-
-	return migrate()
+	s := &sqlStore{db: db, conn: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return NewStore(s, s, s, s, s), nil
 }
 
-func migrate() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS settings (
-		key TEXT PRIMARY KEY,
-		value TEXT
-	);
-	`
-	_, err := DB.Exec(query)
+// Atomically runs apply in a single transaction, which is rolled back when apply fails.
+func (s *sqlStore) Atomically(apply func(AlarmRepository, SettingsRepository, HistoryRepository) error) error {
+	tx, err := s.conn.Begin()
 	if err != nil {
-		return fmt.Errorf("could not create settings table: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-
-	queryAlarms := `
-	CREATE TABLE IF NOT EXISTS alarms (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		hour INTEGER,
-		minute INTEGER,
-		enabled BOOLEAN
-	);
-	`
-	_, err = DB.Exec(queryAlarms)
-	if err != nil {
-		return fmt.Errorf("could not create alarms table: %w", err)
+	t := &sqlStore{db: tx}
+	if err := apply(t, t, t); err != nil {
+		tx.Rollback()
+		return err
 	}
-
-	queryHistory := `
-	CREATE TABLE IF NOT EXISTS sleep_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		start_time TIMESTAMP,
-		end_time TIMESTAMP,
-		snooze_count INTEGER
-	);
-	`
-	_, err = DB.Exec(queryHistory)
-	if err != nil {
-		return fmt.Errorf("could not create sleep_history table: %w", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return nil
+}
 
-	if err := SetDefault("bedtime", "23:00"); err != nil {
+// migrate brings the schema up to date and stores the default settings a new database lacks.
+func (s *sqlStore) migrate() error {
+	if err := migrateSchema(s.conn, migrations); err != nil {
 		return err
 	}
-	if err := SetDefault("notify_bedtime", "true"); err != nil {
-		return err
+	for key, value := range defaultSettings {
+		if err := s.setDefault(key, value); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
-func SetDefault(key, value string) error {
+// setDefault stores value unless key already has one.
+func (s *sqlStore) setDefault(key, value string) error {
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM settings WHERE key = ?", key).Scan(&count)
+	err := s.db.QueryRow("SELECT COUNT(*) FROM settings WHERE key = ?", key).Scan(&count)
 	if err != nil {
 		return err
 	}
 	if count == 0 {
-		_, err = DB.Exec("INSERT INTO settings (key, value) VALUES (?, ?)", key, value)
+		_, err = s.db.Exec("INSERT INTO settings (key, value) VALUES (?, ?)", key, value)
 		return err
 	}
 	return nil
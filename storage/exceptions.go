@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// AlarmException silences a repeating alarm on every day from Start to End, inclusive.
+// A single skipped occurrence has Start equal to End.
+type AlarmException struct {
+	ID      int64
+	AlarmID int64
+	Start   time.Time
+	End     time.Time
+}
+
+func (e AlarmException) Covers(day time.Time) bool {
+	d := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	return !d.Before(e.Start) && !d.After(e.End)
+}
+
+func (s *sqlStore) AddAlarmException(alarmID int64, start, end time.Time) error {
+	_, err := s.db.Exec("INSERT INTO alarm_exceptions (alarm_id, start_date, end_date) VALUES (?, ?, ?)",
+		alarmID, start.Format(DateLayout), end.Format(DateLayout))
+	if err != nil {
+		return fmt.Errorf("failed to add alarm exception: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteAlarmException(id int64) error {
+	_, err := s.db.Exec("DELETE FROM alarm_exceptions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete alarm exception: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) PruneAlarmExceptions(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM alarm_exceptions WHERE end_date < ?", before.Format(DateLayout))
+	if err != nil {
+		return fmt.Errorf("failed to prune alarm exceptions: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetAlarmExceptions(alarmID int64) ([]AlarmException, error) {
+	exceptions, err := s.queryAlarmExceptions("WHERE alarm_id = ?", alarmID)
+	if err != nil {
+		return nil, err
+	}
+	return exceptions[alarmID], nil
+}
+
+func (s *sqlStore) getAllAlarmExceptions() (map[int64][]AlarmException, error) {
+	return s.queryAlarmExceptions("")
+}
+
+func (s *sqlStore) queryAlarmExceptions(where string, args ...any) (map[int64][]AlarmException, error) {
+	rows, err := s.db.Query("SELECT id, alarm_id, start_date, end_date FROM alarm_exceptions "+where+" ORDER BY start_date ASC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alarm exceptions: %w", err)
+	}
+	defer rows.Close()
+
+	exceptions := make(map[int64][]AlarmException)
+	for rows.Next() {
+		var e AlarmException
+		var start, end string
+		if err := rows.Scan(&e.ID, &e.AlarmID, &start, &end); err != nil {
+			return nil, err
+		}
+		if e.Start, err = time.ParseInLocation(DateLayout, start, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid exception start %q: %w", start, err)
+		}
+		if e.End, err = time.ParseInLocation(DateLayout, end, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid exception end %q: %w", end, err)
+		}
+		exceptions[e.AlarmID] = append(exceptions[e.AlarmID], e)
+	}
+	return exceptions, rows.Err()
+}
@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// historyDays is how long sleep sessions and missed alarms are kept.
+const historyDays = 30
+
 type SleepSession struct {
 	ID          int
 	StartTime   time.Time
@@ -12,19 +17,19 @@ type SleepSession struct {
 	SnoozeCount int
 }
 
-func AddSleepSession(startTime, endTime time.Time, snoozeCount int) error {
+func (s *sqlStore) AddSleepSession(startTime, endTime time.Time, snoozeCount int) error {
 	query := `
 	INSERT INTO sleep_history (start_time, end_time, snooze_count)
 	VALUES (?, ?, ?)
 	`
-	_, err := DB.Exec(query, startTime, endTime, snoozeCount)
+	_, err := s.db.Exec(query, startTime, endTime, snoozeCount)
 	if err != nil {
 		return fmt.Errorf("failed to add sleep session: %w", err)
 	}
 
 	pruneQuery := `DELETE FROM sleep_history WHERE start_time < ?`
-	cutoff := time.Now().AddDate(0, 0, -30)
-	_, err = DB.Exec(pruneQuery, cutoff)
+	cutoff := time.Now().AddDate(0, 0, -historyDays)
+	_, err = s.db.Exec(pruneQuery, cutoff)
 	if err != nil {
 		fmt.Printf("Warning: failed to prune old sleep history: %v\n", err)
 	}
@@ -32,7 +37,7 @@ func AddSleepSession(startTime, endTime time.Time, snoozeCount int) error {
 	return nil
 }
 
-func GetHistory(days int) ([]SleepSession, error) {
+func (s *sqlStore) GetHistory(days int) ([]SleepSession, error) {
 	cutoff := time.Now().AddDate(0, 0, -days)
 
 	query := `
@@ -41,7 +46,7 @@ func GetHistory(days int) ([]SleepSession, error) {
 	WHERE start_time >= ?
 	ORDER BY start_time ASC
 	`
-	rows, err := DB.Query(query, cutoff)
+	rows, err := s.db.Query(query, cutoff)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sleep history: %w", err)
 	}
@@ -49,27 +54,37 @@ func GetHistory(days int) ([]SleepSession, error) {
 
 	var sessions []SleepSession
 	for rows.Next() {
-		var s SleepSession
-		if err := rows.Scan(&s.ID, &s.StartTime, &s.EndTime, &s.SnoozeCount); err != nil {
+		var session SleepSession
+		if err := rows.Scan(&session.ID, &session.StartTime, &session.EndTime, &session.SnoozeCount); err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, s)
+		sessions = append(sessions, session)
 	}
 
 	return sessions, nil
 }
 
-func GetLastSleepSession() (*SleepSession, error) {
+func (s *sqlStore) GetLastSleepSession() (*SleepSession, error) {
 	query := `
 	SELECT id, start_time, end_time, snooze_count
 	FROM sleep_history
 	ORDER BY end_time DESC
 	LIMIT 1
 	`
-	var s SleepSession
-	err := DB.QueryRow(query).Scan(&s.ID, &s.StartTime, &s.EndTime, &s.SnoozeCount)
+	var session SleepSession
+	err := s.db.QueryRow(query).Scan(&session.ID, &session.StartTime, &session.EndTime, &session.SnoozeCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	return &session, nil
+}
+
+func (s *sqlStore) ClearSleepHistory() error {
+	if _, err := s.db.Exec("DELETE FROM sleep_history"); err != nil {
+		return fmt.Errorf("failed to clear sleep history: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps everything in memory, for tests that do not need SQLite.
+type memoryStore struct {
+	mu sync.Mutex
+
+	alarms     []Alarm
+	exceptions []AlarmException
+	settings   map[string]string
+	sessions   []SleepSession
+	missed     []MissedAlarm
+	alarmState *AlarmState
+	// lastID numbers the rows of every kind.
+	lastID int64
+}
+
+// NewMemoryStore returns an empty Store that lives in memory, with the same defaults as a new database.
+func NewMemoryStore() *Store {
+	m := &memoryStore{settings: make(map[string]string)}
+	for key, value := range defaultSettings {
+		m.settings[key] = value
+	}
+	return NewStore(m, m, m, m, m)
+}
+
+func (m *memoryStore) nextID() int64 {
+	m.lastID++
+	return m.lastID
+}
+
+// Atomically runs apply against a copy of the store, which replaces the store only when
+// apply succeeds.
+func (m *memoryStore) Atomically(apply func(AlarmRepository, SettingsRepository, HistoryRepository) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx := &memoryStore{
+		alarms:     slices.Clone(m.alarms),
+		exceptions: slices.Clone(m.exceptions),
+		settings:   maps.Clone(m.settings),
+		sessions:   slices.Clone(m.sessions),
+		missed:     slices.Clone(m.missed),
+		lastID:     m.lastID,
+	}
+	if err := apply(tx, tx, tx); err != nil {
+		return err
+	}
+	m.alarms, m.exceptions, m.settings, m.sessions, m.missed = tx.alarms, tx.exceptions, tx.settings, tx.sessions, tx.missed
+	m.lastID = tx.lastID
+	return nil
+}
+
+func (m *memoryStore) findAlarm(id int64) int {
+	return slices.IndexFunc(m.alarms, func(a Alarm) bool { return a.ID == id })
+}
+
+func (m *memoryStore) AddAlarm(a Alarm) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a.ID = m.nextID()
+	a.Exceptions = nil
+	m.alarms = append(m.alarms, a)
+	return a.ID, nil
+}
+
+func (m *memoryStore) GetAlarm(id int64) (Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findAlarm(id)
+	if i < 0 {
+		return Alarm{}, fmt.Errorf("failed to get alarm %d: %w", id, ErrNotFound)
+	}
+	return m.alarms[i], nil
+}
+
+func (m *memoryStore) GetAlarms() ([]Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alarms := slices.Clone(m.alarms)
+	slices.SortStableFunc(alarms, func(a, b Alarm) int {
+		return cmp.Or(cmp.Compare(a.Hour, b.Hour), cmp.Compare(a.Minute, b.Minute))
+	})
+	for i := range alarms {
+		alarms[i].Exceptions = m.exceptionsOf(alarms[i].ID)
+	}
+	return alarms, nil
+}
+
+func (m *memoryStore) UpdateAlarm(a Alarm) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.findAlarm(a.ID); i >= 0 {
+		a.Exceptions = nil
+		m.alarms[i] = a
+	}
+	return nil
+}
+
+func (m *memoryStore) DeleteAlarm(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alarms = slices.DeleteFunc(m.alarms, func(a Alarm) bool { return a.ID == id })
+	m.exceptions = slices.DeleteFunc(m.exceptions, func(e AlarmException) bool { return e.AlarmID == id })
+	return nil
+}
+
+func (m *memoryStore) ToggleAlarm(id int64, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.findAlarm(id); i >= 0 {
+		m.alarms[i].Enabled = enabled
+	}
+	return nil
+}
+
+// day drops the time of day, as storing a date does.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func (m *memoryStore) AddAlarmException(alarmID int64, start, end time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exceptions = append(m.exceptions, AlarmException{ID: m.nextID(), AlarmID: alarmID, Start: day(start), End: day(end)})
+	return nil
+}
+
+func (m *memoryStore) DeleteAlarmException(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exceptions = slices.DeleteFunc(m.exceptions, func(e AlarmException) bool { return e.ID == id })
+	return nil
+}
+
+func (m *memoryStore) PruneAlarmExceptions(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := day(before)
+	m.exceptions = slices.DeleteFunc(m.exceptions, func(e AlarmException) bool { return e.End.Before(cutoff) })
+	return nil
+}
+
+func (m *memoryStore) GetAlarmExceptions(alarmID int64) ([]AlarmException, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exceptionsOf(alarmID), nil
+}
+
+func (m *memoryStore) exceptionsOf(alarmID int64) []AlarmException {
+	var exceptions []AlarmException
+	for _, e := range m.exceptions {
+		if e.AlarmID == alarmID {
+			exceptions = append(exceptions, e)
+		}
+	}
+	slices.SortStableFunc(exceptions, func(a, b AlarmException) int { return a.Start.Compare(b.Start) })
+	return exceptions
+}
+
+func (m *memoryStore) GetSetting(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.settings[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *memoryStore) GetSettings() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.settings), nil
+}
+
+func (m *memoryStore) SetSetting(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings[key] = value
+	return nil
+}
+
+func (m *memoryStore) DeleteSetting(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.settings, key)
+	return nil
+}
+
+func (m *memoryStore) AddSleepSession(startTime, endTime time.Time, snoozeCount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions = append(m.sessions, SleepSession{ID: int(m.nextID()), StartTime: startTime, EndTime: endTime, SnoozeCount: snoozeCount})
+	cutoff := time.Now().AddDate(0, 0, -historyDays)
+	m.sessions = slices.DeleteFunc(m.sessions, func(s SleepSession) bool { return s.StartTime.Before(cutoff) })
+	return nil
+}
+
+func (m *memoryStore) GetHistory(days int) ([]SleepSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := time.Now().AddDate(0, 0, -days)
+	var sessions []SleepSession
+	for _, s := range m.sessions {
+		if !s.StartTime.Before(cutoff) {
+			sessions = append(sessions, s)
+		}
+	}
+	slices.SortStableFunc(sessions, func(a, b SleepSession) int { return a.StartTime.Compare(b.StartTime) })
+	return sessions, nil
+}
+
+func (m *memoryStore) GetLastSleepSession() (*SleepSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sessions) == 0 {
+		return nil, ErrNotFound
+	}
+	last := slices.MaxFunc(m.sessions, func(a, b SleepSession) int { return a.EndTime.Compare(b.EndTime) })
+	return &last, nil
+}
+
+func (m *memoryStore) ClearSleepHistory() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions = nil
+	return nil
+}
+
+func (m *memoryStore) AddMissedAlarm(missed MissedAlarm) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	missed.ID = m.nextID()
+	m.missed = append(m.missed, missed)
+	cutoff := time.Now().AddDate(0, 0, -historyDays)
+	m.missed = slices.DeleteFunc(m.missed, func(ma MissedAlarm) bool { return ma.ScheduledAt.Before(cutoff) })
+	return nil
+}
+
+func (m *memoryStore) GetMissedAlarms(since time.Time) ([]MissedAlarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var missed []MissedAlarm
+	for _, ma := range m.missed {
+		if !ma.ScheduledAt.Before(since) {
+			missed = append(missed, ma)
+		}
+	}
+	slices.SortStableFunc(missed, func(a, b MissedAlarm) int { return a.ScheduledAt.Compare(b.ScheduledAt) })
+	return missed, nil
+}
+
+func (m *memoryStore) SaveAlarmState(s AlarmState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alarmState = &s
+	return nil
+}
+
+func (m *memoryStore) GetAlarmState() (AlarmState, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.alarmState == nil {
+		return AlarmState{}, false, nil
+	}
+	return *m.alarmState, true, nil
+}
+
+func (m *memoryStore) ClearAlarmState() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alarmState = nil
+	return nil
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaTooNew is returned when the database was written by a newer version of the app.
+// It is left untouched rather than used with a schema this version does not know.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version supports")
+
+// migration brings the schema from one version to the next. The schema version is the
+// number of migrations applied, kept in PRAGMA user_version.
+//
+// Databases from before versioning are at version 0 whatever their schema, so every
+// migration must also work when its tables or columns already exist.
+type migration struct {
+	name string
+	up   func(tx *sql.Tx) error
+}
+
+// migrations are applied in order. Append new ones; never reorder or edit released ones.
+var migrations = []migration{
+	{"create settings, alarms and sleep_history", func(tx *sql.Tx) error {
+		return execAll(tx, `
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT
+		);`, `
+		CREATE TABLE IF NOT EXISTS alarms (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hour INTEGER,
+			minute INTEGER,
+			enabled BOOLEAN
+		);`, `
+		CREATE TABLE IF NOT EXISTS sleep_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			start_time TIMESTAMP,
+			end_time TIMESTAMP,
+			snooze_count INTEGER
+		);`)
+	}},
+	{"add alarm weekdays and one-shot deletion", func(tx *sql.Tx) error {
+		if err := addColumnIfMissing(tx, "alarms", "days", "INTEGER NOT NULL DEFAULT 127"); err != nil {
+			return err
+		}
+		return addColumnIfMissing(tx, "alarms", "delete_after_ring", "BOOLEAN NOT NULL DEFAULT 0")
+	}},
+	{"add alarm dates and exceptions", func(tx *sql.Tx) error {
+		if err := addColumnIfMissing(tx, "alarms", "date", "TEXT"); err != nil {
+			return err
+		}
+		return execAll(tx, `
+		CREATE TABLE IF NOT EXISTS alarm_exceptions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alarm_id INTEGER NOT NULL,
+			start_date TEXT NOT NULL,
+			end_date TEXT NOT NULL
+		);`)
+	}},
+	{"add alarm labels, sounds and snooze overrides", func(tx *sql.Tx) error {
+		return addColumnsIfMissing(tx, "alarms", [][2]string{
+			{"label", "TEXT NOT NULL DEFAULT ''"},
+			{"audio_path", "TEXT NOT NULL DEFAULT ''"},
+			{"snooze_enabled", "BOOLEAN"},
+			{"snooze_duration", "INTEGER"},
+			{"snooze_max", "INTEGER NOT NULL DEFAULT 0"},
+		})
+	}},
+	{"add alarm fade-in and volume overrides", func(tx *sql.Tx) error {
+		return addColumnsIfMissing(tx, "alarms", [][2]string{
+			{"fade_in_seconds", "INTEGER"},
+			{"volume", "INTEGER"},
+		})
+	}},
+	{"create missed_alarms", func(tx *sql.Tx) error {
+		return execAll(tx, `
+		CREATE TABLE IF NOT EXISTS missed_alarms (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alarm_id INTEGER NOT NULL,
+			scheduled_at TIMESTAMP,
+			detected_at TIMESTAMP,
+			rang_late BOOLEAN NOT NULL DEFAULT 0
+		);`)
+	}},
+	{"add alarm smart wake window", func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "alarms", "smart_wake_window", "INTEGER")
+	}},
+	{"create alarm_state", func(tx *sql.Tx) error {
+		return execAll(tx, `
+		CREATE TABLE IF NOT EXISTS alarm_state (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			alarm_id INTEGER NOT NULL,
+			snoozed BOOLEAN NOT NULL DEFAULT 0,
+			since TIMESTAMP,
+			snooze_until TIMESTAMP,
+			snoozes_used INTEGER NOT NULL DEFAULT 0
+		);`)
+	}},
+}
+
+// schemaVersion returns the version stored in the database.
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrateSchema applies the migrations the database has not seen yet. Each one runs in its
+// own transaction together with the version bump, so a failure leaves the database at the
+// last version that applied cleanly.
+func migrateSchema(db *sql.DB, migrations []migration) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("failed to migrate database at version %d, newest known is %d: %w", version, len(migrations), ErrSchemaTooNew)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := applyMigration(db, i+1, migrations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", version, err)
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return fmt.Errorf("failed to migrate to version %d (%s): %w", version, m.name, err)
+	}
+	// PRAGMA does not take parameters; version is an int we computed.
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return fmt.Errorf("failed to set schema version %d: %w", version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", version, err)
+	}
+	return nil
+}
+
+func execAll(tx *sql.Tx, queries ...string) error {
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnsIfMissing adds each {column, definition} pair that table lacks.
+func addColumnsIfMissing(tx *sql.Tx, table string, columns [][2]string) error {
+	for _, c := range columns {
+		if err := addColumnIfMissing(tx, table, c[0], c[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column unless an unversioned database already has it.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("could not inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    bool
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("could not add %s.%s column: %w", table, column, err)
+	}
+	return nil
+}
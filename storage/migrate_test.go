@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openRaw(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// loadFixture writes the dump in testdata/name.sql to a new database file and returns its path.
+func loadFixture(t *testing.T, name string) string {
+	t.Helper()
+	dump, err := os.ReadFile("testdata/" + name + ".sql")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	path := t.TempDir() + "/user.db"
+	db := openRaw(t, path)
+	if _, err := db.Exec(string(dump)); err != nil {
+		t.Fatalf("failed to load fixture %s: %v", name, err)
+	}
+	db.Close()
+	return path
+}
+
+func version(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	v, err := schemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// schema describes every column of every table, ignoring column order.
+func schema(t *testing.T, db *sql.DB) map[string][]string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'sqlite_sequence'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	s := make(map[string][]string)
+	for _, table := range tables {
+		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var (
+				cid        int
+				name, typ  string
+				notNull    bool
+				defaultVal sql.NullString
+				pk         int
+			)
+			rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk)
+			s[table] = append(s[table], fmt.Sprintf("%s %s notnull=%v default=%v pk=%d", name, typ, notNull, defaultVal.String, pk))
+		}
+		rows.Close()
+		slices.Sort(s[table])
+	}
+	return s
+}
+
+func TestMigrate_Fixtures(t *testing.T) {
+	freshPath := t.TempDir() + "/user.db"
+	if _, err := InitDB(freshPath); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	fresh := schema(t, openRaw(t, freshPath))
+
+	tests := []struct {
+		fixture string
+		check   func(t *testing.T, s *Store)
+	}{
+		{"release", func(t *testing.T, s *Store) {
+			alarms, err := s.GetAlarms()
+			if err != nil {
+				t.Fatalf("GetAlarms failed: %v", err)
+			}
+			if len(alarms) != 2 || alarms[0].Hour != 6 || alarms[0].Minute != 45 || !alarms[0].Enabled || alarms[1].Enabled {
+				t.Fatalf("Expected both alarms kept, got %+v", alarms)
+			}
+			if alarms[0].Days != EveryDay || alarms[0].Label != "" || alarms[0].SnoozeDuration != nil || alarms[0].SmartWakeWindow != nil {
+				t.Errorf("Expected an every-day alarm without overrides, got %+v", alarms[0])
+			}
+			if bedtime, _ := s.GetBedtime(); bedtime != "22:30" {
+				t.Errorf("Expected the bedtime kept, got %q", bedtime)
+			}
+			if d, _ := s.GetSnoozeDuration(); d != 10 {
+				t.Errorf("Expected the snooze duration kept, got %d", d)
+			}
+			if last, err := s.GetLastSleepSession(); err != nil || last.SnoozeCount != 1 {
+				t.Errorf("Expected the sleep session kept, got %+v (%v)", last, err)
+			}
+		}},
+		{"exceptions", func(t *testing.T, s *Store) {
+			alarms, err := s.GetAlarms()
+			if err != nil {
+				t.Fatalf("GetAlarms failed: %v", err)
+			}
+			if len(alarms) != 2 || alarms[0].Days != WorkWeek || len(alarms[0].Exceptions) != 1 {
+				t.Fatalf("Expected the workweek alarm with its exception, got %+v", alarms)
+			}
+			if !alarms[0].Exceptions[0].Start.Equal(date(2025, time.June, 9)) || !alarms[0].Exceptions[0].End.Equal(date(2025, time.June, 13)) {
+				t.Errorf("Unexpected exception %+v", alarms[0].Exceptions[0])
+			}
+			if !alarms[1].Date.Equal(date(2025, time.June, 14)) || !alarms[1].DeleteAfterRing {
+				t.Errorf("Expected the dated one-shot alarm kept, got %+v", alarms[1])
+			}
+			if enabled, _ := s.GetSnoozeEnabled(); enabled {
+				t.Error("Expected snooze to stay disabled")
+			}
+		}},
+		{"missed-alarms", func(t *testing.T, s *Store) {
+			a, err := s.GetAlarm(1)
+			if err != nil {
+				t.Fatalf("GetAlarm failed: %v", err)
+			}
+			if a.Label != "Gym" || a.AudioPath != "/home/user/Music/birds.ogg" || a.SnoozeMax != 2 ||
+				a.SnoozeDuration == nil || *a.SnoozeDuration != 5 || a.Volume == nil || *a.Volume != 70 || a.SmartWakeWindow != nil {
+				t.Errorf("Expected the overrides kept, got %+v", a)
+			}
+			missed, err := s.GetMissedAlarms(date(2026, time.October, 1))
+			if err != nil || len(missed) != 1 || missed[0].AlarmID != 1 || !missed[0].RangLate {
+				t.Errorf("Expected the missed alarm kept, got %+v (%v)", missed, err)
+			}
+			if grace, _ := s.GetMissedAlarmGrace(); grace != 20 {
+				t.Errorf("Expected the grace period kept, got %d", grace)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			t.Parallel()
+			path := loadFixture(t, tt.fixture)
+
+			s, err := InitDB(path)
+			if err != nil {
+				t.Fatalf("InitDB failed: %v", err)
+			}
+			tt.check(t, s)
+
+			// Columns and tables added since must work too.
+			thirty := 30
+			id, err := s.AddAlarm(Alarm{Hour: 5, Enabled: true, Days: Weekend, SmartWakeWindow: &thirty})
+			if err != nil || id != 3 {
+				t.Errorf("Expected the new alarm to get ID 3, got %d (%v)", id, err)
+			}
+			if err := s.SaveAlarmState(AlarmState{AlarmID: id, Since: time.Now()}); err != nil {
+				t.Errorf("SaveAlarmState failed: %v", err)
+			}
+
+			db := openRaw(t, path)
+			if v := version(t, db); v != len(migrations) {
+				t.Errorf("Expected schema version %d, got %d", len(migrations), v)
+			}
+			if got := schema(t, db); !maps.EqualFunc(got, fresh, slices.Equal) {
+				t.Errorf("Upgraded schema differs from a new one:\n got %v\nwant %v", got, fresh)
+			}
+
+			if _, err := InitDB(path); err != nil {
+				t.Fatalf("Reopening failed: %v", err)
+			}
+			if alarms, _ := s.GetAlarms(); len(alarms) != 3 {
+				t.Errorf("Expected reopening to keep all alarms, got %+v", alarms)
+			}
+		})
+	}
+}
+
+func TestMigrate_FailureRollsBack(t *testing.T) {
+	t.Parallel()
+	db := openRaw(t, t.TempDir()+"/user.db")
+	failing := []migration{
+		{"create a", func(tx *sql.Tx) error {
+			return execAll(tx, "CREATE TABLE a (id INTEGER)")
+		}},
+		{"create b, then fail", func(tx *sql.Tx) error {
+			if err := execAll(tx, "CREATE TABLE b (id INTEGER)"); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		}},
+	}
+
+	if err := migrateSchema(db, failing); err == nil {
+		t.Fatal("Expected the failing migration to be reported")
+	}
+	if v := version(t, db); v != 1 {
+		t.Errorf("Expected to stay at version 1, got %d", v)
+	}
+	if _, err := db.Exec("SELECT * FROM b"); err == nil {
+		t.Error("Expected the failed migration's table to be rolled back")
+	}
+
+	failing[1].up = func(tx *sql.Tx) error { return execAll(tx, "CREATE TABLE b (id INTEGER)") }
+	if err := migrateSchema(db, failing); err != nil {
+		t.Fatalf("Expected the fixed migration to apply, got %v", err)
+	}
+	if v := version(t, db); v != 2 {
+		t.Errorf("Expected version 2, got %d", v)
+	}
+}
+
+func TestMigrate_RefusesNewerSchema(t *testing.T) {
+	t.Parallel()
+	path := t.TempDir() + "/user.db"
+	db := openRaw(t, path)
+	newer := len(migrations) + 1
+	if _, err := db.Exec(fmt.Sprintf("CREATE TABLE future (id INTEGER); PRAGMA user_version = %d", newer)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := InitDB(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Expected ErrSchemaTooNew, got %v", err)
+	}
+	if v := version(t, db); v != newer {
+		t.Errorf("Expected the version left at %d, got %d", newer, v)
+	}
+	if got := schema(t, db); len(got) != 1 {
+		t.Errorf("Expected the database left untouched, got %v", got)
+	}
+}
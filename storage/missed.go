@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// MissedAlarm is an alarm whose time passed while the device was suspended or the clock jumped.
+type MissedAlarm struct {
+	ID          int64
+	AlarmID     int64
+	ScheduledAt time.Time
+	DetectedAt  time.Time
+	// RangLate is true when the alarm still rang because it was detected within the grace period.
+	RangLate bool
+}
+
+func (s *sqlStore) AddMissedAlarm(m MissedAlarm) error {
+	_, err := s.db.Exec("INSERT INTO missed_alarms (alarm_id, scheduled_at, detected_at, rang_late) VALUES (?, ?, ?, ?)",
+		m.AlarmID, m.ScheduledAt, m.DetectedAt, m.RangLate)
+	if err != nil {
+		return fmt.Errorf("failed to add missed alarm: %w", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -historyDays)
+	if _, err := s.db.Exec("DELETE FROM missed_alarms WHERE scheduled_at < ?", cutoff); err != nil {
+		fmt.Printf("Warning: failed to prune old missed alarms: %v\n", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetMissedAlarms(since time.Time) ([]MissedAlarm, error) {
+	rows, err := s.db.Query("SELECT id, alarm_id, scheduled_at, detected_at, rang_late FROM missed_alarms WHERE scheduled_at >= ? ORDER BY scheduled_at ASC", since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query missed alarms: %w", err)
+	}
+	defer rows.Close()
+
+	var missed []MissedAlarm
+	for rows.Next() {
+		var m MissedAlarm
+		if err := rows.Scan(&m.ID, &m.AlarmID, &m.ScheduledAt, &m.DetectedAt, &m.RangLate); err != nil {
+			return nil, err
+		}
+		missed = append(missed, m)
+	}
+	return missed, rows.Err()
+}
@@ -1,102 +1,173 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
-func GetSetting(key string) (string, error) {
+// defaultSettings are stored when a database is created.
+var defaultSettings = map[string]string{
+	"bedtime":        "23:00",
+	"notify_bedtime": "true",
+}
+
+func (s *sqlStore) GetSetting(key string) (string, error) {
 	var value string
-	err := DB.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	err := s.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
 	if err != nil {
 		return "", err
 	}
 	return value, nil
 }
 
-func SetSetting(key, value string) error {
+func (s *sqlStore) GetSettings() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value.String
+	}
+	return settings, rows.Err()
+}
+
+func (s *sqlStore) SetSetting(key, value string) error {
 	query := `
     INSERT INTO settings (key, value) 
     VALUES (?, ?)
     ON CONFLICT(key) DO UPDATE SET value = excluded.value;
     `
-	_, err := DB.Exec(query, key, value)
+	_, err := s.db.Exec(query, key, value)
 	if err != nil {
 		return fmt.Errorf("failed to set setting %s: %w", key, err)
 	}
 	return nil
 }
 
-func GetBedtime() (string, error) {
-	return GetSetting("bedtime")
+func (s *sqlStore) DeleteSetting(key string) error {
+	if _, err := s.db.Exec("DELETE FROM settings WHERE key = ?", key); err != nil {
+		return fmt.Errorf("failed to delete setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// StateSettings are settings rows the app uses for its own state rather than user preferences.
+// They are left out of backups.
+var StateSettings = []string{"sleep_start_time"}
+
+func (s *Store) GetBedtime() (string, error) {
+	return s.GetSetting("bedtime")
 }
 
-func SetBedtime(timeStr string) error {
-	return SetSetting("bedtime", timeStr)
+func (s *Store) SetBedtime(timeStr string) error {
+	return s.SetSetting("bedtime", timeStr)
 }
 
-func GetNotifyBedtime() (bool, error) {
-	val, err := GetSetting("notify_bedtime")
+func (s *Store) GetNotifyBedtime() (bool, error) {
+	val, err := s.GetSetting("notify_bedtime")
 	if err != nil {
 		return false, err
 	}
 	return val == "true", nil
 }
 
-func SetNotifyBedtime(enabled bool) error {
+func (s *Store) SetNotifyBedtime(enabled bool) error {
 	val := "false"
 	if enabled {
 		val = "true"
 	}
-	return SetSetting("notify_bedtime", val)
+	return s.SetSetting("notify_bedtime", val)
 }
 
-func GetSmartWakeUp() (bool, error) {
-	val, err := GetSetting("smart_wake_up")
+func (s *Store) GetSmartWakeUp() (bool, error) {
+	val, err := s.GetSetting("smart_wake_up")
 	if err != nil {
 		return true, nil
 	}
 	return val == "true", nil
 }
 
-func SetSmartWakeUp(enabled bool) error {
+func (s *Store) SetSmartWakeUp(enabled bool) error {
 	val := "false"
 	if enabled {
 		val = "true"
 	}
-	return SetSetting("smart_wake_up", val)
+	return s.SetSetting("smart_wake_up", val)
+}
+
+// Bounds of the smart wake window, in minutes.
+const (
+	MinSmartWakeWindow     = 10
+	MaxSmartWakeWindow     = 45
+	DefaultSmartWakeWindow = 30
+)
+
+// ClampSmartWakeWindow keeps a window length within MinSmartWakeWindow and MaxSmartWakeWindow.
+func ClampSmartWakeWindow(minutes int) int {
+	return max(MinSmartWakeWindow, min(minutes, MaxSmartWakeWindow))
 }
 
-func GetSleepStartTime() (time.Time, error) {
-	val, err := GetSetting("sleep_start_time")
+// GetSmartWakeWindow returns how many minutes before its time an alarm may ring during light sleep.
+func (s *Store) GetSmartWakeWindow() (int, error) {
+	val, err := s.GetSetting("smart_wake_window")
+	if err != nil {
+		return DefaultSmartWakeWindow, nil
+	}
+	var m int
+	_, err = fmt.Sscanf(val, "%d", &m)
+	if err != nil {
+		return DefaultSmartWakeWindow, nil
+	}
+	return ClampSmartWakeWindow(m), nil
+}
+
+func (s *Store) SetSmartWakeWindow(minutes int) error {
+	return s.SetSetting("smart_wake_window", fmt.Sprintf("%d", ClampSmartWakeWindow(minutes)))
+}
+
+func (s *Store) GetSleepStartTime() (time.Time, error) {
+	val, err := s.GetSetting("sleep_start_time")
 	if err != nil || val == "" {
 		return time.Time{}, err
 	}
 	return time.Parse(time.RFC3339, val)
 }
 
-func SetSleepStartTime(t time.Time) error {
-	return SetSetting("sleep_start_time", t.Format(time.RFC3339))
+func (s *Store) SetSleepStartTime(t time.Time) error {
+	return s.SetSetting("sleep_start_time", t.Format(time.RFC3339))
 }
 
-func ClearSleepStartTime() error {
-	return SetSetting("sleep_start_time", "")
+func (s *Store) ClearSleepStartTime() error {
+	return s.SetSetting("sleep_start_time", "")
 }
 
-func GetAlarmAudioPath() (string, error) {
-	val, err := GetSetting("alarm_audio_path")
+func (s *Store) GetAlarmAudioPath() (string, error) {
+	val, err := s.GetSetting("alarm_audio_path")
 	if err != nil {
 		return "", nil
 	}
 	return val, nil
 }
 
-func SetAlarmAudioPath(path string) error {
-	return SetSetting("alarm_audio_path", path)
+func (s *Store) SetAlarmAudioPath(path string) error {
+	return s.SetSetting("alarm_audio_path", path)
 }
 
-func GetSnoozeDuration() (int, error) {
-	val, err := GetSetting("snooze_duration")
+func (s *Store) GetSnoozeDuration() (int, error) {
+	val, err := s.GetSetting("snooze_duration")
 	if err != nil {
 		return 15, nil
 	}
@@ -108,22 +179,133 @@ func GetSnoozeDuration() (int, error) {
 	return d, nil
 }
 
-func SetSnoozeDuration(minutes int) error {
-	return SetSetting("snooze_duration", fmt.Sprintf("%d", minutes))
+func (s *Store) SetSnoozeDuration(minutes int) error {
+	return s.SetSetting("snooze_duration", fmt.Sprintf("%d", minutes))
 }
 
-func GetSnoozeEnabled() (bool, error) {
-	val, err := GetSetting("snooze_enabled")
+func (s *Store) GetSnoozeEnabled() (bool, error) {
+	val, err := s.GetSetting("snooze_enabled")
 	if err != nil {
 		return true, nil
 	}
 	return val == "true", nil
 }
 
-func SetSnoozeEnabled(enabled bool) error {
+func (s *Store) SetSnoozeEnabled(enabled bool) error {
 	val := "false"
 	if enabled {
 		val = "true"
 	}
-	return SetSetting("snooze_enabled", val)
+	return s.SetSetting("snooze_enabled", val)
+}
+
+// GetFadeInDuration returns how many seconds the alarm takes to ramp up to full volume. Zero disables the fade.
+func (s *Store) GetFadeInDuration() (int, error) {
+	val, err := s.GetSetting("fade_in_duration")
+	if err != nil {
+		return 0, nil
+	}
+	var seconds int
+	_, err = fmt.Sscanf(val, "%d", &seconds)
+	if err != nil {
+		return 0, nil
+	}
+	return seconds, nil
+}
+
+func (s *Store) SetFadeInDuration(seconds int) error {
+	return s.SetSetting("fade_in_duration", fmt.Sprintf("%d", seconds))
+}
+
+// GetAlarmVolume returns the output volume alarms ring at, in percent.
+func (s *Store) GetAlarmVolume() (int, error) {
+	val, err := s.GetSetting("alarm_volume")
+	if err != nil {
+		return 100, nil
+	}
+	var v int
+	_, err = fmt.Sscanf(val, "%d", &v)
+	if err != nil {
+		return 100, nil
+	}
+	return v, nil
+}
+
+func (s *Store) SetAlarmVolume(percent int) error {
+	return s.SetSetting("alarm_volume", fmt.Sprintf("%d", percent))
+}
+
+// GetMissedAlarmGrace returns how many minutes late an alarm still rings after a suspend or
+// clock jump. Alarms detected later than that only leave a notification. Zero never rings late.
+func (s *Store) GetMissedAlarmGrace() (int, error) {
+	val, err := s.GetSetting("missed_alarm_grace")
+	if err != nil {
+		return 10, nil
+	}
+	var m int
+	_, err = fmt.Sscanf(val, "%d", &m)
+	if err != nil {
+		return 10, nil
+	}
+	return m, nil
+}
+
+func (s *Store) SetMissedAlarmGrace(minutes int) error {
+	return s.SetSetting("missed_alarm_grace", fmt.Sprintf("%d", minutes))
+}
+
+// GetSuspendInhibitHorizon returns how many minutes before an alarm the daemon keeps the
+// system from suspending. Zero never inhibits suspend.
+func (s *Store) GetSuspendInhibitHorizon() (int, error) {
+	val, err := s.GetSetting("suspend_inhibit_horizon")
+	if err != nil {
+		return 15, nil
+	}
+	var m int
+	_, err = fmt.Sscanf(val, "%d", &m)
+	if err != nil {
+		return 15, nil
+	}
+	return m, nil
+}
+
+func (s *Store) SetSuspendInhibitHorizon(minutes int) error {
+	return s.SetSetting("suspend_inhibit_horizon", fmt.Sprintf("%d", minutes))
+}
+
+// Audio output policies decide which sink an alarm plays on when no sink is pinned,
+// or when the pinned sink is not connected.
+const (
+	OutputAlwaysSpeaker    = "speaker"
+	OutputFollowDefault    = "default"
+	OutputPreferHeadphones = "headphones"
+)
+
+func (s *Store) GetAudioOutputPolicy() (string, error) {
+	val, err := s.GetSetting("audio_output_policy")
+	if err != nil {
+		return OutputAlwaysSpeaker, nil
+	}
+	switch val {
+	case OutputAlwaysSpeaker, OutputFollowDefault, OutputPreferHeadphones:
+		return val, nil
+	}
+	return OutputAlwaysSpeaker, nil
+}
+
+func (s *Store) SetAudioOutputPolicy(policy string) error {
+	return s.SetSetting("audio_output_policy", policy)
+}
+
+// GetAudioOutputSink returns the name of the sink the user pinned alarms to, or "" for none.
+func (s *Store) GetAudioOutputSink() (string, error) {
+	val, err := s.GetSetting("audio_output_sink")
+	if err != nil {
+		return "", nil
+	}
+	return val, nil
+}
+
+func (s *Store) SetAudioOutputSink(name string) error {
+	return s.SetSetting("audio_output_sink", name)
 }
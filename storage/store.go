@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a requested alarm, setting or session does not exist.
+var ErrNotFound = errors.New("not found")
+
+// AlarmRepository keeps alarms and their exceptions.
+type AlarmRepository interface {
+	// AddAlarm stores a new alarm and returns its ID.
+	AddAlarm(a Alarm) (int64, error)
+	GetAlarm(id int64) (Alarm, error)
+	// GetAlarms returns every alarm with its exceptions, ordered by time of day.
+	GetAlarms() ([]Alarm, error)
+	UpdateAlarm(a Alarm) error
+	// DeleteAlarm removes an alarm together with its exceptions.
+	DeleteAlarm(id int64) error
+	ToggleAlarm(id int64, enabled bool) error
+
+	AddAlarmException(alarmID int64, start, end time.Time) error
+	DeleteAlarmException(id int64) error
+	// PruneAlarmExceptions drops exceptions that ended before the given day.
+	PruneAlarmExceptions(before time.Time) error
+	GetAlarmExceptions(alarmID int64) ([]AlarmException, error)
+}
+
+// SettingsRepository keeps settings as text values by key.
+type SettingsRepository interface {
+	GetSetting(key string) (string, error)
+	// GetSettings returns every stored setting by key.
+	GetSettings() (map[string]string, error)
+	SetSetting(key, value string) error
+	DeleteSetting(key string) error
+}
+
+// HistoryRepository keeps past sleep sessions and missed alarms. Both are kept for 30 days.
+type HistoryRepository interface {
+	AddSleepSession(startTime, endTime time.Time, snoozeCount int) error
+	// GetHistory returns the sessions that started in the last days days, oldest first.
+	GetHistory(days int) ([]SleepSession, error)
+	GetLastSleepSession() (*SleepSession, error)
+	ClearSleepHistory() error
+
+	AddMissedAlarm(m MissedAlarm) error
+	// GetMissedAlarms returns the missed alarms scheduled at or after since, oldest first.
+	GetMissedAlarms(since time.Time) ([]MissedAlarm, error)
+}
+
+// StateRepository keeps the ringing or snoozed alarm across restarts.
+type StateRepository interface {
+	// SaveAlarmState replaces the stored state. There is at most one ringing or snoozed alarm.
+	SaveAlarmState(s AlarmState) error
+	// GetAlarmState returns the stored state, or false when no alarm was ringing or snoozed.
+	GetAlarmState() (AlarmState, bool, error)
+	ClearAlarmState() error
+}
+
+// ImportRepository applies a backup as one change.
+type ImportRepository interface {
+	// Atomically runs apply against repositories whose writes are kept only when it returns nil.
+	Atomically(apply func(AlarmRepository, SettingsRepository, HistoryRepository) error) error
+}
+
+// Store is where the app keeps its data. It reports writes to its observers, whichever
+// repositories it is made of.
+type Store struct {
+	alarms   AlarmRepository
+	settings SettingsRepository
+	history  HistoryRepository
+	state    StateRepository
+	imports  ImportRepository
+
+	// OnAlarmsWritten is called after an alarm or one of its exceptions changes.
+	// It runs on the goroutine that made the change.
+	OnAlarmsWritten func()
+	// OnSettingWritten is called with the key of every setting that is stored. A backup
+	// import, which may change any setting, calls it once with an empty key.
+	OnSettingWritten func(key string)
+}
+
+func NewStore(alarms AlarmRepository, settings SettingsRepository, history HistoryRepository, state StateRepository, imports ImportRepository) *Store {
+	return &Store{alarms: alarms, settings: settings, history: history, state: state, imports: imports}
+}
+
+func (s *Store) alarmsWritten() {
+	if s.OnAlarmsWritten != nil {
+		s.OnAlarmsWritten()
+	}
+}
+
+// alarmsWrittenIf reports a write when err is nil and passes err on.
+func (s *Store) alarmsWrittenIf(err error) error {
+	if err == nil {
+		s.alarmsWritten()
+	}
+	return err
+}
+
+func (s *Store) AddAlarm(a Alarm) (int64, error) {
+	id, err := s.alarms.AddAlarm(a)
+	return id, s.alarmsWrittenIf(err)
+}
+
+func (s *Store) GetAlarm(id int64) (Alarm, error) {
+	return s.alarms.GetAlarm(id)
+}
+
+func (s *Store) GetAlarms() ([]Alarm, error) {
+	return s.alarms.GetAlarms()
+}
+
+func (s *Store) UpdateAlarm(a Alarm) error {
+	return s.alarmsWrittenIf(s.alarms.UpdateAlarm(a))
+}
+
+func (s *Store) DeleteAlarm(id int64) error {
+	return s.alarmsWrittenIf(s.alarms.DeleteAlarm(id))
+}
+
+func (s *Store) ToggleAlarm(id int64, enabled bool) error {
+	return s.alarmsWrittenIf(s.alarms.ToggleAlarm(id, enabled))
+}
+
+// AddAlarmException silences a repeating alarm from start to end. The days may be given in either order.
+func (s *Store) AddAlarmException(alarmID int64, start, end time.Time) error {
+	if end.Before(start) {
+		start, end = end, start
+	}
+	return s.alarmsWrittenIf(s.alarms.AddAlarmException(alarmID, start, end))
+}
+
+func (s *Store) DeleteAlarmException(id int64) error {
+	return s.alarmsWrittenIf(s.alarms.DeleteAlarmException(id))
+}
+
+func (s *Store) PruneAlarmExceptions(before time.Time) error {
+	return s.alarmsWrittenIf(s.alarms.PruneAlarmExceptions(before))
+}
+
+func (s *Store) GetAlarmExceptions(alarmID int64) ([]AlarmException, error) {
+	return s.alarms.GetAlarmExceptions(alarmID)
+}
+
+func (s *Store) GetSetting(key string) (string, error) {
+	return s.settings.GetSetting(key)
+}
+
+func (s *Store) SetSetting(key, value string) error {
+	if err := s.settings.SetSetting(key, value); err != nil {
+		return err
+	}
+	if s.OnSettingWritten != nil {
+		s.OnSettingWritten(key)
+	}
+	return nil
+}
+
+func (s *Store) GetSettings() (map[string]string, error) {
+	return s.settings.GetSettings()
+}
+
+func (s *Store) DeleteSetting(key string) error {
+	if err := s.settings.DeleteSetting(key); err != nil {
+		return err
+	}
+	if s.OnSettingWritten != nil {
+		s.OnSettingWritten(key)
+	}
+	return nil
+}
+
+func (s *Store) AddSleepSession(startTime, endTime time.Time, snoozeCount int) error {
+	return s.history.AddSleepSession(startTime, endTime, snoozeCount)
+}
+
+func (s *Store) GetHistory(days int) ([]SleepSession, error) {
+	return s.history.GetHistory(days)
+}
+
+func (s *Store) GetLastSleepSession() (*SleepSession, error) {
+	return s.history.GetLastSleepSession()
+}
+
+func (s *Store) ClearSleepHistory() error {
+	return s.history.ClearSleepHistory()
+}
+
+func (s *Store) AddMissedAlarm(m MissedAlarm) error {
+	return s.history.AddMissedAlarm(m)
+}
+
+func (s *Store) GetMissedAlarms(since time.Time) ([]MissedAlarm, error) {
+	return s.history.GetMissedAlarms(since)
+}
+
+func (s *Store) SaveAlarmState(st AlarmState) error {
+	return s.state.SaveAlarmState(st)
+}
+
+func (s *Store) GetAlarmState() (AlarmState, bool, error) {
+	return s.state.GetAlarmState()
+}
+
+func (s *Store) ClearAlarmState() error {
+	return s.state.ClearAlarmState()
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// backends runs test against a fresh SQLite store and a fresh memory store, which must behave alike.
+func backends(t *testing.T, test func(t *testing.T, s *Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		t.Parallel()
+		s, err := InitDB(t.TempDir() + "/user.db")
+		if err != nil {
+			t.Fatalf("InitDB failed: %v", err)
+		}
+		test(t, s)
+	})
+	t.Run("memory", func(t *testing.T) {
+		t.Parallel()
+		test(t, NewMemoryStore())
+	})
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+func TestStore_Alarms(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		writes := 0
+		s.OnAlarmsWritten = func() { writes++ }
+
+		thirty := 30
+		late, err := s.AddAlarm(Alarm{Hour: 8, Minute: 15, Enabled: true, Label: "Late", Days: Weekend})
+		if err != nil {
+			t.Fatalf("AddAlarm failed: %v", err)
+		}
+		early, err := s.AddAlarm(Alarm{Hour: 6, Minute: 30, Enabled: true, Days: WorkWeek, SmartWakeWindow: &thirty})
+		if err != nil {
+			t.Fatalf("AddAlarm failed: %v", err)
+		}
+
+		alarms, err := s.GetAlarms()
+		if err != nil {
+			t.Fatalf("GetAlarms failed: %v", err)
+		}
+		if len(alarms) != 2 || alarms[0].ID != early || alarms[1].ID != late {
+			t.Fatalf("Expected the alarms ordered by time, got %+v", alarms)
+		}
+		if alarms[0].SmartWakeWindow == nil || *alarms[0].SmartWakeWindow != 30 || alarms[1].SmartWakeWindow != nil {
+			t.Errorf("Expected only the early alarm to override its window, got %+v", alarms)
+		}
+
+		a := alarms[1]
+		a.Label = "Lie-in"
+		a.Date = date(2026, time.May, 2)
+		if err := s.UpdateAlarm(a); err != nil {
+			t.Fatalf("UpdateAlarm failed: %v", err)
+		}
+		if err := s.ToggleAlarm(late, false); err != nil {
+			t.Fatalf("ToggleAlarm failed: %v", err)
+		}
+		got, err := s.GetAlarm(late)
+		if err != nil {
+			t.Fatalf("GetAlarm failed: %v", err)
+		}
+		if got.Label != "Lie-in" || !got.Date.Equal(a.Date) || got.Enabled {
+			t.Errorf("Expected the updated, disabled alarm, got %+v", got)
+		}
+
+		if err := s.DeleteAlarm(late); err != nil {
+			t.Fatalf("DeleteAlarm failed: %v", err)
+		}
+		if _, err := s.GetAlarm(late); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for a deleted alarm, got %v", err)
+		}
+		if writes != 5 {
+			t.Errorf("Expected 5 writes reported, got %d", writes)
+		}
+	})
+}
+
+func TestStore_Exceptions(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		id, _ := s.AddAlarm(Alarm{Hour: 7, Enabled: true, Days: EveryDay})
+
+		if err := s.AddAlarmException(id, date(2026, time.August, 14), date(2026, time.August, 10)); err != nil {
+			t.Fatalf("AddAlarmException failed: %v", err)
+		}
+		if err := s.AddAlarmException(id, date(2026, time.July, 1), date(2026, time.July, 1)); err != nil {
+			t.Fatalf("AddAlarmException failed: %v", err)
+		}
+
+		alarms, _ := s.GetAlarms()
+		exceptions := alarms[0].Exceptions
+		if len(exceptions) != 2 || !exceptions[0].Start.Equal(date(2026, time.July, 1)) {
+			t.Fatalf("Expected two exceptions, oldest first, got %+v", exceptions)
+		}
+		if !exceptions[1].Start.Equal(date(2026, time.August, 10)) || !exceptions[1].End.Equal(date(2026, time.August, 14)) {
+			t.Errorf("Expected the reversed range to be swapped, got %+v", exceptions[1])
+		}
+		if !alarms[0].IsSkipped(date(2026, time.August, 12)) {
+			t.Error("Expected the alarm to be skipped within the range")
+		}
+
+		if err := s.PruneAlarmExceptions(date(2026, time.August, 1)); err != nil {
+			t.Fatalf("PruneAlarmExceptions failed: %v", err)
+		}
+		exceptions, _ = s.GetAlarmExceptions(id)
+		if len(exceptions) != 1 {
+			t.Fatalf("Expected the July exception to be pruned, got %+v", exceptions)
+		}
+		if err := s.DeleteAlarmException(exceptions[0].ID); err != nil {
+			t.Fatalf("DeleteAlarmException failed: %v", err)
+		}
+		if exceptions, _ = s.GetAlarmExceptions(id); len(exceptions) != 0 {
+			t.Errorf("Expected no exceptions left, got %+v", exceptions)
+		}
+	})
+}
+
+func TestStore_Settings(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		var written []string
+		s.OnSettingWritten = func(key string) { written = append(written, key) }
+
+		if bedtime, err := s.GetBedtime(); err != nil || bedtime != "23:00" {
+			t.Errorf("Expected the default bedtime, got %q (%v)", bedtime, err)
+		}
+		if _, err := s.GetSetting("missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for a missing setting, got %v", err)
+		}
+		if d, _ := s.GetSnoozeDuration(); d != 15 {
+			t.Errorf("Expected the default snooze duration, got %d", d)
+		}
+
+		s.SetSnoozeDuration(5)
+		s.SetSmartWakeWindow(90)
+		if d, _ := s.GetSnoozeDuration(); d != 5 {
+			t.Errorf("Expected snooze duration 5, got %d", d)
+		}
+		if w, _ := s.GetSmartWakeWindow(); w != MaxSmartWakeWindow {
+			t.Errorf("Expected the window clamped to %d, got %d", MaxSmartWakeWindow, w)
+		}
+		if len(written) != 2 || written[0] != "snooze_duration" || written[1] != "smart_wake_window" {
+			t.Errorf("Unexpected writes reported: %v", written)
+		}
+	})
+}
+
+func TestStore_History(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		if _, err := s.GetLastSleepSession(); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound without sessions, got %v", err)
+		}
+
+		now := time.Now().Truncate(time.Second)
+		s.AddSleepSession(now.AddDate(0, 0, -40), now.AddDate(0, 0, -40).Add(8*time.Hour), 0)
+		s.AddSleepSession(now.AddDate(0, 0, -1), now.AddDate(0, 0, -1).Add(7*time.Hour), 2)
+		s.AddSleepSession(now.AddDate(0, 0, -3), now.AddDate(0, 0, -3).Add(6*time.Hour), 1)
+
+		sessions, err := s.GetHistory(30)
+		if err != nil {
+			t.Fatalf("GetHistory failed: %v", err)
+		}
+		if len(sessions) != 2 || sessions[0].SnoozeCount != 1 || sessions[1].SnoozeCount != 2 {
+			t.Errorf("Expected the two recent sessions, oldest first, got %+v", sessions)
+		}
+		last, err := s.GetLastSleepSession()
+		if err != nil || last.SnoozeCount != 2 {
+			t.Errorf("Expected the last session to have 2 snoozes, got %+v (%v)", last, err)
+		}
+
+		s.AddMissedAlarm(MissedAlarm{AlarmID: 3, ScheduledAt: now.Add(-time.Hour), DetectedAt: now, RangLate: true})
+		s.AddMissedAlarm(MissedAlarm{AlarmID: 4, ScheduledAt: now.Add(-2 * time.Hour), DetectedAt: now})
+		missed, err := s.GetMissedAlarms(now.Add(-3 * time.Hour))
+		if err != nil {
+			t.Fatalf("GetMissedAlarms failed: %v", err)
+		}
+		if len(missed) != 2 || missed[0].AlarmID != 4 || !missed[1].RangLate {
+			t.Errorf("Expected both missed alarms, oldest first, got %+v", missed)
+		}
+	})
+}
+
+func TestStore_AlarmState(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		if _, ok, err := s.GetAlarmState(); ok || err != nil {
+			t.Fatalf("Expected no state, got ok=%v err=%v", ok, err)
+		}
+
+		now := time.Now().Truncate(time.Second)
+		want := AlarmState{AlarmID: 2, Snoozed: true, Since: now, SnoozeUntil: now.Add(10 * time.Minute), SnoozesUsed: 1}
+		if err := s.SaveAlarmState(want); err != nil {
+			t.Fatalf("SaveAlarmState failed: %v", err)
+		}
+		got, ok, err := s.GetAlarmState()
+		if err != nil || !ok || got.AlarmID != 2 || !got.Snoozed || !got.SnoozeUntil.Equal(want.SnoozeUntil) || got.SnoozesUsed != 1 {
+			t.Errorf("Expected %+v, got %+v ok=%v err=%v", want, got, ok, err)
+		}
+
+		if err := s.ClearAlarmState(); err != nil {
+			t.Fatalf("ClearAlarmState failed: %v", err)
+		}
+		if _, ok, _ := s.GetAlarmState(); ok {
+			t.Error("Expected the state to be cleared")
+		}
+	})
+}
+
+func TestStore_Atomically(t *testing.T) {
+	backends(t, func(t *testing.T, s *Store) {
+		now := time.Now().Truncate(time.Second)
+		s.AddAlarm(Alarm{Hour: 7, Enabled: true, Days: EveryDay})
+		s.SetBedtime("22:00")
+		s.AddSleepSession(now.Add(-8*time.Hour), now, 0)
+
+		failed := errors.New("failed")
+		err := s.imports.Atomically(func(alarms AlarmRepository, settings SettingsRepository, history HistoryRepository) error {
+			all, _ := alarms.GetAlarms()
+			alarms.DeleteAlarm(all[0].ID)
+			alarms.AddAlarm(Alarm{Hour: 9, Enabled: true, Days: Weekend})
+			settings.SetSetting("bedtime", "23:30")
+			history.ClearSleepHistory()
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("Expected the error of apply, got %v", err)
+		}
+
+		if alarms, _ := s.GetAlarms(); len(alarms) != 1 || alarms[0].Hour != 7 {
+			t.Errorf("Expected the alarms untouched, got %+v", alarms)
+		}
+		if bedtime, _ := s.GetBedtime(); bedtime != "22:00" {
+			t.Errorf("Expected the bedtime untouched, got %q", bedtime)
+		}
+		if sessions, _ := s.GetHistory(30); len(sessions) != 1 {
+			t.Errorf("Expected the history untouched, got %+v", sessions)
+		}
+
+		err = s.imports.Atomically(func(alarms AlarmRepository, _ SettingsRepository, _ HistoryRepository) error {
+			_, err := alarms.AddAlarm(Alarm{Hour: 9, Enabled: true, Days: Weekend})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Atomically failed: %v", err)
+		}
+		if alarms, _ := s.GetAlarms(); len(alarms) != 2 {
+			t.Errorf("Expected the added alarm kept, got %+v", alarms)
+		}
+	})
+}
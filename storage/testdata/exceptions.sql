@@ -0,0 +1,39 @@
+-- user.db with weekday and dated alarms and exceptions, before schema versioning.
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE settings (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	);
+INSERT INTO settings VALUES('bedtime','23:00');
+INSERT INTO settings VALUES('notify_bedtime','true');
+INSERT INTO settings VALUES('snooze_enabled','false');
+CREATE TABLE alarms (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hour INTEGER,
+		minute INTEGER,
+		enabled BOOLEAN,
+		days INTEGER NOT NULL DEFAULT 127,
+		date TEXT,
+		delete_after_ring BOOLEAN NOT NULL DEFAULT 0
+	);
+INSERT INTO alarms VALUES(1,6,30,1,62,NULL,0);
+INSERT INTO alarms VALUES(2,10,0,1,0,'2025-06-14',1);
+CREATE TABLE alarm_exceptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alarm_id INTEGER NOT NULL,
+		start_date TEXT NOT NULL,
+		end_date TEXT NOT NULL
+	);
+INSERT INTO alarm_exceptions VALUES(1,1,'2025-06-09','2025-06-13');
+CREATE TABLE sleep_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		start_time TIMESTAMP,
+		end_time TIMESTAMP,
+		snooze_count INTEGER
+	);
+INSERT INTO sleep_history VALUES(1,'2026-10-14 22:50:00+00:00','2026-10-15 06:50:00+00:00',0);
+INSERT INTO sqlite_sequence VALUES('alarms',2);
+INSERT INTO sqlite_sequence VALUES('alarm_exceptions',1);
+INSERT INTO sqlite_sequence VALUES('sleep_history',1);
+COMMIT;
@@ -0,0 +1,53 @@
+-- user.db with alarm overrides and missed alarms, before schema versioning.
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE settings (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	);
+INSERT INTO settings VALUES('bedtime','23:00');
+INSERT INTO settings VALUES('notify_bedtime','true');
+INSERT INTO settings VALUES('missed_alarm_grace','20');
+CREATE TABLE alarms (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hour INTEGER,
+		minute INTEGER,
+		enabled BOOLEAN,
+		label TEXT NOT NULL DEFAULT '',
+		days INTEGER NOT NULL DEFAULT 127,
+		date TEXT,
+		delete_after_ring BOOLEAN NOT NULL DEFAULT 0,
+		audio_path TEXT NOT NULL DEFAULT '',
+		snooze_enabled BOOLEAN,
+		snooze_duration INTEGER,
+		snooze_max INTEGER NOT NULL DEFAULT 0,
+		fade_in_seconds INTEGER,
+		volume INTEGER
+	);
+INSERT INTO alarms VALUES(1,7,15,1,'Gym',42,NULL,0,'/home/user/Music/birds.ogg',1,5,2,60,70);
+INSERT INTO alarms VALUES(2,8,0,0,'',65,NULL,0,'',NULL,NULL,0,NULL,NULL);
+CREATE TABLE alarm_exceptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alarm_id INTEGER NOT NULL,
+		start_date TEXT NOT NULL,
+		end_date TEXT NOT NULL
+	);
+CREATE TABLE sleep_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		start_time TIMESTAMP,
+		end_time TIMESTAMP,
+		snooze_count INTEGER
+	);
+INSERT INTO sleep_history VALUES(1,'2026-10-14 23:30:00+00:00','2026-10-15 07:15:00+00:00',2);
+CREATE TABLE missed_alarms (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alarm_id INTEGER NOT NULL,
+		scheduled_at TIMESTAMP,
+		detected_at TIMESTAMP,
+		rang_late BOOLEAN NOT NULL DEFAULT 0
+	);
+INSERT INTO missed_alarms VALUES(1,1,'2026-10-12 07:15:00+00:00','2026-10-12 07:20:00+00:00',1);
+INSERT INTO sqlite_sequence VALUES('alarms',2);
+INSERT INTO sqlite_sequence VALUES('missed_alarms',1);
+INSERT INTO sqlite_sequence VALUES('sleep_history',1);
+COMMIT;
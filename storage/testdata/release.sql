@@ -0,0 +1,28 @@
+-- user.db as written by the first release, before schema versioning.
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE settings (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	);
+INSERT INTO settings VALUES('bedtime','22:30');
+INSERT INTO settings VALUES('notify_bedtime','true');
+INSERT INTO settings VALUES('snooze_duration','10');
+CREATE TABLE alarms (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hour INTEGER,
+		minute INTEGER,
+		enabled BOOLEAN
+	);
+INSERT INTO alarms VALUES(1,6,45,1);
+INSERT INTO alarms VALUES(2,9,0,0);
+CREATE TABLE sleep_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		start_time TIMESTAMP,
+		end_time TIMESTAMP,
+		snooze_count INTEGER
+	);
+INSERT INTO sleep_history VALUES(1,'2026-10-14 23:10:00+00:00','2026-10-15 06:30:00+00:00',1);
+INSERT INTO sqlite_sequence VALUES('alarms',2);
+INSERT INTO sqlite_sequence VALUES('sleep_history',1);
+COMMIT;
@@ -0,0 +1,109 @@
+package ui
+
+import (
+	"context"
+	"log"
+
+	"circadia/daemon"
+	"circadia/storage"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// ChooseAudioFile opens a file dialog filtered to the formats the daemon can play.
+// onChosen is only called when the user picks a local file.
+func ChooseAudioFile(anchor gtk.Widgetter, onChosen func(path string)) {
+	dialog := gtk.NewFileDialog()
+	dialog.SetTitle("Select alarm audio")
+	dialog.SetAcceptLabel("_Open")
+	dialog.SetModal(true)
+
+	filter := gtk.NewFileFilter()
+	filter.SetName("Audio Files")
+	filter.AddMIMEType("audio/mpeg")
+	filter.AddMIMEType("audio/ogg")
+	filter.AddMIMEType("audio/wav")
+	filter.AddMIMEType("application/ogg")
+	filter.AddPattern("*.mp3")
+	filter.AddPattern("*.ogg")
+	filter.AddPattern("*.wav")
+
+	filters := gio.NewListStore(gtk.GTypeFileFilter)
+	filters.Append(filter.Object)
+	dialog.SetFilters(filters)
+	dialog.SetDefaultFilter(filter)
+
+	dialog.Open(context.TODO(), parentWindow(anchor), func(res gio.AsyncResulter) {
+		file, err := dialog.OpenFinish(res)
+		if err != nil {
+			log.Printf("File dialog cancelled or error: %v", err)
+			return
+		}
+
+		path := file.Path()
+		if path == "" {
+			return
+		}
+		onChosen(path)
+	})
+}
+
+// parentWindow returns the window anchor is shown in, for dialogs to be modal to.
+func parentWindow(anchor gtk.Widgetter) *gtk.Window {
+	if root := gtk.BaseWidget(anchor).Root(); root != nil {
+		if w, ok := root.Cast().(*gtk.Window); ok {
+			return w
+		}
+	}
+	return nil
+}
+
+// NewAudioPreviewButton toggles playback of the file returned by path. An empty
+// path previews whatever the daemon would fall back to.
+func NewAudioPreviewButton(store *storage.Store, path func() string) *gtk.Button {
+	btnPreview := gtk.NewButton()
+	iconPlay := gtk.NewImageFromIconName("media-playback-start-symbolic")
+	iconPlay.SetPixelSize(24)
+	btnPreview.SetChild(iconPlay)
+	btnPreview.AddCSSClass("flat")
+	btnPreview.SetSizeRequest(40, 40)
+
+	isPreviewing := false
+	btnPreview.ConnectClicked(func() {
+		btnPreview.SetSensitive(false)
+
+		if isPreviewing {
+			go func() {
+				daemon.StopAlarmSound()
+				glib.IdleAdd(func() bool {
+					iconPlay.SetFromIconName("media-playback-start-symbolic")
+					isPreviewing = false
+					btnPreview.SetSensitive(true)
+					return false
+				})
+			}()
+		} else {
+			p := path()
+
+			go func() {
+				err := daemon.PreviewAudio(store, p)
+				glib.IdleAdd(func() bool {
+					if err != nil {
+						log.Printf("Preview error: %v", err)
+						iconPlay.SetFromIconName("media-playback-start-symbolic")
+						isPreviewing = false
+					} else {
+						iconPlay.SetFromIconName("media-playback-stop-symbolic")
+						isPreviewing = true
+					}
+					btnPreview.SetSensitive(true)
+					return false
+				})
+			}()
+		}
+	})
+
+	return btnPreview
+}
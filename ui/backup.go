@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+func newBackupFileDialog(title, acceptLabel string) *gtk.FileDialog {
+	dialog := gtk.NewFileDialog()
+	dialog.SetTitle(title)
+	dialog.SetAcceptLabel(acceptLabel)
+	dialog.SetModal(true)
+
+	filter := gtk.NewFileFilter()
+	filter.SetName("Circadia Backups")
+	filter.AddMIMEType("application/json")
+	filter.AddPattern("*.json")
+
+	filters := gio.NewListStore(gtk.GTypeFileFilter)
+	filters.Append(filter.Object)
+	dialog.SetFilters(filters)
+	dialog.SetDefaultFilter(filter)
+	return dialog
+}
+
+// ChooseBackupFile opens a file dialog for picking a backup to import.
+// onChosen is only called when the user picks a local file.
+func ChooseBackupFile(anchor gtk.Widgetter, onChosen func(path string)) {
+	dialog := newBackupFileDialog("Import backup", "_Import")
+	dialog.Open(context.TODO(), parentWindow(anchor), func(res gio.AsyncResulter) {
+		file, err := dialog.OpenFinish(res)
+		if err != nil {
+			log.Printf("File dialog cancelled or error: %v", err)
+			return
+		}
+		if path := file.Path(); path != "" {
+			onChosen(path)
+		}
+	})
+}
+
+// ChooseBackupDestination opens a save dialog that suggests a file name with today's date.
+// onChosen is only called when the user picks a local file.
+func ChooseBackupDestination(anchor gtk.Widgetter, onChosen func(path string)) {
+	dialog := newBackupFileDialog("Export backup", "_Save")
+	dialog.SetInitialName("circadia-backup-" + time.Now().Format("2006-01-02") + ".json")
+	dialog.Save(context.TODO(), parentWindow(anchor), func(res gio.AsyncResulter) {
+		file, err := dialog.SaveFinish(res)
+		if err != nil {
+			log.Printf("File dialog cancelled or error: %v", err)
+			return
+		}
+		if path := file.Path(); path != "" {
+			onChosen(path)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package ui
+
+import (
+	"circadia/daemon"
+	"circadia/storage"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+const displayDateLayout = "Mon 2 Jan 2006"
+
+func NewDatePickerWidget(titleText string, initial time.Time, onSave func(time.Time), onCancel func()) *gtk.Box {
+	vbox := gtk.NewBox(gtk.OrientationVertical, 20)
+	vbox.AddCSSClass("modal-content")
+	vbox.SetHAlign(gtk.AlignCenter)
+	vbox.SetVAlign(gtk.AlignCenter)
+
+	title := gtk.NewLabel(titleText)
+	title.AddCSSClass("h2")
+	vbox.Append(title)
+
+	if initial.IsZero() {
+		initial = time.Now()
+	}
+
+	calendar := gtk.NewCalendar()
+	calendar.SelectDay(glib.NewDateTimeLocal(initial.Year(), int(initial.Month()), initial.Day(), 0, 0, 0))
+	vbox.Append(calendar)
+
+	actionBox := gtk.NewBox(gtk.OrientationHorizontal, 20)
+	actionBox.AddCSSClass("modal-actions")
+	actionBox.SetHAlign(gtk.AlignCenter)
+
+	cancel := gtk.NewButtonWithLabel("Cancel")
+	cancel.AddCSSClass("modal-btn")
+	cancel.ConnectClicked(func() {
+		if onCancel != nil {
+			onCancel()
+		}
+	})
+
+	save := gtk.NewButtonWithLabel("Save")
+	save.AddCSSClass("modal-btn")
+	save.AddCSSClass("suggested-action")
+	save.ConnectClicked(func() {
+		if onSave != nil {
+			d := calendar.Date()
+			onSave(time.Date(d.Year(), time.Month(d.Month()), d.DayOfMonth(), 0, 0, 0, 0, time.Local))
+		}
+	})
+
+	actionBox.Append(cancel)
+	actionBox.Append(save)
+	vbox.Append(actionBox)
+
+	return vbox
+}
+
+// showDatePicker opens a date picker modal and closes it again once a date is chosen.
+func showDatePicker(showModal func(*gtk.Widget) func(), title string, initial time.Time, onPicked func(time.Time)) {
+	if showModal == nil {
+		return
+	}
+
+	var closeOverlay func()
+	widget := NewDatePickerWidget(title, initial, func(d time.Time) {
+		if closeOverlay != nil {
+			closeOverlay()
+		}
+		onPicked(d)
+	}, func() {
+		if closeOverlay != nil {
+			closeOverlay()
+		}
+	})
+	closeOverlay = showModal(&widget.Widget)
+}
+
+func describeException(e storage.AlarmException) string {
+	if e.Start.Equal(e.End) {
+		return "Skipping " + e.Start.Format("Mon 2 Jan")
+	}
+	return fmt.Sprintf("Paused %s – %s", e.Start.Format("2 Jan"), e.End.Format("2 Jan"))
+}
+
+// newExceptionsSection lets the user skip the next occurrence of a repeating alarm
+// or pause it for a vacation. Changes are stored immediately.
+func newExceptionsSection(store *storage.Store, alarm storage.Alarm, showModal func(*gtk.Widget) func()) *gtk.Box {
+	section := gtk.NewBox(gtk.OrientationVertical, 10)
+
+	buttons := gtk.NewBox(gtk.OrientationHorizontal, 10)
+	buttons.SetHAlign(gtk.AlignCenter)
+	section.Append(buttons)
+
+	list := gtk.NewBox(gtk.OrientationVertical, 5)
+	section.Append(list)
+
+	var reload func()
+	reload = func() {
+		exceptions, err := store.GetAlarmExceptions(alarm.ID)
+		if err != nil {
+			log.Printf("Error loading alarm exceptions: %v", err)
+		}
+		alarm.Exceptions = exceptions
+
+		for {
+			child := list.FirstChild()
+			if child == nil {
+				break
+			}
+			list.Remove(child)
+		}
+
+		for _, e := range exceptions {
+			exception := e
+			row := gtk.NewBox(gtk.OrientationHorizontal, 10)
+
+			label := gtk.NewLabel(describeException(exception))
+			label.AddCSSClass("caption")
+			label.SetHAlign(gtk.AlignStart)
+			label.SetHExpand(true)
+			row.Append(label)
+
+			remove := gtk.NewButtonFromIconName("edit-delete-symbolic")
+			remove.AddCSSClass("flat")
+			remove.ConnectClicked(func() {
+				if err := store.DeleteAlarmException(exception.ID); err != nil {
+					log.Printf("Error deleting alarm exception: %v", err)
+				}
+				reload()
+			})
+			row.Append(remove)
+
+			list.Append(row)
+		}
+	}
+
+	skipBtn := gtk.NewButtonWithLabel("Skip Next")
+	skipBtn.AddCSSClass("pill-button")
+	skipBtn.ConnectClicked(func() {
+		if err := daemon.SkipNextOccurrence(store, alarm); err != nil {
+			log.Printf("Error skipping alarm: %v", err)
+		}
+		reload()
+	})
+	buttons.Append(skipBtn)
+
+	vacationBtn := gtk.NewButtonWithLabel("Vacation")
+	vacationBtn.AddCSSClass("pill-button")
+	vacationBtn.ConnectClicked(func() {
+		showDatePicker(showModal, "Vacation Starts", time.Now(), func(start time.Time) {
+			showDatePicker(showModal, "Vacation Ends", start, func(end time.Time) {
+				if err := store.AddAlarmException(alarm.ID, start, end); err != nil {
+					log.Printf("Error adding vacation: %v", err)
+				}
+				reload()
+			})
+		})
+	})
+	buttons.Append(vacationBtn)
+
+	reload()
+
+	return section
+}
@@ -1,14 +1,20 @@
 package ui
 
 import (
+	"circadia/daemon"
 	"circadia/internal/ipc"
 	"circadia/storage"
 	"fmt"
 	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
 )
 
 func CreateCardBox() *gtk.Box {
@@ -249,7 +255,7 @@ func connectRepeatingButton(btn *gtk.Button, action func()) {
 	})
 }
 
-func NewAlarmEditor(alarm storage.Alarm, onSave func(a storage.Alarm), onCancel func()) *gtk.Box {
+func NewAlarmEditor(store *storage.Store, alarm storage.Alarm, onSave func(a storage.Alarm), onCancel func(), showModal func(*gtk.Widget) func()) *gtk.Box {
 	vbox := gtk.NewBox(gtk.OrientationVertical, 20)
 	vbox.AddCSSClass("modal-content")
 	vbox.SetHAlign(gtk.AlignCenter)
@@ -306,6 +312,188 @@ func NewAlarmEditor(alarm storage.Alarm, onSave func(a storage.Alarm), onCancel
 	pickerRow.Append(mBox)
 	vbox.Append(pickerRow)
 
+	labelEntry := gtk.NewEntry()
+	labelEntry.SetPlaceholderText("Label")
+	labelEntry.SetText(alarm.Label)
+	labelEntry.SetMaxLength(40)
+	vbox.Append(labelEntry)
+
+	days := alarm.Days
+	date := alarm.Date
+	deleteAfterRing := alarm.DeleteAfterRing
+
+	daysSummary := gtk.NewLabel("")
+	daysSummary.AddCSSClass("caption")
+
+	deleteRow := gtk.NewBox(gtk.OrientationHorizontal, 10)
+	deleteRow.SetHAlign(gtk.AlignCenter)
+	deleteLabel := gtk.NewLabel("Delete after ringing")
+	deleteSwitch := gtk.NewSwitch()
+	deleteSwitch.SetActive(deleteAfterRing)
+	deleteSwitch.ConnectStateSet(func(state bool) bool {
+		deleteAfterRing = state
+		return false
+	})
+	deleteRow.Append(deleteLabel)
+	deleteRow.Append(deleteSwitch)
+
+	dateRow := gtk.NewBox(gtk.OrientationHorizontal, 10)
+	dateRow.SetHAlign(gtk.AlignCenter)
+	dateLabel := gtk.NewLabel("On date")
+	dateBtn := gtk.NewButton()
+	clearDateBtn := gtk.NewButtonFromIconName("edit-clear-symbolic")
+	clearDateBtn.AddCSSClass("flat")
+	dateRow.Append(dateLabel)
+	dateRow.Append(dateBtn)
+	dateRow.Append(clearDateBtn)
+
+	var dayChips *gtk.Box
+	updateSchedule := func() {
+		dated := !date.IsZero()
+		dayChips.SetVisible(!dated)
+		clearDateBtn.SetVisible(dated)
+		deleteRow.SetVisible(dated || days == 0)
+		if dated {
+			dateBtn.SetLabel(date.Format(displayDateLayout))
+			daysSummary.SetText("Once")
+		} else {
+			dateBtn.SetLabel("Pick date")
+			daysSummary.SetText(days.String())
+		}
+	}
+
+	dayChips = newDayChips(days, func(d storage.Weekdays) {
+		days = d
+		updateSchedule()
+	})
+
+	dateBtn.ConnectClicked(func() {
+		showDatePicker(showModal, "Alarm Date", date, func(d time.Time) {
+			date = d
+			updateSchedule()
+		})
+	})
+	clearDateBtn.ConnectClicked(func() {
+		date = time.Time{}
+		updateSchedule()
+	})
+
+	updateSchedule()
+
+	vbox.Append(dayChips)
+	vbox.Append(daysSummary)
+	vbox.Append(dateRow)
+	vbox.Append(deleteRow)
+
+	if alarm.ID != 0 && !alarm.IsOneShot() {
+		vbox.Append(newExceptionsSection(store, alarm, showModal))
+	}
+
+	audioPath := alarm.AudioPath
+	soundRow := gtk.NewBox(gtk.OrientationHorizontal, 10)
+	soundRow.SetHAlign(gtk.AlignCenter)
+
+	soundRow.Append(NewAudioPreviewButton(store, func() string {
+		return audioPath
+	}))
+
+	soundLabel := gtk.NewLabel("")
+	soundLabel.SetEllipsize(pango.EllipsizeMiddle)
+	soundLabel.SetMaxWidthChars(18)
+	soundRow.Append(soundLabel)
+
+	soundChoose := gtk.NewButtonFromIconName("document-open-symbolic")
+	soundChoose.SetTooltipText("Choose Sound")
+	soundChoose.AddCSSClass("flat")
+	soundRow.Append(soundChoose)
+
+	soundReset := gtk.NewButtonFromIconName("edit-undo-symbolic")
+	soundReset.SetTooltipText("Use Default Sound")
+	soundReset.AddCSSClass("flat")
+	soundRow.Append(soundReset)
+
+	updateSound := func() {
+		if audioPath == "" {
+			soundLabel.SetText("Default sound")
+		} else {
+			soundLabel.SetText(filepath.Base(audioPath))
+		}
+		soundReset.SetSensitive(audioPath != "")
+	}
+	soundChoose.ConnectClicked(func() {
+		ChooseAudioFile(soundChoose, func(path string) {
+			audioPath = path
+			updateSound()
+		})
+	})
+	soundReset.ConnectClicked(func() {
+		audioPath = ""
+		updateSound()
+	})
+	updateSound()
+	vbox.Append(soundRow)
+
+	snoozeModes := []string{"Default", "On", "Off"}
+	snoozeMode := uint(0)
+	if alarm.SnoozeEnabled != nil {
+		snoozeMode = 2
+		if *alarm.SnoozeEnabled {
+			snoozeMode = 1
+		}
+	}
+	snoozeRow, snoozeDrop := NewChoiceRow("Snooze", snoozeModes, snoozeMode)
+	vbox.Append(snoozeRow)
+
+	durations := []int{0, 5, 10, 15, 20, 30}
+	if alarm.SnoozeDuration != nil && !slices.Contains(durations, *alarm.SnoozeDuration) {
+		durations = append(durations, *alarm.SnoozeDuration)
+		slices.Sort(durations)
+	}
+	durationNames := make([]string, len(durations))
+	durationIdx := uint(0)
+	for i, d := range durations {
+		durationNames[i] = fmt.Sprintf("%d min", d)
+		if d == 0 {
+			durationNames[i] = "Default"
+		}
+		if alarm.SnoozeDuration != nil && *alarm.SnoozeDuration == d {
+			durationIdx = uint(i)
+		}
+	}
+	durationRow, durationDrop := NewChoiceRow("Snooze length", durationNames, durationIdx)
+	vbox.Append(durationRow)
+
+	maxCounts := []int{0, 1, 2, 3, 5}
+	if !slices.Contains(maxCounts, alarm.SnoozeMax) {
+		maxCounts = append(maxCounts, alarm.SnoozeMax)
+		slices.Sort(maxCounts)
+	}
+	maxNames := make([]string, len(maxCounts))
+	maxIdx := uint(0)
+	for i, n := range maxCounts {
+		maxNames[i] = fmt.Sprintf("%d", n)
+		if n == 0 {
+			maxNames[i] = "Unlimited"
+		}
+		if n == alarm.SnoozeMax {
+			maxIdx = uint(i)
+		}
+	}
+	maxRow, maxDrop := NewChoiceRow("Max snoozes", maxNames, maxIdx)
+	vbox.Append(maxRow)
+
+	volumes := []int{0, 25, 50, 75, 100}
+	volumeRow, volumeDrop := newOverrideRow("Volume", volumes, alarm.Volume, "%d%%")
+	vbox.Append(volumeRow)
+
+	fades := []int{-1, 0, 15, 30, 60, 120}
+	fadeRow, fadeDrop := newOverrideRow("Fade in", fades, alarm.FadeInSeconds, "%d s")
+	vbox.Append(fadeRow)
+
+	windows := append([]int{-1, 0}, smartWakeWindows()...)
+	windowRow, windowDrop := newOverrideRow("Smart wake", windows, alarm.SmartWakeWindow, "%d min")
+	vbox.Append(windowRow)
+
 	toggleRow := gtk.NewBox(gtk.OrientationHorizontal, 10)
 	toggleRow.SetHAlign(gtk.AlignCenter)
 	toggleLabel := gtk.NewLabel("Enabled")
@@ -340,6 +528,33 @@ func NewAlarmEditor(alarm storage.Alarm, onSave func(a storage.Alarm), onCancel
 			alarm.Hour = h
 			alarm.Minute = m
 			alarm.Enabled = enabled
+			alarm.Label = strings.TrimSpace(labelEntry.Text())
+			alarm.AudioPath = audioPath
+
+			switch snoozeDrop.Selected() {
+			case 1:
+				on := true
+				alarm.SnoozeEnabled = &on
+			case 2:
+				off := false
+				alarm.SnoozeEnabled = &off
+			default:
+				alarm.SnoozeEnabled = nil
+			}
+			alarm.SnoozeDuration = nil
+			if d := durations[durationDrop.Selected()]; d > 0 {
+				alarm.SnoozeDuration = &d
+			}
+			alarm.SnoozeMax = maxCounts[maxDrop.Selected()]
+			alarm.Volume = overrideValue(volumes, volumeDrop)
+			alarm.FadeInSeconds = overrideValue(fades, fadeDrop)
+			alarm.SmartWakeWindow = overrideValue(windows, windowDrop)
+			alarm.Days = days
+			alarm.Date = date
+			if !date.IsZero() {
+				alarm.Days = 0
+			}
+			alarm.DeleteAfterRing = deleteAfterRing && alarm.IsOneShot()
 			onSave(alarm)
 		}
 	})
@@ -349,6 +564,76 @@ func NewAlarmEditor(alarm storage.Alarm, onSave func(a storage.Alarm), onCancel
 	return vbox
 }
 
+func NewChoiceRow(labelText string, options []string, selected uint) (*gtk.Box, *gtk.DropDown) {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 10)
+
+	label := gtk.NewLabel(labelText)
+	label.SetHExpand(true)
+	label.SetHAlign(gtk.AlignStart)
+	row.Append(label)
+
+	drop := gtk.NewDropDownFromStrings(options)
+	drop.SetSelected(selected)
+	row.Append(drop)
+
+	return row, drop
+}
+
+// newOverrideRow offers "Default" plus the given values for a per-alarm override.
+// The first entry of values is a placeholder for "Default" and is never stored;
+// a zero value elsewhere in the list is shown as "Off".
+func newOverrideRow(labelText string, values []int, current *int, format string) (*gtk.Box, *gtk.DropDown) {
+	names := make([]string, len(values))
+	selected := uint(0)
+	for i, v := range values {
+		switch {
+		case i == 0:
+			names[i] = "Default"
+		case v == 0:
+			names[i] = "Off"
+		default:
+			names[i] = fmt.Sprintf(format, v)
+		}
+		if i > 0 && current != nil && *current == v {
+			selected = uint(i)
+		}
+	}
+	return NewChoiceRow(labelText, names, selected)
+}
+
+func overrideValue(values []int, drop *gtk.DropDown) *int {
+	i := drop.Selected()
+	if i == 0 || int(i) >= len(values) {
+		return nil
+	}
+	v := values[i]
+	return &v
+}
+
+// newDayChips renders one toggle per weekday. Leaving every day off makes the alarm ring only once.
+func newDayChips(initial storage.Weekdays, onChange func(storage.Weekdays)) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	row.SetHAlign(gtk.AlignCenter)
+
+	days := initial
+	for _, day := range storage.WeekOrder {
+		day := day
+		chip := gtk.NewToggleButtonWithLabel(day.String()[:1])
+		chip.AddCSSClass("day-chip")
+		chip.SetTooltipText(day.String())
+		chip.SetActive(days.Has(day))
+		chip.ConnectToggled(func() {
+			days = days.With(day, chip.Active())
+			if onChange != nil {
+				onChange(days)
+			}
+		})
+		row.Append(chip)
+	}
+
+	return row
+}
+
 func createAlarmRow(alarm storage.Alarm, onEdit func(), onToggle func(bool), onDelete func()) *gtk.Box {
 	row := gtk.NewBox(gtk.OrientationHorizontal, 10)
 	row.AddCSSClass("alarm-row")
@@ -371,11 +656,27 @@ func createAlarmRow(alarm storage.Alarm, onEdit func(), onToggle func(bool), onD
 	timeBtnRaw.AddCSSClass("flat")
 	timeBtnRaw.SetHExpand(true)
 
+	timeBox := gtk.NewBox(gtk.OrientationVertical, 2)
+
 	timeLabel := gtk.NewLabel(timeStr)
 	timeLabel.AddCSSClass("h2")
 	timeLabel.SetHAlign(gtk.AlignStart)
+	timeBox.Append(timeLabel)
+
+	if alarm.Label != "" {
+		nameLabel := gtk.NewLabel(alarm.Label)
+		nameLabel.AddCSSClass("caption")
+		nameLabel.SetHAlign(gtk.AlignStart)
+		nameLabel.SetEllipsize(pango.EllipsizeEnd)
+		timeBox.Append(nameLabel)
+	}
+
+	daysLabel := gtk.NewLabel(describeSchedule(alarm, time.Now()))
+	daysLabel.AddCSSClass("caption")
+	daysLabel.SetHAlign(gtk.AlignStart)
+	timeBox.Append(daysLabel)
 
-	timeBtnRaw.SetChild(timeLabel)
+	timeBtnRaw.SetChild(timeBox)
 	timeBtnRaw.ConnectClicked(func() {
 		if onEdit != nil {
 			onEdit()
@@ -396,6 +697,33 @@ func createAlarmRow(alarm storage.Alarm, onEdit func(), onToggle func(bool), onD
 	return row
 }
 
+// describeSchedule summarises the repeat days and, for enabled alarms, when the alarm fires next.
+func describeSchedule(alarm storage.Alarm, now time.Time) string {
+	if alarm.IsDated() {
+		return alarm.Date.Format(displayDateLayout)
+	}
+
+	summary := alarm.Days.String()
+	if !alarm.Enabled {
+		return summary
+	}
+
+	next, ok := daemon.NextOccurrence(alarm, now)
+	if !ok {
+		return summary
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch day := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, next.Location()); {
+	case day.Equal(today):
+		return summary + " · Today"
+	case day.Equal(today.AddDate(0, 0, 1)):
+		return summary + " · Tomorrow"
+	default:
+		return summary + " · " + next.Format("Mon 2 Jan")
+	}
+}
+
 func NewWakeUpCard(alarms []storage.Alarm, onEdit func(alarm storage.Alarm), onToggle func(alarm storage.Alarm, enabled bool), onDelete func(alarm storage.Alarm)) *gtk.Box {
 	card := CreateCardBox()
 
@@ -435,7 +763,7 @@ func NewWakeUpCard(alarms []storage.Alarm, onEdit func(alarm storage.Alarm), onT
 	return card
 }
 
-func NewSmartWakeUpCard() *gtk.Box {
+func NewSmartWakeUpCard(store *storage.Store) *gtk.Box {
 	card := CreateCardBox()
 
 	header := gtk.NewBox(gtk.OrientationHorizontal, 0)
@@ -445,7 +773,7 @@ func NewSmartWakeUpCard() *gtk.Box {
 	title.SetHExpand(true)
 	title.SetHAlign(gtk.AlignStart)
 
-	enabled, err := storage.GetSmartWakeUp()
+	enabled, err := store.GetSmartWakeUp()
 	if err != nil {
 		log.Println("Error loading smart wake up setting:", err)
 	}
@@ -455,11 +783,11 @@ func NewSmartWakeUpCard() *gtk.Box {
 	toggle.SetVAlign(gtk.AlignCenter)
 
 	toggle.ConnectStateSet(func(state bool) bool {
-		if err := storage.SetSmartWakeUp(state); err != nil {
+		if err := store.SetSmartWakeUp(state); err != nil {
 			log.Println("Error saving smart wake up:", err)
 		}
 		go func() {
-			if err := ipc.SendSignal(fmt.Sprintf("smartWakeUpToggled:%v", state)); err != nil {
+			if err := ipc.Call(ipc.CmdSmartWakeUpToggled, ipc.EnabledArgs{Enabled: state}, nil); err != nil {
 				log.Println("IPC Error:", err)
 			}
 		}()
@@ -470,12 +798,46 @@ func NewSmartWakeUpCard() *gtk.Box {
 	header.Append(toggle)
 	card.Append(header)
 
-	desc := gtk.NewLabel("Press on the moon icon when you're ready to sleep. We'll wake you within 30 minutes of your set time.")
+	window, _ := store.GetSmartWakeWindow()
+	windows := smartWakeWindows()
+	windowNames := make([]string, len(windows))
+	windowIdx := uint(0)
+	for i, w := range windows {
+		windowNames[i] = fmt.Sprintf("%d min", w)
+		if w == window {
+			windowIdx = uint(i)
+		}
+	}
+	windowRow, windowDrop := NewChoiceRow("Window", windowNames, windowIdx)
+	card.Append(windowRow)
+
+	desc := gtk.NewLabel(smartWakeDescription(window))
 	desc.AddCSSClass("caption")
 	desc.SetHAlign(gtk.AlignStart)
 	desc.SetWrap(true)
 	desc.SetMaxWidthChars(40)
 	card.Append(desc)
 
+	windowDrop.NotifyProperty("selected", func() {
+		w := windows[windowDrop.Selected()]
+		if err := store.SetSmartWakeWindow(w); err != nil {
+			log.Println("Error saving smart wake window:", err)
+		}
+		desc.SetText(smartWakeDescription(w))
+	})
+
 	return card
 }
+
+// smartWakeWindows lists the window lengths offered, in minutes.
+func smartWakeWindows() []int {
+	var windows []int
+	for w := storage.MinSmartWakeWindow; w <= storage.MaxSmartWakeWindow; w += 5 {
+		windows = append(windows, w)
+	}
+	return windows
+}
+
+func smartWakeDescription(window int) string {
+	return fmt.Sprintf("Press on the moon icon when you're ready to sleep. Within %d minutes of your set time, we'll wake you once your movements show light sleep, or at the set time otherwise.", window)
+}
@@ -0,0 +1,30 @@
+package ui
+
+import (
+	"circadia/internal/notify"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+)
+
+// AppNotifier sends notifications through the GApplication, which uses the
+// notification portal inside the Flatpak sandbox.
+type AppNotifier struct {
+	App *gio.Application
+}
+
+func (a AppNotifier) Send(id string, n notify.Notification) error {
+	notification := gio.NewNotification(n.Title)
+	if n.Body != "" {
+		notification.SetBody(n.Body)
+	}
+	if n.Urgent {
+		notification.SetPriority(gio.NotificationPriorityUrgent)
+	}
+	a.App.SendNotification(id, notification)
+	return nil
+}
+
+func (a AppNotifier) Withdraw(id string) error {
+	a.App.WithdrawNotification(id)
+	return nil
+}
@@ -9,19 +9,18 @@ import (
 )
 
 func TestSleepHistoryRefresh_ReplacesContent(t *testing.T) {
-	// Initialize in-memory DB
-	storage.InitDB(":memory:")
+	store := storage.NewMemoryStore()
 
 	// Create a dummy session so we have data
 	start := time.Now().Add(-8 * time.Hour)
 	end := time.Now()
-	storage.AddSleepSession(start, end, 0)
+	store.AddSleepSession(start, end, 0)
 
 	// Initialize GTK (required for widget creation)
 	gtk.Init()
 
 	// Create Controller
-	controller := NewSleepHistoryPage()
+	controller := NewSleepHistoryPage(store)
 
 	// Check initial child count
 	initialCount := countChildren(controller.Box)
@@ -7,10 +7,20 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 
 	"circadia/daemon"
-	"circadia/storage"
 )
 
-func NewRingingPage(onAction func(string)) *gtk.Box {
+type RingingPageController struct {
+	Box *gtk.Box
+
+	title   *gtk.Label
+	message *gtk.Label
+	snooze  *gtk.Button
+	daemon  *daemon.Daemon
+}
+
+// NewRingingPage builds the page shown while an alarm rings. The buttons only talk
+// to the daemon; the window reacts through daemon.OnAlarmStopped and daemon.OnAlarmSnoozed.
+func NewRingingPage(d *daemon.Daemon) *RingingPageController {
 	vbox := gtk.NewBox(gtk.OrientationVertical, 20)
 	vbox.SetHAlign(gtk.AlignCenter)
 	vbox.SetVAlign(gtk.AlignCenter)
@@ -24,38 +34,60 @@ func NewRingingPage(onAction func(string)) *gtk.Box {
 
 	label := gtk.NewLabel("Alarm")
 	label.AddCSSClass("h1")
+	label.SetWrap(true)
+	label.SetJustify(gtk.JustifyCenter)
 	vbox.Append(label)
 
 	msg := gtk.NewLabel("Wake Up!")
 	msg.AddCSSClass("h2")
 	vbox.Append(msg)
 
-	snoozeEnabled, _ := storage.GetSnoozeEnabled()
-	if snoozeEnabled {
-		dur, _ := storage.GetSnoozeDuration()
-		snoozeBtn := gtk.NewButtonWithLabel(fmt.Sprintf("Snooze (%d min)", dur))
-		snoozeBtn.AddCSSClass("pill-button")
-		snoozeBtn.ConnectClicked(func() {
-			log.Println("Snooze clicked")
-			daemon.SnoozeAlarm()
-			if onAction != nil {
-				onAction("snooze")
-			}
-		})
-		vbox.Append(snoozeBtn)
-	}
+	snoozeBtn := gtk.NewButtonWithLabel("Snooze")
+	snoozeBtn.AddCSSClass("pill-button")
+	vbox.Append(snoozeBtn)
 
 	stopBtn := gtk.NewButtonWithLabel("Stop")
 	stopBtn.AddCSSClass("pill-button")
 	stopBtn.AddCSSClass("destructive-action")
 	stopBtn.ConnectClicked(func() {
 		log.Println("Stop clicked")
-		daemon.StopAlarm()
-		if onAction != nil {
-			onAction("stop")
-		}
+		d.StopAlarm()
 	})
 	vbox.Append(stopBtn)
 
-	return vbox
+	c := &RingingPageController{Box: vbox, title: label, message: msg, snooze: snoozeBtn, daemon: d}
+
+	snoozeBtn.ConnectClicked(func() {
+		log.Println("Snooze clicked")
+		if err := d.SnoozeAlarm(); err != nil {
+			log.Printf("Snooze failed: %v", err)
+			c.updateSnooze()
+		}
+	})
+	c.updateSnooze()
+
+	return c
+}
+
+// updateSnooze hides the snooze button once the ringing alarm may not be snoozed any more.
+func (c *RingingPageController) updateSnooze() {
+	policy, err := c.daemon.CanSnooze()
+	c.snooze.SetVisible(err == nil)
+	if err != nil {
+		return
+	}
+	c.snooze.SetLabel(fmt.Sprintf("Snooze (%d min)", int(policy.Duration.Minutes())))
+}
+
+// Show updates the page for the alarm that is ringing. Unlabelled alarms keep the generic text.
+func (c *RingingPageController) Show(h, m int, label string) {
+	c.updateSnooze()
+
+	if label == "" {
+		c.title.SetText("Alarm")
+		c.message.SetText("Wake Up!")
+		return
+	}
+	c.title.SetText(label)
+	c.message.SetText(fmt.Sprintf("%02d:%02d", h, m))
 }
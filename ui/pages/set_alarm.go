@@ -9,20 +9,26 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
 
-func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
+type SetAlarmController struct {
+	Box *gtk.Box
+
+	refreshAlarms func()
+}
+
+func NewSetAlarmPage(store *storage.Store, showModal func(*gtk.Widget) func()) *SetAlarmController {
 	contentBox := gtk.NewBox(gtk.OrientationVertical, 10)
 	contentBox.SetMarginTop(20)
 	contentBox.SetMarginBottom(20)
 	contentBox.SetMarginStart(20)
 	contentBox.SetMarginEnd(20)
 
-	initialBedtime, err := storage.GetBedtime()
+	initialBedtime, err := store.GetBedtime()
 	if err != nil {
 		initialBedtime = "23:00"
 		log.Printf("Failed to get bedtime: %v", err)
 	}
 
-	initialNotify, err := storage.GetNotifyBedtime()
+	initialNotify, err := store.GetNotifyBedtime()
 	if err != nil {
 		initialNotify = true
 		log.Printf("Failed to get notify: %v", err)
@@ -32,21 +38,21 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 		initialBedtime,
 		initialNotify,
 		func(timeStr string) {
-			if err := storage.SetBedtime(timeStr); err != nil {
+			if err := store.SetBedtime(timeStr); err != nil {
 				log.Printf("Error saving bedtime: %v", err)
 			}
 			go func() {
-				if err := ipc.SendSignal("bedtimeChanged"); err != nil {
+				if err := ipc.Call(ipc.CmdBedtimeChanged, nil, nil); err != nil {
 					log.Printf("IPC Error: %v", err)
 				}
 			}()
 		},
 		func(enabled bool) {
-			if err := storage.SetNotifyBedtime(enabled); err != nil {
+			if err := store.SetNotifyBedtime(enabled); err != nil {
 				log.Printf("Error saving notification toggle: %v", err)
 			}
 			go func() {
-				if err := ipc.SendSignal("bedtimeNotificationsChanged"); err != nil {
+				if err := ipc.Call(ipc.CmdBedtimeNotificationsChanged, nil, nil); err != nil {
 					log.Printf("IPC Error: %v", err)
 				}
 			}()
@@ -68,7 +74,7 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 			alarmContainer.Remove(child)
 		}
 
-		alarms, err := storage.GetAlarms()
+		alarms, err := store.GetAlarms()
 		if err != nil {
 			log.Printf("Error loading alarms: %v", err)
 			alarms = []storage.Alarm{}
@@ -77,8 +83,8 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 		card := ui.NewWakeUpCard(alarms, func(a storage.Alarm) {
 			var closeOverlay func()
 
-			editor := ui.NewAlarmEditor(a, func(updated storage.Alarm) {
-				if err := storage.UpdateAlarm(updated.ID, updated.Hour, updated.Minute, updated.Enabled); err != nil {
+			editor := ui.NewAlarmEditor(store, a, func(updated storage.Alarm) {
+				if err := store.UpdateAlarm(updated); err != nil {
 					log.Printf("Error updating alarm: %v", err)
 				}
 				if closeOverlay != nil {
@@ -89,13 +95,15 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 				if closeOverlay != nil {
 					closeOverlay()
 				}
-			})
+				// Skips and vacations are saved straight away, even on cancel.
+				refreshAlarms()
+			}, showModal)
 
 			if showModal != nil {
 				closeOverlay = showModal(&editor.Widget)
 			}
 		}, func(a storage.Alarm, enabled bool) {
-			if err := storage.ToggleAlarm(a.ID, enabled); err != nil {
+			if err := store.ToggleAlarm(a.ID, enabled); err != nil {
 				log.Printf("Error toggling alarm: %v", err)
 			}
 			refreshAlarms()
@@ -131,7 +139,7 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 			confirmBtn.AddCSSClass("modal-btn")
 			confirmBtn.AddCSSClass("destructive-action")
 			confirmBtn.ConnectClicked(func() {
-				if err := storage.DeleteAlarm(a.ID); err != nil {
+				if err := store.DeleteAlarm(a.ID); err != nil {
 					log.Printf("Error deleting alarm: %v", err)
 				}
 				if closeOverlay != nil {
@@ -151,7 +159,7 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 
 	refreshAlarms()
 
-	smartWakeCard := ui.NewSmartWakeUpCard()
+	smartWakeCard := ui.NewSmartWakeUpCard(store)
 	contentBox.Append(smartWakeCard)
 
 	btn := gtk.NewButtonWithLabel("Set Alarm")
@@ -161,7 +169,7 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 		nowH, nowM := 8, 0
 
 		onSave := func(h, m int) {
-			if err := storage.AddAlarm(h, m); err != nil {
+			if _, err := store.AddAlarm(storage.Alarm{Hour: h, Minute: m, Enabled: true, Days: storage.EveryDay}); err != nil {
 				log.Printf("Error adding alarm: %v", err)
 			}
 			if closeOverlay != nil {
@@ -182,5 +190,10 @@ func NewSetAlarmPage(showModal func(*gtk.Widget) func()) *gtk.Box {
 	})
 	contentBox.Append(btn)
 
-	return contentBox
+	return &SetAlarmController{Box: contentBox, refreshAlarms: refreshAlarms}
+}
+
+// Refresh reloads the alarm list, e.g. after the daemon disabled a one-shot alarm.
+func (c *SetAlarmController) Refresh() {
+	c.refreshAlarms()
 }
@@ -1,27 +1,53 @@
 package pages
 
 import (
-	"context"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"slices"
 
 	"circadia/daemon"
 	"circadia/storage"
 	"circadia/ui"
 
 	"github.com/diamondburned/gotk4/pkg/core/glib"
-	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
 
-func NewSettingsPage(debugMode bool) *gtk.Box {
+type SettingsController struct {
+	Box *gtk.Box
+
+	store     *storage.Store
+	debugMode bool
+	// cards holds everything Refresh rebuilds; the backup card below it stays.
+	cards *gtk.Box
+}
+
+func NewSettingsPage(store *storage.Store, d *daemon.Daemon, debugMode bool, showModal func(*gtk.Widget) func()) *SettingsController {
 	box := gtk.NewBox(gtk.OrientationVertical, 10)
 	box.SetMarginTop(20)
 	box.SetMarginBottom(20)
 	box.SetMarginStart(20)
 	box.SetMarginEnd(20)
 
+	cards := gtk.NewBox(gtk.OrientationVertical, 10)
+	box.Append(cards)
+	box.Append(newBackupCard(store, d, showModal))
+
+	controller := &SettingsController{Box: box, store: store, debugMode: debugMode, cards: cards}
+	controller.Refresh()
+
+	return controller
+}
+
+// Refresh rebuilds the cards from the stored settings, e.g. after a backup was imported.
+func (c *SettingsController) Refresh() {
+	for child := c.cards.FirstChild(); child != nil; child = c.cards.FirstChild() {
+		c.cards.Remove(child)
+	}
+	box, store, debugMode := c.cards, c.store, c.debugMode
+
 	audioCard := ui.CreateCardBox()
 	box.Append(audioCard)
 
@@ -34,16 +60,14 @@ func NewSettingsPage(debugMode bool) *gtk.Box {
 	fileRow := gtk.NewBox(gtk.OrientationHorizontal, 15)
 	fileRow.SetHExpand(true)
 
-	btnPreview := gtk.NewButton()
-	iconPlay := gtk.NewImageFromIconName("media-playback-start-symbolic")
-	iconPlay.SetPixelSize(24)
-	btnPreview.SetChild(iconPlay)
-	btnPreview.AddCSSClass("flat")
-	btnPreview.SetSizeRequest(40, 40)
+	btnPreview := ui.NewAudioPreviewButton(store, func() string {
+		path, _ := store.GetAlarmAudioPath()
+		return path
+	})
 
 	fileRow.Append(btnPreview)
 
-	currentPath, _ := storage.GetAlarmAudioPath()
+	currentPath, _ := store.GetAlarmAudioPath()
 	displayPath := "Default"
 	if currentPath != "" {
 		displayPath = filepath.Base(currentPath)
@@ -71,46 +95,8 @@ func NewSettingsPage(debugMode bool) *gtk.Box {
 	audioCard.Append(btnChoose)
 
 	btnChoose.ConnectClicked(func() {
-		dialog := gtk.NewFileDialog()
-		dialog.SetTitle("Select alarm audio")
-		dialog.SetAcceptLabel("_Open")
-		dialog.SetModal(true)
-
-		filter := gtk.NewFileFilter()
-		filter.SetName("Audio Files")
-		filter.AddMIMEType("audio/mpeg")
-		filter.AddMIMEType("audio/ogg")
-		filter.AddMIMEType("audio/wav")
-		filter.AddMIMEType("application/ogg")
-		filter.AddPattern("*.mp3")
-		filter.AddPattern("*.ogg")
-		filter.AddPattern("*.wav")
-
-		filters := gio.NewListStore(gtk.GTypeFileFilter)
-		filters.Append(filter.Object)
-		dialog.SetFilters(filters)
-		dialog.SetDefaultFilter(filter)
-
-		var parent *gtk.Window
-		if root := btnChoose.Root(); root != nil {
-			if w, ok := root.Cast().(*gtk.Window); ok {
-				parent = w
-			}
-		}
-
-		dialog.Open(context.TODO(), parent, func(res gio.AsyncResulter) {
-			file, err := dialog.OpenFinish(res)
-			if err != nil {
-				log.Printf("File dialog cancelled or error: %v", err)
-				return
-			}
-
-			path := file.Path()
-			if path == "" {
-				return
-			}
-
-			if err := storage.SetAlarmAudioPath(path); err != nil {
+		ui.ChooseAudioFile(btnChoose, func(path string) {
+			if err := store.SetAlarmAudioPath(path); err != nil {
 				log.Printf("Failed to save audio path: %v", err)
 				return
 			}
@@ -121,45 +107,33 @@ func NewSettingsPage(debugMode bool) *gtk.Box {
 	})
 
 	btnReset.ConnectClicked(func() {
-		storage.SetAlarmAudioPath("")
+		store.SetAlarmAudioPath("")
 		fileLabel.SetText("Default")
 		btnReset.SetSensitive(false)
 	})
 
-	isPreviewing := false
-	btnPreview.ConnectClicked(func() {
-		btnPreview.SetSensitive(false)
-
-		if isPreviewing {
-			go func() {
-				daemon.StopAlarmSound()
-				glib.IdleAdd(func() bool {
-					iconPlay.SetFromIconName("media-playback-start-symbolic")
-					isPreviewing = false
-					btnPreview.SetSensitive(true)
-					return false
-				})
-			}()
-		} else {
-			path, _ := storage.GetAlarmAudioPath()
-
-			go func() {
-				err := daemon.PreviewAudio(path)
-				glib.IdleAdd(func() bool {
-					if err != nil {
-						fmt.Printf("Preview error: %v\n", err)
-						iconPlay.SetFromIconName("media-playback-start-symbolic")
-						isPreviewing = false
-					} else {
-						iconPlay.SetFromIconName("media-playback-stop-symbolic")
-						isPreviewing = true
-					}
-					btnPreview.SetSensitive(true)
-					return false
-				})
-			}()
-		}
-	})
+	volumeCard := ui.CreateCardBox()
+	box.Append(volumeCard)
+
+	volumeHeader := gtk.NewLabel("Volume")
+	volumeHeader.AddCSSClass("h2")
+	volumeHeader.SetHAlign(gtk.AlignStart)
+	volumeHeader.SetMarginBottom(10)
+	volumeCard.Append(volumeHeader)
+
+	alarmVolume, _ := store.GetAlarmVolume()
+	volumeCard.Append(newSettingsSlider("Alarm volume", 10, 100, 5, alarmVolume, func(v int) string {
+		return fmt.Sprintf("%d%%", v)
+	}, func(v int) {
+		store.SetAlarmVolume(v)
+	}))
+
+	fadeIn, _ := store.GetFadeInDuration()
+	volumeCard.Append(newSettingsSlider("Fade in", 0, 120, 5, fadeIn, formatFadeIn, func(v int) {
+		store.SetFadeInDuration(v)
+	}))
+
+	box.Append(newOutputCard(store))
 
 	snoozeCard := ui.CreateCardBox()
 	box.Append(snoozeCard)
@@ -177,7 +151,7 @@ func NewSettingsPage(debugMode bool) *gtk.Box {
 	lblEnable.SetHExpand(true)
 	lblEnable.SetHAlign(gtk.AlignStart)
 
-	snoozeEnabled, _ := storage.GetSnoozeEnabled()
+	snoozeEnabled, _ := store.GetSnoozeEnabled()
 	checkEnable := gtk.NewSwitch()
 	checkEnable.SetActive(snoozeEnabled)
 	checkEnable.SetVAlign(gtk.AlignCenter)
@@ -186,7 +160,7 @@ func NewSettingsPage(debugMode bool) *gtk.Box {
 	toggleRow.Append(checkEnable)
 	snoozeCard.Append(toggleRow)
 
-	snoozeDur, _ := storage.GetSnoozeDuration()
+	snoozeDur, _ := store.GetSnoozeDuration()
 	sliderBox := gtk.NewBox(gtk.OrientationHorizontal, 10)
 	sliderBox.SetMarginTop(10)
 
@@ -212,7 +186,7 @@ func NewSettingsPage(debugMode bool) *gtk.Box {
 	snoozeCard.Append(sliderBox)
 
 	checkEnable.ConnectStateSet(func(state bool) bool {
-		storage.SetSnoozeEnabled(state)
+		store.SetSnoozeEnabled(state)
 		scale.SetSensitive(state)
 		return false
 	})
@@ -220,8 +194,327 @@ func NewSettingsPage(debugMode bool) *gtk.Box {
 	scale.ConnectValueChanged(func() {
 		val := int(scale.Value())
 		lblDur.SetText(fmt.Sprintf("%d min", val))
-		storage.SetSnoozeDuration(val)
+		store.SetSnoozeDuration(val)
+	})
+
+	missedCard := ui.CreateCardBox()
+	box.Append(missedCard)
+
+	missedHeader := gtk.NewLabel("Suspend")
+	missedHeader.AddCSSClass("h2")
+	missedHeader.SetHAlign(gtk.AlignStart)
+	missedHeader.SetMarginBottom(10)
+	missedCard.Append(missedHeader)
+
+	missedHint := gtk.NewLabel("When the phone was asleep at alarm time, ring late within this period. Otherwise you get a notification.")
+	missedHint.AddCSSClass("body-text")
+	missedHint.SetHAlign(gtk.AlignStart)
+	missedHint.SetWrap(true)
+	missedHint.SetXAlign(0)
+	missedCard.Append(missedHint)
+
+	grace, _ := store.GetMissedAlarmGrace()
+	missedCard.Append(newSettingsSlider("Ring late", 0, 60, 5, grace, formatGrace, func(v int) {
+		store.SetMissedAlarmGrace(v)
+	}))
+
+	horizon, _ := store.GetSuspendInhibitHorizon()
+	missedCard.Append(newSettingsSlider("Stay awake before alarms", 0, 60, 5, horizon, formatHorizon, func(v int) {
+		store.SetSuspendInhibitHorizon(v)
+	}))
+}
+
+// newBackupCard exports alarms, settings and sleep history to a file and imports them again,
+// e.g. on another device.
+func newBackupCard(store *storage.Store, d *daemon.Daemon, showModal func(*gtk.Widget) func()) *gtk.Box {
+	card := ui.CreateCardBox()
+
+	header := gtk.NewLabel("Backup")
+	header.AddCSSClass("h2")
+	header.SetHAlign(gtk.AlignStart)
+	header.SetMarginBottom(10)
+	card.Append(header)
+
+	hint := gtk.NewLabel("Save alarms, settings and sleep history to a file, or restore them from one.")
+	hint.AddCSSClass("body-text")
+	hint.SetHAlign(gtk.AlignStart)
+	hint.SetWrap(true)
+	hint.SetXAlign(0)
+	card.Append(hint)
+
+	replaceRow := gtk.NewBox(gtk.OrientationHorizontal, 10)
+	replaceRow.SetMarginTop(10)
+	lblReplace := gtk.NewLabel("Replace current data on import")
+	lblReplace.AddCSSClass("body-text")
+	lblReplace.SetHExpand(true)
+	lblReplace.SetHAlign(gtk.AlignStart)
+	switchReplace := gtk.NewSwitch()
+	switchReplace.SetVAlign(gtk.AlignCenter)
+	replaceRow.Append(lblReplace)
+	replaceRow.Append(switchReplace)
+	card.Append(replaceRow)
+
+	buttons := gtk.NewBox(gtk.OrientationHorizontal, 10)
+	buttons.SetMarginTop(10)
+	btnExport := gtk.NewButtonWithLabel("Export")
+	btnExport.AddCSSClass("pill-button")
+	btnExport.SetHExpand(true)
+	btnImport := gtk.NewButtonWithLabel("Import")
+	btnImport.AddCSSClass("pill-button")
+	btnImport.SetHExpand(true)
+	buttons.Append(btnExport)
+	buttons.Append(btnImport)
+	card.Append(buttons)
+
+	status := gtk.NewLabel("")
+	status.AddCSSClass("body-text")
+	status.SetHAlign(gtk.AlignStart)
+	status.SetWrap(true)
+	status.SetXAlign(0)
+	status.SetMarginTop(10)
+	status.SetVisible(false)
+	card.Append(status)
+
+	showStatus := func(text string) {
+		status.SetText(text)
+		status.SetVisible(true)
+	}
+
+	btnExport.ConnectClicked(func() {
+		ui.ChooseBackupDestination(btnExport, func(path string) {
+			if err := exportBackup(store, path); err != nil {
+				log.Printf("Failed to export backup: %v", err)
+				showStatus(fmt.Sprintf("Export failed: %v", err))
+				return
+			}
+			showStatus("Saved to " + filepath.Base(path))
+		})
+	})
+
+	importFrom := func(path string, mode storage.ImportMode) {
+		f, err := os.Open(path)
+		if err != nil {
+			showStatus(fmt.Sprintf("Import failed: %v", err))
+			return
+		}
+		defer f.Close()
+
+		result, err := d.ImportBackup(f, mode)
+		if err != nil {
+			log.Printf("Failed to import backup: %v", err)
+			showStatus(fmt.Sprintf("Import failed: %v", err))
+			return
+		}
+		showStatus(fmt.Sprintf("Imported %d alarms, %d settings and %d sleep sessions", result.Alarms, result.Settings, result.SleepSessions))
+	}
+
+	btnImport.ConnectClicked(func() {
+		replace := switchReplace.Active()
+		ui.ChooseBackupFile(btnImport, func(path string) {
+			if !replace {
+				importFrom(path, storage.ImportMerge)
+				return
+			}
+			// Replacing wipes what is there now, so it is confirmed first.
+			var closeOverlay func()
+
+			vbox := gtk.NewBox(gtk.OrientationVertical, 20)
+			vbox.AddCSSClass("modal-content")
+			vbox.SetHAlign(gtk.AlignCenter)
+			vbox.SetVAlign(gtk.AlignCenter)
+
+			title := gtk.NewLabel("Replace Current Data?")
+			title.AddCSSClass("h2")
+			vbox.Append(title)
+
+			msg := gtk.NewLabel("All alarms, settings and sleep history will be replaced by " + filepath.Base(path) + ".")
+			msg.SetWrap(true)
+			vbox.Append(msg)
+
+			actionBox := gtk.NewBox(gtk.OrientationHorizontal, 20)
+			actionBox.AddCSSClass("modal-actions")
+			actionBox.SetHAlign(gtk.AlignCenter)
+
+			cancelBtn := gtk.NewButtonWithLabel("Cancel")
+			cancelBtn.AddCSSClass("modal-btn")
+			cancelBtn.ConnectClicked(func() {
+				closeOverlay()
+			})
+			actionBox.Append(cancelBtn)
+
+			confirmBtn := gtk.NewButtonWithLabel("Replace")
+			confirmBtn.AddCSSClass("modal-btn")
+			confirmBtn.AddCSSClass("destructive-action")
+			confirmBtn.ConnectClicked(func() {
+				closeOverlay()
+				importFrom(path, storage.ImportReplace)
+			})
+			actionBox.Append(confirmBtn)
+			vbox.Append(actionBox)
+
+			closeOverlay = showModal(&vbox.Widget)
+		})
+	})
+
+	return card
+}
+
+func exportBackup(store *storage.Store, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := store.Export(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func formatHorizon(minutes int) string {
+	if minutes == 0 {
+		return "Off"
+	}
+	return fmt.Sprintf("%d min", minutes)
+}
+
+func formatGrace(minutes int) string {
+	if minutes == 0 {
+		return "Never"
+	}
+	return fmt.Sprintf("%d min", minutes)
+}
+
+func formatFadeIn(seconds int) string {
+	if seconds == 0 {
+		return "Off"
+	}
+	return fmt.Sprintf("%d s", seconds)
+}
+
+// newSettingsSlider builds a captioned slider with its current value shown next to it.
+func newSettingsSlider(caption string, minVal, maxVal, step float64, value int, format func(int) string, onChange func(int)) *gtk.Box {
+	vbox := gtk.NewBox(gtk.OrientationVertical, 5)
+	vbox.SetMarginTop(10)
+
+	lblCaption := gtk.NewLabel(caption)
+	lblCaption.AddCSSClass("body-text")
+	lblCaption.SetHAlign(gtk.AlignStart)
+	vbox.Append(lblCaption)
+
+	sliderBox := gtk.NewBox(gtk.OrientationHorizontal, 10)
+
+	lblValue := gtk.NewLabel(format(value))
+	lblValue.AddCSSClass("h3")
+	lblValue.SetWidthChars(6)
+
+	scale := gtk.NewScaleWithRange(gtk.OrientationHorizontal, minVal, maxVal, step)
+	scale.SetValue(float64(value))
+	scale.SetHExpand(true)
+	scale.SetDrawValue(false)
+	scale.SetSizeRequest(-1, 40)
+
+	scale.ConnectValueChanged(func() {
+		val := int(scale.Value())
+		lblValue.SetText(format(val))
+		onChange(val)
+	})
+
+	sliderBox.Append(scale)
+	sliderBox.Append(lblValue)
+	vbox.Append(sliderBox)
+
+	return vbox
+}
+
+var outputPolicies = []string{storage.OutputAlwaysSpeaker, storage.OutputFollowDefault, storage.OutputPreferHeadphones}
+
+// newOutputCard lets the user choose where alarms play: a pinned sink, or a policy
+// for picking one. The sink list is loaded from PulseAudio in the background.
+func newOutputCard(store *storage.Store) *gtk.Box {
+	card := ui.CreateCardBox()
+
+	header := gtk.NewLabel("Audio Output")
+	header.AddCSSClass("h2")
+	header.SetHAlign(gtk.AlignStart)
+	header.SetMarginBottom(10)
+	card.Append(header)
+
+	policy, _ := store.GetAudioOutputPolicy()
+	policyRow, policyDrop := ui.NewChoiceRow("Play alarms on", []string{"Speaker", "Default output", "Headphones if connected"}, uint(slices.Index(outputPolicies, policy)))
+	card.Append(policyRow)
+
+	policyDrop.NotifyProperty("selected", func() {
+		i := policyDrop.Selected()
+		if int(i) >= len(outputPolicies) {
+			return
+		}
+		if err := store.SetAudioOutputPolicy(outputPolicies[i]); err != nil {
+			log.Printf("Failed to save output policy: %v", err)
+		}
+	})
+
+	sinkRow, sinkDrop := ui.NewChoiceRow("Preferred output", []string{"Automatic"}, 0)
+	sinkRow.SetMarginTop(10)
+	card.Append(sinkRow)
+
+	btnRefresh := gtk.NewButtonFromIconName("view-refresh-symbolic")
+	btnRefresh.SetTooltipText("Refresh Outputs")
+	btnRefresh.AddCSSClass("flat")
+	btnRefresh.SetVAlign(gtk.AlignCenter)
+	sinkRow.Append(btnRefresh)
+
+	// names mirrors the dropdown entries; "" stands for Automatic.
+	names := []string{""}
+	loading := false
+
+	sinkDrop.NotifyProperty("selected", func() {
+		i := sinkDrop.Selected()
+		if loading || int(i) >= len(names) {
+			return
+		}
+		if err := store.SetAudioOutputSink(names[i]); err != nil {
+			log.Printf("Failed to save output sink: %v", err)
+		}
 	})
 
-	return box
+	reload := func() {
+		btnRefresh.SetSensitive(false)
+		go func() {
+			sinks, err := daemon.ListSinks()
+			glib.IdleAdd(func() {
+				btnRefresh.SetSensitive(true)
+				if err != nil {
+					log.Printf("Failed to list audio outputs: %v", err)
+				}
+
+				pinned, _ := store.GetAudioOutputSink()
+				labels := []string{"Automatic"}
+				names = []string{""}
+				selected := uint(0)
+				for _, s := range sinks {
+					if s.Name == pinned {
+						selected = uint(len(names))
+					}
+					labels = append(labels, s.Description)
+					names = append(names, s.Name)
+				}
+				if pinned != "" && selected == 0 {
+					selected = uint(len(names))
+					labels = append(labels, fmt.Sprintf("%s (not connected)", pinned))
+					names = append(names, pinned)
+				}
+
+				loading = true
+				sinkDrop.SetModel(gtk.NewStringList(labels))
+				sinkDrop.SetSelected(selected)
+				loading = false
+			})
+		}()
+	}
+
+	btnRefresh.ConnectClicked(reload)
+	reload()
+
+	return card
 }
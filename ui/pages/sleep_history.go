@@ -13,16 +13,18 @@ import (
 
 type SleepHistoryController struct {
 	Box *gtk.Box
+
+	store *storage.Store
 }
 
-func NewSleepHistoryPage() *SleepHistoryController {
+func NewSleepHistoryPage(store *storage.Store) *SleepHistoryController {
 	box := gtk.NewBox(gtk.OrientationVertical, 10)
 	box.SetMarginTop(20)
 	box.SetMarginStart(20)
 	box.SetMarginEnd(20)
 	box.SetMarginBottom(20)
 
-	controller := &SleepHistoryController{Box: box}
+	controller := &SleepHistoryController{Box: box, store: store}
 	controller.Refresh()
 
 	return controller
@@ -39,7 +41,7 @@ func (c *SleepHistoryController) Refresh() {
 		c.Box.Remove(child)
 	}
 
-	history, err := storage.GetHistory(30)
+	history, err := c.store.GetHistory(30)
 	if err != nil {
 		errLabel := gtk.NewLabel("Failed to load history")
 		c.Box.Append(errLabel)
@@ -58,7 +60,7 @@ func (c *SleepHistoryController) Refresh() {
 	avgCard := createAverageCard(avgDuration, avgSnooze)
 	c.Box.Append(avgCard)
 
-	lastSession, err := storage.GetLastSleepSession()
+	lastSession, err := c.store.GetLastSleepSession()
 	if err == nil && lastSession != nil {
 		card := createLastNightCard(lastSession)
 		c.Box.Append(card)